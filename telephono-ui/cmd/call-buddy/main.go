@@ -2,17 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	t "github.com/call-buddy/call-buddy/telephono"
 	"github.com/call-buddy/gocui"
@@ -21,6 +28,12 @@ import (
 var profiles *t.CallBuddyProfiles
 var stateDir string
 
+// secretKey The key secret variables are decrypted with, nil until they are
+// unlocked
+var secretKey *t.SecretKey
+
+var errLockedSecrets = errors.New("The secret variables are locked, use 'unlock' first.")
+
 func init() {
 	if f, err := os.OpenFile("tui.log", os.O_RDWR|os.O_APPEND|os.O_CREATE, 0755); err != nil {
 		panic(err.Error())
@@ -56,8 +69,7 @@ func lookupStateDir() (dir string) {
 }
 
 func getCurrentRequestTemplate(state *t.CallBuddyState) *t.RequestTemplate {
-	// DEMO AH: Obviously this is NOT ok
-	return profiles.CurrentState().Collections[0].RequestTemplates[0]
+	return &state.Current
 }
 
 type HistView gocui.View
@@ -98,6 +110,8 @@ const (
 	RQT_BODY
 	// HIST_BODY The history body is active
 	HIST_BODY
+	// GQL_VARS The GraphQL variables view is active
+	GQL_VARS
 	// RSP_BODY The response body view is active
 	RSP_BODY
 	// NO_STATE No state is selected
@@ -117,6 +131,8 @@ const (
 	RSP_BODY_VIEW = "response_body"
 	// HIST_VIEW The history body view string
 	HIST_VIEW = "history_body"
+	// GQL_VARS_VIEW The GraphQL variables view string
+	GQL_VARS_VIEW = "graphql_variables"
 )
 
 type ioHijacker struct {
@@ -127,13 +143,20 @@ type ioHijacker struct {
 
 var currView ViewState = NO_STATE //needs a better name
 
+// graphqlMode Whether the request body view holds a GraphQL query and the
+// GraphQL variables view is shown below it
+var graphqlMode bool
+
+// graphqlVariables What the GraphQL variables view holds while it's hidden
+var graphqlVariables string
+
 func die(msg string) {
 	os.Stderr.WriteString(msg)
 	os.Exit(1)
 }
 
 // saveResponseToFile Save response body to a file
-func saveResponseToFile(contents, filepath string, appendToFile bool) (err error) {
+func saveResponseToFile(contents io.Reader, filepath string, appendToFile bool) (err error) {
 	var fd *os.File
 	if appendToFile {
 		fd, err = os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -144,7 +167,7 @@ func saveResponseToFile(contents, filepath string, appendToFile bool) (err error
 		return
 	}
 	defer fd.Close()
-	fd.WriteString(contents)
+	_, err = io.Copy(fd, contents)
 	return
 }
 
@@ -157,6 +180,15 @@ func loadResponseFromFile(requestBodyView *gocui.View, filepath string) (err err
 	return
 }
 
+// unlockCurrentProfile Makes the current profile decrypt its secret variables
+// with the key they were last unlocked with, if any
+func unlockCurrentProfile() error {
+	if secretKey == nil {
+		return nil
+	}
+	return profiles.CurrentState().Environment.User.Unlock(secretKey)
+}
+
 func addUserEnvironmentVariable(kv string) {
 	var splatted []string
 	if splatted = strings.SplitN(kv, "=", 2); len(splatted) != 2 {
@@ -195,38 +227,1030 @@ func getHeadersFromView(headerBody string) (headers http.Header, errs []error) {
 			continue
 		}
 
-		if splatted = strings.SplitN(rawHeader, ": ", 2); len(splatted) != 2 {
-			errs = append(errs, errors.New("Could not split "+rawHeader))
-			continue
+		if splatted = strings.SplitN(rawHeader, ": ", 2); len(splatted) != 2 {
+			errs = append(errs, errors.New("Could not split "+rawHeader))
+			continue
+		}
+		headers.Add(splatted[0], splatted[1])
+	}
+	return
+}
+
+// TODO AH: args should probably get broken out into real parameters
+func call(g *gocui.Gui, methodType, url, body, headerBody string) error {
+	theTemplate, client, err := callTemplate(methodType, url, body, headerBody)
+	if err != nil {
+		return err
+	}
+	return startCall(g, theTemplate, client)
+}
+
+// callTemplate Returns the template for a call with the given method, url,
+// body and headers, and the client to make it with
+func callTemplate(methodType, url, body, headerBody string) (t.RequestTemplate, *http.Client, error) {
+	method, err := t.ToHttpMethod(methodType)
+	if err != nil {
+		return t.RequestTemplate{}, nil, err
+	}
+	// TODO AH: Clean up documentation and other places
+	//contentType := "text/plain"
+
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	theTemplate.Method = method
+	theTemplate.Body = body
+	theTemplate.Url = url
+	theTemplate.GraphQL = false
+	theTemplate.Variables = ""
+	headers, errs := getHeadersFromView(headerBody)
+	if len(errs) != 0 {
+		var combinedErr string
+		for i, err := range errs {
+			combinedErr += err.Error()
+			if i != len(errs)-1 {
+				combinedErr += "\n"
+			}
+		}
+		return t.RequestTemplate{}, nil, errors.New(combinedErr)
+	}
+	theTemplate.Headers = headers
+	client, err := profiles.CurrentState().HttpClient()
+	if err != nil {
+		return t.RequestTemplate{}, nil, err
+	}
+	return theTemplate.Clone(), client, nil
+}
+
+// inFlightCall The call being made in the background, if any
+var inFlightCall struct {
+	sync.Mutex
+	cancel   context.CancelFunc
+	started  time.Time
+	progress *t.BodyProgress
+}
+
+// startCall Makes the call in the background so the UI keeps responding. The
+// progress is shown in the title view until the call finishes or is cancelled
+// using cancelCall.
+func startCall(g *gocui.Gui, theTemplate t.RequestTemplate, client *http.Client) error {
+	inFlightCall.Lock()
+	defer inFlightCall.Unlock()
+	if inFlightCall.cancel != nil {
+		return errors.New("A call is already being made, use Ctrl-C to cancel it.")
+	}
+
+	// The call must not touch anything the UI can change while it's made
+	profile := (*profiles)[0]
+	env := profile.State.Environment.Clone()
+	if env.User.Locked() {
+		return errLockedSecrets
+	}
+	progress := &t.BodyProgress{}
+	limit := profile.State.ClientConfig.BodyLimit(progress)
+	oauth2 := profile.State.OAuth2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	inFlightCall.cancel = cancel
+	inFlightCall.started = time.Now()
+	inFlightCall.progress = progress
+	done := make(chan struct{})
+	go showCallProgress(g, done)
+
+	go func() {
+		historicalCall, err := theTemplate.ExecuteOAuth2(ctx, client, &env, oauth2, limit)
+		close(done)
+
+		inFlightCall.Lock()
+		cancel()
+		inFlightCall.cancel = nil
+		elapsed := time.Since(inFlightCall.started)
+		inFlightCall.Unlock()
+
+		g.Update(func(gui *gocui.Gui) error {
+			rspBodyView, _ := gui.View(RSP_BODY_VIEW)
+			if keepOAuth2Tokens(&env, &profile.State.Environment) {
+				profile.State.Save(profile.Path)
+			}
+			if errors.Is(err, context.Canceled) {
+				updateResponseBodyView(rspBodyView, fmt.Sprintf("Call cancelled after %.1fs", elapsed.Seconds()))
+				return nil
+			}
+			if err != nil {
+				// Print error out in place of response body
+				updateResponseBodyView(rspBodyView, err.Error())
+				return nil
+			}
+			profile.State.History.AddFinishedCall(historicalCall)
+			results, _ := theTemplate.Check(historicalCall)
+			captured := theTemplate.Capture(historicalCall, &profile.State.Environment)
+			profile.State.Save(profile.Path)
+			report := formatAssertionResults(results) + formatCaptureResults(captured)
+			if theTemplate.GraphQL {
+				report = formatGraphQLErrors(historicalCall) + report
+			}
+			updateViewsWithCheckedCall(gui, historicalCall, report)
+			return nil
+		})
+	}()
+	return nil
+}
+
+// startStream Makes the call in the background and appends the events of the
+// response to the response body view as they arrive, until the server ends
+// the response or the stream is cancelled using cancelCall.
+func startStream(g *gocui.Gui, theTemplate t.RequestTemplate, client *http.Client) error {
+	inFlightCall.Lock()
+	defer inFlightCall.Unlock()
+	if inFlightCall.cancel != nil {
+		return errors.New("A call is already being made, use Ctrl-C to cancel it.")
+	}
+
+	profile := (*profiles)[0]
+	env := profile.State.Environment.Clone()
+	if env.User.Locked() {
+		return errLockedSecrets
+	}
+	// Streams may never end, so only cancelling stops them
+	streamClient := *client
+	streamClient.Timeout = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := time.Now()
+	inFlightCall.cancel = cancel
+	inFlightCall.started = started
+	inFlightCall.progress = &t.BodyProgress{}
+	done := make(chan struct{})
+	go showCallProgress(g, done)
+
+	go func() {
+		events := 0
+		historicalCall, err := theTemplate.Stream(ctx, &streamClient, &env, func(response t.Response) {
+			head := "Streaming " + response.Status + "\n" + t.FormatHeaders(response.Header, prettyResponses) + "\n"
+			g.Update(func(gui *gocui.Gui) error {
+				rspBodyView, _ := gui.View(RSP_BODY_VIEW)
+				updateResponseBodyView(rspBodyView, head)
+				shownResponse.streaming = true
+				rspBodyView.Autoscroll = true
+				return nil
+			})
+		}, func(event t.StreamEvent) {
+			events++
+			appendStreamText(g, event.Format(started))
+		})
+		close(done)
+
+		inFlightCall.Lock()
+		cancel()
+		inFlightCall.cancel = nil
+		elapsed := time.Since(inFlightCall.started)
+		inFlightCall.Unlock()
+
+		g.Update(func(gui *gocui.Gui) error {
+			rspBodyView, _ := gui.View(RSP_BODY_VIEW)
+			if historicalCall.Response.StatusCode == 0 {
+				// The stream never started
+				if errors.Is(err, context.Canceled) {
+					updateResponseBodyView(rspBodyView, fmt.Sprintf("Call cancelled after %.1fs", elapsed.Seconds()))
+				} else {
+					updateResponseBodyView(rspBodyView, err.Error())
+				}
+				return nil
+			}
+			profile.State.History.AddFinishedCall(historicalCall)
+			profile.State.Save(profile.Path)
+			if !shownResponse.streaming {
+				return nil
+			}
+			if err != nil {
+				fmt.Fprintf(rspBodyView, "\nStream failed after %.1fs and %d events: %s\n", elapsed.Seconds(), events, err)
+			} else {
+				fmt.Fprintf(rspBodyView, "\nStream ended after %.1fs and %d events\n", elapsed.Seconds(), events)
+			}
+			return nil
+		})
+	}()
+	return nil
+}
+
+// webSocket The open WebSocket, if any
+var webSocket struct {
+	sync.Mutex
+	session *t.WebSocketSession
+}
+
+// startWebSocket Opens a WebSocket in the background and appends the frames
+// sent and received to the response body view until it's closed using
+// closeWebSocket or by the server.
+func startWebSocket(g *gocui.Gui, theTemplate t.RequestTemplate, client *http.Client) error {
+	inFlightCall.Lock()
+	defer inFlightCall.Unlock()
+	if inFlightCall.cancel != nil {
+		return errors.New("A call is already being made, use Ctrl-C to cancel it.")
+	}
+	webSocket.Lock()
+	defer webSocket.Unlock()
+	if webSocket.session != nil {
+		return errors.New("A WebSocket is already open, use 'ws close' or Ctrl-C to close it.")
+	}
+
+	profile := (*profiles)[0]
+	env := profile.State.Environment.Clone()
+	if env.User.Locked() {
+		return errLockedSecrets
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	inFlightCall.cancel = cancel
+	inFlightCall.started = time.Now()
+	inFlightCall.progress = &t.BodyProgress{}
+	done := make(chan struct{})
+	go showCallProgress(g, done)
+
+	go func() {
+		session, err := theTemplate.DialWebSocket(ctx, client, &env)
+		close(done)
+		inFlightCall.Lock()
+		cancel()
+		inFlightCall.cancel = nil
+		inFlightCall.Unlock()
+		if err != nil {
+			g.Update(func(gui *gocui.Gui) error {
+				rspBodyView, _ := gui.View(RSP_BODY_VIEW)
+				updateResponseBodyView(rspBodyView, err.Error())
+				return nil
+			})
+			return
+		}
+
+		webSocket.Lock()
+		webSocket.session = session
+		webSocket.Unlock()
+		head := "Connected to " + session.Request.URL + "\n" + t.FormatHeaders(session.Response.Header, prettyResponses) + "\n"
+		g.Update(func(gui *gocui.Gui) error {
+			rspBodyView, _ := gui.View(RSP_BODY_VIEW)
+			updateResponseBodyView(rspBodyView, head)
+			shownResponse.streaming = true
+			rspBodyView.Autoscroll = true
+			return nil
+		})
+
+		err = session.Receive(func(frame t.WebSocketFrame) {
+			appendStreamText(g, frame.Format(session.Started))
+		})
+		webSocket.Lock()
+		webSocket.session = nil
+		webSocket.Unlock()
+
+		call := session.Call()
+		g.Update(func(gui *gocui.Gui) error {
+			profile.State.History.AddFinishedCall(call)
+			profile.State.Save(profile.Path)
+			return nil
+		})
+		if err != nil {
+			appendStreamText(g, fmt.Sprintf("\nWebSocket failed after %.1fs: %s\n", call.Timing.Total.Seconds(), err))
+		} else {
+			appendStreamText(g, fmt.Sprintf("\nWebSocket closed after %.1fs\n", call.Timing.Total.Seconds()))
+		}
+	}()
+	return nil
+}
+
+// appendStreamText Appends the text to the response body view if it still
+// shows the stream or WebSocket
+func appendStreamText(g *gocui.Gui, text string) {
+	g.Update(func(gui *gocui.Gui) error {
+		if shownResponse.streaming {
+			rspBodyView, _ := gui.View(RSP_BODY_VIEW)
+			fmt.Fprint(rspBodyView, text)
+		}
+		return nil
+	})
+}
+
+// sendWebSocketFrame Sends the text, expanded in the current environment, as
+// a frame over the open WebSocket. When binary is set, the text is the hex of
+// the bytes to send in a binary frame.
+func sendWebSocketFrame(g *gocui.Gui, text string, binary bool) error {
+	webSocket.Lock()
+	session := webSocket.session
+	webSocket.Unlock()
+	if session == nil {
+		return errors.New("No WebSocket is open, use 'ws URL' to open one.")
+	}
+
+	data := []byte(profiles.CurrentState().Environment.Expand(text))
+	if binary {
+		var err error
+		hexDigits := strings.Join(strings.Fields(string(data)), "")
+		if data, err = hex.DecodeString(hexDigits); err != nil {
+			return errors.New("Not hex " + hexDigits)
+		}
+	}
+	frame, err := session.Send(data, binary)
+	if err != nil {
+		return err
+	}
+	appendStreamText(g, frame.Format(session.Started))
+	return nil
+}
+
+// closeWebSocket Closes the open WebSocket, returns false if there isn't one
+func closeWebSocket() bool {
+	webSocket.Lock()
+	defer webSocket.Unlock()
+	if webSocket.session == nil {
+		return false
+	}
+	webSocket.session.Close()
+	return true
+}
+
+// grpcUrl Returns the URL as a gRPC one, so 'grpc' can be given host:port
+func grpcUrl(url string) string {
+	if t.IsGrpcUrl(url) {
+		return url
+	}
+	return "grpc://" + url
+}
+
+// describeGrpc Returns the services and methods of the gRPC server, or what
+// a method takes and returns, using the current profile's settings
+func describeGrpc(url string) (string, error) {
+	client, err := profiles.CurrentState().HttpClient()
+	if err != nil {
+		return "", err
+	}
+	// The UI waits for the answer, so don't wait forever
+	timeout := client.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return t.DescribeGrpc(ctx, client, profiles.CurrentState().Environment.Expand(grpcUrl(url)))
+}
+
+// graphqlCall Posts the query in the request body view to the GraphQL server
+// with the variables in the GraphQL variables view, which is shown if it
+// wasn't already
+func graphqlCall(g *gocui.Gui, url, query, headerBody string) error {
+	theTemplate, client, err := callTemplate("post", url, query, headerBody)
+	if err != nil {
+		return err
+	}
+	variables := graphqlVariablesBuffer(g)
+	if _, err := t.GraphQLEnvelope(query, variables); err != nil {
+		return err
+	}
+	graphqlMode = true
+	current := getCurrentRequestTemplate(profiles.CurrentState())
+	current.GraphQL, current.Variables = true, variables
+	theTemplate.GraphQL, theTemplate.Variables = true, variables
+	return startCall(g, theTemplate, client)
+}
+
+// graphqlVariablesBuffer Returns what the GraphQL variables view holds
+func graphqlVariablesBuffer(g *gocui.Gui) string {
+	if view, err := g.View(GQL_VARS_VIEW); err == nil {
+		return view.Buffer()
+	}
+	return graphqlVariables
+}
+
+// describeGraphQL Returns the root types and the other types of the GraphQL
+// server's schema, or the fields of one type, using the headers in the view
+func describeGraphQL(url, typeName, headerBody string) (string, error) {
+	theTemplate, client, err := callTemplate("post", url, "", headerBody)
+	if err != nil {
+		return "", err
+	}
+	// The UI waits for the answer, so don't wait forever
+	timeout := client.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	env := profiles.CurrentState().Environment
+	schema, err := theTemplate.IntrospectGraphQL(ctx, client, &env)
+	if err != nil {
+		return "", err
+	}
+	return schema.Describe(typeName)
+}
+
+// formatGraphQLErrors Returns a line per error in the GraphQL response
+func formatGraphQLErrors(call t.HistoricalCall) (output string) {
+	for _, graphQLError := range t.GraphQLErrors(call.Response.Body) {
+		output += "ERROR " + graphQLError.String() + "\n"
+	}
+	return
+}
+
+// cancelCall Cancels the call being made, returns false if there isn't one
+func cancelCall() bool {
+	inFlightCall.Lock()
+	defer inFlightCall.Unlock()
+	if inFlightCall.cancel == nil {
+		return false
+	}
+	inFlightCall.cancel()
+	return true
+}
+
+// showCallProgress Shows a spinner, the time spent on the call being made and
+// how much of the body has been received in the title view until done is
+// closed
+func showCallProgress(g *gocui.Gui, done chan struct{}) {
+	spinner := `|/-\`
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		select {
+		case <-done:
+			g.Update(func(gui *gocui.Gui) error {
+				titleView, _ := gui.View(TTL_LINE_VIEW)
+				updateTitleView(titleView, "")
+				return nil
+			})
+			return
+		case <-ticker.C:
+			inFlightCall.Lock()
+			elapsed := time.Since(inFlightCall.started)
+			progress := inFlightCall.progress
+			inFlightCall.Unlock()
+			status := fmt.Sprintf("%c %.1fs", spinner[frame%len(spinner)], elapsed.Seconds())
+			if received, _ := progress.Received(); received > 0 {
+				status += ", " + progress.String()
+			}
+			g.Update(func(gui *gocui.Gui) error {
+				titleView, _ := gui.View(TTL_LINE_VIEW)
+				updateTitleView(titleView, status)
+				return nil
+			})
+		}
+	}
+}
+
+// getMethodAndUrlFromView Extracts the url and the selected method from the
+// method body view
+func getMethodAndUrlFromView(methodBody string) (url string, method t.HttpMethod) {
+	method = t.Get
+	for i, line := range strings.Split(methodBody, "\n") {
+		line = strings.TrimSpace(line)
+		if i == 0 {
+			url = line
+			continue
+		}
+		if selected := strings.Index(line, "[x] "); selected != -1 {
+			method = t.HttpMethod(strings.Fields(line[selected+len("[x] "):])[0])
+		}
+	}
+	return
+}
+
+// storeViewsInTemplate Stores what is in the method, request header and
+// request body views into the current request template
+func storeViewsInTemplate(g *gocui.Gui) error {
+	methodBodyView, _ := g.View(MTD_BODY_VIEW)
+	requestHeaderView, _ := g.View(RQT_HEAD_VIEW)
+	requestBodyView, _ := g.View(RQT_BODY_VIEW)
+
+	headers, errs := getHeadersFromView(requestHeaderView.Buffer())
+	if len(errs) != 0 {
+		return errs[0]
+	}
+
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	theTemplate.Url, theTemplate.Method = getMethodAndUrlFromView(methodBodyView.Buffer())
+	theTemplate.Headers = headers
+	theTemplate.Body = requestBodyView.Buffer()
+	theTemplate.GraphQL = graphqlMode
+	theTemplate.Variables = ""
+	if graphqlMode {
+		theTemplate.Variables = graphqlVariablesBuffer(g)
+	}
+	return nil
+}
+
+// saveTemplate Saves the views as a named template in the current profile
+func saveTemplate(g *gocui.Gui, name string) error {
+	if err := storeViewsInTemplate(g); err != nil {
+		return err
+	}
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState()).Clone()
+	theTemplate.Name = name
+	if err := profiles.CurrentState().Templates().Save(theTemplate); err != nil {
+		return err
+	}
+	return profiles.Save(stateDir)
+}
+
+// loadTemplate Makes the named template the current template and shows it
+// in the views
+func loadTemplate(g *gocui.Gui, name string) error {
+	saved, err := profiles.CurrentState().Templates().Get(name)
+	if err != nil {
+		return err
+	}
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	*theTemplate = saved.Clone()
+	updateViewsWithTemplate(g, *theTemplate)
+	return profiles.Save(stateDir)
+}
+
+// listTemplates Returns a listing of the templates in the current profile
+func listTemplates() (output string) {
+	for _, template := range profiles.CurrentState().Templates().List() {
+		output += fmt.Sprintf("%-24s %8s %s\n", template.Name, template.Method, template.Url)
+	}
+	if output == "" {
+		output = "No templates saved. Use 'save NAME' to save one."
+	}
+	return
+}
+
+// importPostman Imports a Postman collection or environment file into the
+// current profile's templates and User environment
+func importPostman(filepath string) (string, error) {
+	fd, err := os.Open(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	imported, err := t.ImportPostman(fd)
+	if err != nil {
+		return "", err
+	}
+
+	state := profiles.CurrentState()
+	saved := 0
+	for _, template := range imported.Collection.RequestTemplates {
+		if err := state.Templates().Save(*template); err != nil {
+			imported.Skipped = append(imported.Skipped, err)
+		} else {
+			saved++
+		}
+	}
+	for key, value := range imported.Variables {
+		state.Environment.User.Set(key, value)
+	}
+	if err := profiles.Save(stateDir); err != nil {
+		return "", err
+	}
+
+	output := fmt.Sprintf("Imported %d templates and %d variables from %s\n",
+		saved, len(imported.Variables), filepath)
+	for _, skipped := range imported.Skipped {
+		output += "Skipped " + skipped.Error() + "\n"
+	}
+	return output, nil
+}
+
+// curlCommand Returns the curl command line for the views or, if argv asks for
+// it, for the Nth call in the history (the most recent call by default)
+func curlCommand(g *gocui.Gui, argv []string) (string, error) {
+	if len(argv) < 2 {
+		if err := storeViewsInTemplate(g); err != nil {
+			return "", err
+		}
+		theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+		return theTemplate.Curl(&profiles.CurrentState().Environment)
+	}
+
+	history := &profiles.CurrentState().History
+	n := history.Size()
+	if len(argv) > 2 {
+		var err error
+		if n, err = strconv.Atoi(argv[2]); err != nil {
+			return "", errors.New("Not a history position " + argv[2])
+		}
+	}
+	// Positions start at 1 like the lines in the history view
+	historicalCall, err := historyCall(n - 1)
+	if err != nil {
+		return "", err
+	}
+	return historicalCall.Curl(), nil
+}
+
+// loadCurlCommand Parses the curl command line into the method, URL, headers
+// and body of the current template and shows it in the views. The template's
+// name, assertions, captures and other settings are kept.
+func loadCurlCommand(g *gocui.Gui, commandLine string) (string, error) {
+	parsed, err := t.ParseCurl(commandLine)
+	if err != nil {
+		return "", err
+	}
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	theTemplate.Method = parsed.Template.Method
+	theTemplate.Url = parsed.Template.Url
+	theTemplate.Headers = parsed.Template.Headers
+	theTemplate.Body = parsed.Template.Body
+	updateViewsWithTemplate(g, *theTemplate)
+
+	output := "Loaded the curl command into the views.\n"
+	if len(parsed.Ignored) > 0 {
+		output += "Ignored " + strings.Join(parsed.Ignored, " ") + "\n"
+	}
+	if parsed.Insecure && !profiles.CurrentState().ClientConfig.Insecure {
+		output += "Ignored -k, use 'set insecure=on' to skip certificate verification.\n"
+	}
+	return output, nil
+}
+
+// setClientConfig Sets the KEY=VALUE client settings of the current profile
+func setClientConfig(kvs []string) (output string, err error) {
+	config := profiles.CurrentState().ClientConfig
+	for _, kv := range kvs {
+		splatted := strings.SplitN(kv, "=", 2)
+		if len(splatted) != 2 {
+			return "", errors.New("Expected KEY=VALUE, got " + kv)
+		}
+		if err = config.Set(splatted[0], splatted[1]); err != nil {
+			return
+		}
+	}
+	// Only apply the settings if all of them are valid
+	profiles.CurrentState().ClientConfig = config
+	if err = profiles.Save(stateDir); err != nil {
+		return
+	}
+	return config.String(), nil
+}
+
+// assertCommand Lists, adds or removes the assertions of the current
+// template
+func assertCommand(argv []string, rawCommand string) (string, error) {
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	if len(argv) < 2 {
+		if len(theTemplate.Assertions) == 0 {
+			return "No assertions. Use e.g. 'assert status == 200' to add one.", nil
+		}
+		var output string
+		for i, assertion := range theTemplate.Assertions {
+			output += fmt.Sprintf("%3d  %s\n", i+1, assertion)
+		}
+		return output, nil
+	}
+
+	switch strings.ToLower(argv[1]) {
+	case "clear":
+		theTemplate.Assertions = nil
+		return "Removed every assertion.", profiles.Save(stateDir)
+	case "remove":
+		if len(argv) < 3 {
+			return "", errors.New("Expected the number of the assertion to remove")
+		}
+		n, err := strconv.Atoi(argv[2])
+		if err != nil || n < 1 || n > len(theTemplate.Assertions) {
+			return "", errors.New("No assertion " + argv[2])
+		}
+		removed := theTemplate.Assertions[n-1]
+		theTemplate.Assertions = append(theTemplate.Assertions[:n-1], theTemplate.Assertions[n:]...)
+		return "Removed " + removed.String(), profiles.Save(stateDir)
+	}
+
+	// Everything after the command, keeping the spaces of the expected value
+	assertion, err := t.ParseAssertion(strings.TrimSpace(rawCommand[len(argv[0]):]))
+	if err != nil {
+		return "", err
+	}
+	theTemplate.Assertions = append(theTemplate.Assertions, assertion)
+	return "Added " + assertion.String(), profiles.Save(stateDir)
+}
+
+// captureCommand Lists, adds or removes the captures of the current template
+func captureCommand(argv []string, rawCommand string) (string, error) {
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	if len(argv) < 2 {
+		if len(theTemplate.Captures) == 0 {
+			return "No captures. Use e.g. 'capture User.TOKEN = json:$.access_token' to add one.", nil
+		}
+		var output string
+		for i, capture := range theTemplate.Captures {
+			output += fmt.Sprintf("%3d  %s\n", i+1, capture)
+		}
+		return output, nil
+	}
+
+	switch strings.ToLower(argv[1]) {
+	case "clear":
+		theTemplate.Captures = nil
+		return "Removed every capture.", profiles.Save(stateDir)
+	case "remove":
+		if len(argv) < 3 {
+			return "", errors.New("Expected the number of the capture to remove")
+		}
+		n, err := strconv.Atoi(argv[2])
+		if err != nil || n < 1 || n > len(theTemplate.Captures) {
+			return "", errors.New("No capture " + argv[2])
+		}
+		removed := theTemplate.Captures[n-1]
+		theTemplate.Captures = append(theTemplate.Captures[:n-1], theTemplate.Captures[n:]...)
+		return "Removed " + removed.String(), profiles.Save(stateDir)
+	}
+
+	capture, err := t.ParseCapture(strings.TrimSpace(rawCommand[len(argv[0]):]))
+	if err != nil {
+		return "", err
+	}
+	theTemplate.Captures = append(theTemplate.Captures, capture)
+	return "Added " + capture.String(), profiles.Save(stateDir)
+}
+
+// authCommand Outputs, sets or removes how calls made with the template in
+// the views authenticate
+func authCommand(argv []string) (string, error) {
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	if len(argv) < 2 {
+		if theTemplate.Auth == nil {
+			return "Calls don't authenticate. Use e.g. 'auth bearer {{User.TOKEN}}' to make them.", nil
+		}
+		return "Calls authenticate using " + theTemplate.Auth.String(), nil
+	}
+	if strings.ToLower(argv[1]) == "off" {
+		theTemplate.Auth = nil
+		return "Calls don't authenticate.", profiles.Save(stateDir)
+	}
+	auth, err := t.ParseAuth(argv[1:])
+	if err != nil {
+		return "", err
+	}
+	theTemplate.Auth = &auth
+	return "Calls authenticate using " + auth.String(), profiles.Save(stateDir)
+}
+
+// oauth2Command Outputs, sets or removes how the current profile gets OAuth2
+// access tokens, or gets one right away
+func oauth2Command(argv []string) (string, error) {
+	state := profiles.CurrentState()
+	if len(argv) < 2 {
+		if state.OAuth2 == nil {
+			return "No OAuth2 configured. Use e.g. 'oauth2 client-credentials https://auth.example.com/token ID SECRET' to configure it.", nil
+		}
+		return "OAuth2 " + state.OAuth2.String() + "\n" + state.OAuth2.TokenStatus(&state.Environment), nil
+	}
+	switch strings.ToLower(argv[1]) {
+	case "off":
+		state.OAuth2 = nil
+		t.ForgetOAuth2Tokens(&state.Environment)
+		return "No OAuth2 configured, the cached tokens are removed.", profiles.Save(stateDir)
+	case "token":
+		if state.OAuth2 == nil {
+			return "", errors.New("No OAuth2 configured")
+		}
+		client, err := state.HttpClient()
+		if err != nil {
+			return "", err
+		}
+		// The UI waits for the answer, so don't wait forever
+		timeout := client.Timeout
+		if timeout == 0 {
+			timeout = 10 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := state.OAuth2.RenewToken(ctx, client, &state.Environment); err != nil {
+			return "", err
+		}
+		return state.OAuth2.TokenStatus(&state.Environment), profiles.Save(stateDir)
+	}
+	config, err := t.ParseOAuth2(argv[1:])
+	if err != nil {
+		return "", err
+	}
+	state.OAuth2 = &config
+	// Tokens of the previous configuration may be for another client
+	t.ForgetOAuth2Tokens(&state.Environment)
+	return "OAuth2 " + config.String() + "\nUse 'auth oauth2' to make calls with the template in the views send its tokens.", profiles.Save(stateDir)
+}
+
+// secretCommand Outputs the names of the secret variables or stores secret
+// variables in the User environment
+func secretCommand(argv []string) (string, error) {
+	user := &profiles.CurrentState().Environment.User
+	if len(argv) < 2 {
+		names := user.SecretNames()
+		if len(names) == 0 {
+			return "No secret variables. Use e.g. 'secret API_KEY=abc' to store one.", nil
+		}
+		output := ""
+		for _, name := range names {
+			output += user.Name + "." + name + "=********\n"
+		}
+		if user.Locked() {
+			output += "They are locked, use 'unlock' to use them."
+		}
+		return output, nil
+	}
+	if user.Locked() {
+		return "", errLockedSecrets
+	}
+	for _, kv := range argv[1:] {
+		splatted := strings.SplitN(kv, "=", 2)
+		if len(splatted) != 2 {
+			return "", errors.New("Expected KEY=VALUE, got " + kv)
+		}
+		if err := user.SetSecret(splatted[0], splatted[1]); err != nil {
+			return "", err
+		}
+	}
+	return "Stored encrypted.", profiles.Save(stateDir)
+}
+
+// unlockCommand Decrypts the secret variables of the current profile with a
+// passphrase or an age key, or forgets the key
+func unlockCommand(argv []string) (string, error) {
+	if len(argv) < 2 {
+		return "", errors.New("Expected unlock PASSPHRASE, unlock age KEY-FILE or unlock off")
+	}
+	var key *t.SecretKey
+	var err error
+	switch {
+	case strings.ToLower(argv[1]) == "off":
+		secretKey = nil
+		for _, profile := range profiles.List() {
+			profile.State.Environment.User.Lock()
+		}
+		return "The secret variables are locked.", nil
+	case strings.ToLower(argv[1]) == "age" && len(argv) == 3:
+		key, err = t.AgeKey(argv[2])
+	default:
+		key, err = t.PassphraseKey(strings.Join(argv[1:], " "))
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := profiles.CurrentState().Environment.User.Unlock(key); err != nil {
+		return "", err
+	}
+	secretKey = key
+	return "The secret variables are unlocked, new ones are encrypted with this key.", nil
+}
+
+// redactCommand Outputs or changes what is hidden in the history of the
+// current profile
+func redactCommand(argv []string, rawCommand string) (string, error) {
+	state := profiles.CurrentState()
+	redaction := state.RedactionRules()
+	if len(argv) < 2 {
+		if rules := redaction.String(); rules != "" {
+			return rules, nil
+		}
+		return "Nothing is redacted. Use 'redact reset' to redact the usual headers again.", nil
+	}
+	switch strings.ToLower(argv[1]) {
+	case "header":
+		if len(argv) < 3 {
+			return "", errors.New("Expected redact header NAME...")
+		}
+		for _, name := range argv[2:] {
+			redaction.AddHeader(name)
+		}
+	case "pattern":
+		pattern := strings.TrimSpace(rawCommand[strings.Index(rawCommand, argv[1])+len(argv[1]):])
+		if pattern == "" {
+			return "", errors.New("Expected redact pattern REGEX")
+		}
+		if err := redaction.AddPattern(pattern); err != nil {
+			return "", err
+		}
+	case "remove":
+		rule := strings.TrimSpace(rawCommand[strings.Index(rawCommand, argv[1])+len(argv[1]):])
+		if !redaction.Remove(rule) {
+			return "", errors.New("No such header or pattern " + rule)
+		}
+	case "reset":
+		*redaction = t.DefaultRedaction()
+	case "off":
+		*redaction = t.Redaction{}
+	default:
+		return "", errors.New("Expected redact header NAME, redact pattern REGEX, redact remove RULE, redact reset or redact off")
+	}
+	return "Redacting:\n" + redaction.String(), profiles.Save(stateDir)
+}
+
+// cookiesCommand Outputs, sets or clears the cookies of the current profile
+func cookiesCommand(argv []string) (string, error) {
+	state := profiles.CurrentState()
+	jar := state.CookieJar()
+	if len(argv) < 2 {
+		cookies := jar.List()
+		if len(cookies) == 0 {
+			return "No cookies. They are kept once servers set them, or use e.g. 'cookies set https://example.com session=abc'.", nil
+		}
+		lines := []string{}
+		for _, cookie := range cookies {
+			lines = append(lines, cookie.String())
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	switch strings.ToLower(argv[1]) {
+	case "clear":
+		domain := ""
+		if len(argv) >= 3 {
+			domain = argv[2]
+		}
+		removed := jar.Clear(domain)
+		return fmt.Sprintf("Removed %d cookies", removed), profiles.Save(stateDir)
+	case "set":
+		if len(argv) < 4 {
+			return "", errors.New("Expected cookies set URL NAME=VALUE")
+		}
+		if err := jar.Set(state.Environment.Expand(argv[2]), state.Environment.Expand(strings.Join(argv[3:], " "))); err != nil {
+			return "", err
+		}
+		return "Set the cookie for " + argv[2], profiles.Save(stateDir)
+	}
+	return "", errors.New("Expected cookies, cookies clear [DOMAIN] or cookies set URL NAME=VALUE")
+}
+
+// keepOAuth2Tokens Copies the OAuth2 tokens a call got into the environment
+// of the profile, returning whether there were new ones
+func keepOAuth2Tokens(from, to *t.CallBuddyEnvironment) (changed bool) {
+	if to.User.Secrets == nil {
+		to.User.Secrets = map[string]string{}
+	}
+	for _, variable := range t.OAuth2Variables {
+		// Encrypted tokens are secrets
+		for _, variables := range [][2]map[string]string{{from.User.Mapping, to.User.Mapping}, {from.User.Secrets, to.User.Secrets}} {
+			value, ok := variables[0][variable]
+			if current, had := variables[1][variable]; ok == had && value == current {
+				continue
+			}
+			if ok {
+				variables[1][variable] = value
+			} else {
+				delete(variables[1], variable)
+			}
+			changed = true
+		}
+	}
+	return
+}
+
+// connectToCommand Outputs, sets or clears the address calls made with the
+// template in the views connect to instead of the URL's host
+func connectToCommand(argv []string) (string, error) {
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	if len(argv) < 2 {
+		if theTemplate.ConnectTo == "" {
+			return "Calls connect to the host of their URL. Use e.g. 'connect-to 10.0.0.5:8443' to connect elsewhere.", nil
+		}
+		return "Calls connect to " + theTemplate.ConnectTo + " instead of the host of their URL.", nil
+	}
+	if strings.ToLower(argv[1]) == "off" {
+		theTemplate.ConnectTo = ""
+		return "Calls connect to the host of their URL.", profiles.Save(stateDir)
+	}
+	theTemplate.ConnectTo = argv[1]
+	return "Calls connect to " + argv[1] + " instead of the host of their URL.", profiles.Save(stateDir)
+}
+
+// protocolCommand Outputs, sets or clears the HTTP version calls made with the
+// template in the views use instead of the profile's
+func protocolCommand(argv []string) (string, error) {
+	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
+	if len(argv) < 2 {
+		if theTemplate.Protocol == "" {
+			return "Calls use the profile's HTTP version, see 'set http'. Use e.g. 'protocol 3' to use another one.", nil
+		}
+		return "Calls use HTTP version " + theTemplate.Protocol + " instead of the profile's.", nil
+	}
+	if err := theTemplate.SetProtocol(argv[1]); err != nil {
+		return "", err
+	}
+	if theTemplate.Protocol == "" {
+		return "Calls use the profile's HTTP version.", profiles.Save(stateDir)
+	}
+	return "Calls use HTTP version " + theTemplate.Protocol + " instead of the profile's.", profiles.Save(stateDir)
+}
+
+// formatCaptureResults Returns a line per capture with the value it stored
+func formatCaptureResults(results []t.CaptureResult) (output string) {
+	for _, result := range results {
+		if result.Err != nil {
+			output += "NOT CAPTURED User." + result.Capture.Variable + ": " + result.Err.Error() + "\n"
+		} else {
+			output += "CAPTURED User." + result.Capture.Variable + "=" + result.Value + "\n"
 		}
-		headers.Add(splatted[0], splatted[1])
 	}
 	return
 }
 
-// TODO AH: args should probably get broken out into real parameters
-func call(methodType, url, body, headerBody string) (t.HistoricalCall, error) {
-	methodType = strings.ToLower(methodType)
-	// TODO AH: Clean up documentation and other places
-	//contentType := "text/plain"
-
-	theTemplate := getCurrentRequestTemplate(profiles.CurrentState())
-	theTemplate.Method = t.HttpMethod(strings.ToUpper(methodType))
-	theTemplate.Body = body
-	theTemplate.Url = url
-	headers, errs := getHeadersFromView(headerBody)
-	if len(errs) != 0 {
-		var combinedErr string
-		for i, err := range errs {
-			combinedErr += err.Error()
-			if i != len(errs)-1 {
-				combinedErr += "\n"
-			}
+// formatAssertionResults Returns a line per assertion saying whether it
+// passed
+func formatAssertionResults(results []t.AssertionResult) (output string) {
+	for _, result := range results {
+		if result.Err != nil {
+			output += "FAIL " + result.Assertion.String() + ": " + result.Err.Error() + "\n"
+		} else {
+			output += "PASS " + result.Assertion.String() + "\n"
 		}
-		return t.HistoricalCall{}, errors.New(combinedErr)
 	}
-	theTemplate.Headers = headers
-	return theTemplate.Execute(http.DefaultClient, &profiles.CurrentState().Environment)
+	return
 }
 
 func enterHistoryView(g *gocui.Gui) {
@@ -251,7 +1275,7 @@ func enterHistoryView(g *gocui.Gui) {
 
 	g.Update(func(gui *gocui.Gui) error {
 		if profiles.CurrentState().History.Size() > 0 {
-			call, _ := profiles.CurrentState().History.Get(0)
+			call, _ := historyCall(0)
 			updateViewsWithCall(gui, call)
 		}
 		return nil
@@ -273,6 +1297,9 @@ func dumpEnvironment(name string) (output string) {
 		for key, value := range profiles.CurrentState().Environment.User.Mapping {
 			output += fmt.Sprintf("%s.%s=%s\n", profiles.CurrentState().Environment.User.Name, key, value)
 		}
+		for _, key := range profiles.CurrentState().Environment.User.SecretNames() {
+			output += fmt.Sprintf("%s.%s=********\n", profiles.CurrentState().Environment.User.Name, key)
+		}
 	}
 	if name == "Var" || name == "" {
 		for key, value := range profiles.CurrentState().Environment.OS.Mapping {
@@ -298,8 +1325,12 @@ albeit not quite as fancy. All commands output to the response
 body view if they output anything.
 
 Use the 'get', 'post', 'put' commands with a url to make basic
-HTTP calls. The 'header KEY=VALUE' command can be used to add
-headers in addition to modifying the request header section.
+HTTP calls. Any other method, including custom ones such as
+PROPFIND, can be used with the 'call' command. Calls are made in
+the background; the title shows how long the current call has
+taken and Ctrl-C cancels it. The 'header KEY=VALUE' command can be
+used to add headers in addition to modifying the request header
+section.
 HTTP calls are saved to a history viewable with the the 'history'
 command. OS environment variables are accessible via the
 {{Var.NAME}} syntax in the header and body views and viewable
@@ -339,13 +1370,46 @@ you risk unexpected errors or issues.
 
 HISTORY
 
-Every HTTP call made is stored internally for later access. Your
-history can be accessed using the 'history' command; doing so opens
-up a hidden view that you can arrow up or down in. Your selection
+Every HTTP call made is stored internally for later access along
+with where its time went: the DNS lookup, TCP connection, TLS
+handshake, time to the first response byte and the total time.
+The timing is shown above the response. Your history can be
+accessed using the 'history' command; doing so opens up a hidden
+view that you can arrow up or down in. Your selection
 temporarily updates the rest of the view with the call. Hitting
 enter makes the update permanent, hitting escape cancels the update.
 Both cause the history view to be exited and hidden again.
 
+TEMPLATES
+
+The method, url, request headers and request body in the views can
+be saved as a named template using the 'save' command and recalled
+into the views later using the 'load' command. Templates belong to
+the current profile and are stored with it. Use the 'templates'
+command to list them and 'delete-template' to remove them. Variables
+in templates are expanded when the call is made, not when saved.
+Existing Postman collections can be brought in as templates using
+the 'import' command.
+
+ASSERTIONS
+
+Checks on the response can be added to the template in the views
+using the 'assert' command, e.g. 'assert status == 200'. They are
+saved along with the template and checked after every call, with
+the results shown above the response. Saved templates can be run
+outside of the TUI as smoke tests using 'call-buddy run NAME',
+which outputs TAP or JUnit results and exits with 1 if any
+assertion failed. See 'call-buddy run -h'.
+
+CAPTURES
+
+Values from a response can be stored in the 'User' environment for
+later calls using the 'capture' command, e.g. after logging in,
+'capture User.TOKEN = json:$.access_token' stores the token so an
+'Authorization: Bearer {{User.TOKEN}}' header can use it. Captures
+are saved along with the template like assertions and are also
+applied by 'call-buddy run', so templates can be chained.
+
 PROFILES
 
 If you wish to separate history and environment variables between
@@ -367,9 +1431,54 @@ COMMANDS
 - put URL       Issues a http PUT request
 - post URL      Issues a http POST request
 - head URL      Issues a http HEAD request
+- patch URL     Issues a http PATCH request
+- options URL   Issues a http OPTIONS request
+- call M URL    Issues a http request with any method
+- stream [M] URL
+                Outputs the events of a response as they arrive
+- ws URL        Opens a WebSocket, 'ws close' closes it
+- grpc URL      Issues a gRPC call with the JSON request body
+- grpc list URL Outputs the services and methods of a gRPC server
+- send [-b] [TEXT]
+                Sends TEXT or the request body over the WebSocket
+- graphql URL   Issues a GraphQL query with the variables view
+- graphql schema URL [TYPE]
+                Outputs the types of a GraphQL schema
 - header K=V    Appends a KEY=VALUE pair to the header view
 - history       Enters the history view
+- pretty, raw   Shows responses indented and colored, or as is
+- hex           Outputs a hex dump of the response body
+- jq [-r] EXPR  Outputs the parts of a JSON response picked by EXPR
+- save NAME     Saves the views as a named template
+- load NAME     Loads a named template into the views
+- templates     Outputs the saved templates
+- delete-template NAME...
+                Deletes the given templates
+- assert [EXPR] Outputs or adds assertions on the response
+- capture [User.K = SOURCE]
+                Outputs or adds captures of response values
+- auth [TYPE ARGS|off]
+                Outputs or sets how calls authenticate
+- oauth2 [GRANT ARGS|token|off]
+                Outputs or sets how OAuth2 tokens are got
+- connect-to [HOST[:PORT]|off]
+                Connects calls to HOST instead of the URL's host
+- protocol [VERSION|off]
+                Outputs or sets the template's HTTP version
+- cookies [clear [DOMAIN]|set URL NAME=VALUE]
+                Outputs, clears or sets the profile's cookies
+- redact [header NAME|pattern REGEX|remove RULE|reset|off]
+                Outputs or changes what the history hides
+- import postman FILE
+                Imports a Postman collection or environment
+- curl [history [N]]
+                Outputs the views or a call as a curl command
+- curl ARGS...  Loads a curl command into the views
 - env [N][K=V]  Outputs one or more named envs or stores a key
+- secret [K=V]  Outputs the secret variables or stores one encrypted
+- unlock PASSPHRASE|age FILE|off
+                Decrypts or locks the secret variables
+- set [K=V]     Outputs or changes the profile's HTTP settings
 - ! SHELL       Executes the shell command and outputs it
 - > FILE        (Over)writes the output to a file
 - < FILE        (Over)writes the response body with a file
@@ -389,6 +1498,8 @@ KEYBINDINGS
 - Ctrl-A        Go to start of line (UNIX only).
 - Ctrl-W        Clear a word backwards (UNIX only).
 - Ctrl-U        Clear a line backwards (UNIX only).
+- Ctrl-C        Cancel the call being made, or quit when there
+                isn't one (UNIX only).
 
 CREDITS
 
@@ -402,25 +1513,55 @@ END
 Thanks for using call-buddy! :^)`
 
 var helpSynopsises map[string]string = map[string]string{
-	"exit":     "exit",
-	"!":        "! SHELL-COMMAND",
-	">":        "> FILE",
-	"<":        "< FILE",
-	">>":       ">> FILE",
-	"env":      "env [KEY=VALUE]\nenv [NAME]",
-	"header":   "header KEY=VALUE",
-	"help":     "help [COMMAND]",
-	"history":  "history",
-	"profiles": "profiles",
-	"create":   "create NAME",
-	"remove":   "remove NAME",
-	"use":      "use NAME",
-	"rename":   "rename OLD-NAME NEW-NAME",
-	"post":     "post URL",
-	"get":      "get URL",
-	"put":      "put URL",
-	"delete":   "delete URL",
-	"head":     "head URL",
+	"exit":            "exit",
+	"!":               "! SHELL-COMMAND",
+	">":               "> FILE",
+	"<":               "< FILE",
+	">>":              ">> FILE",
+	"env":             "env [KEY=VALUE]\nenv [NAME]",
+	"secret":          "secret [KEY=VALUE...]",
+	"unlock":          "unlock PASSPHRASE\nunlock age KEY-FILE\nunlock off",
+	"set":             "set [KEY=VALUE...]",
+	"header":          "header KEY=VALUE",
+	"help":            "help [COMMAND]",
+	"history":         "history",
+	"pretty":          "pretty",
+	"raw":             "raw",
+	"hex":             "hex",
+	"jq":              "jq [-r] EXPRESSION\njq [-r] $.JSON.PATH",
+	"filter":          "filter [-r] EXPRESSION",
+	"save":            "save NAME",
+	"load":            "load NAME",
+	"templates":       "templates",
+	"delete-template": "delete-template NAME...",
+	"assert":          "assert\nassert KIND [TARGET] OPERATOR VALUE\nassert remove N\nassert clear",
+	"capture":         "capture\ncapture [User.]NAME = SOURCE[:TARGET]\ncapture remove N\ncapture clear",
+	"auth":            "auth\nauth basic|digest USER PASSWORD\nauth bearer TOKEN\nauth oauth2\nauth aws ACCESS-KEY SECRET-KEY REGION SERVICE [SESSION-TOKEN]\nauth off",
+	"oauth2":          "oauth2\noauth2 client-credentials TOKEN-URL CLIENT-ID CLIENT-SECRET [SCOPE]\noauth2 password TOKEN-URL CLIENT-ID CLIENT-SECRET USER PASSWORD [SCOPE]\noauth2 refresh-token TOKEN-URL CLIENT-ID CLIENT-SECRET REFRESH-TOKEN [SCOPE]\noauth2 token\noauth2 off",
+	"connect-to":      "connect-to\nconnect-to HOST[:PORT]\nconnect-to off",
+	"protocol":        "protocol\nprotocol 1.1|2|h2c|3\nprotocol off",
+	"cookies":         "cookies\ncookies clear [DOMAIN]\ncookies set URL NAME=VALUE[; ATTRIBUTES]",
+	"redact":          "redact\nredact header NAME...\nredact pattern REGEX\nredact remove HEADER|REGEX\nredact reset\nredact off",
+	"import":          "import postman FILE",
+	"curl":            "curl\ncurl history [N]\ncurl [OPTIONS...] URL",
+	"profiles":        "profiles",
+	"create":          "create NAME",
+	"remove":          "remove NAME",
+	"use":             "use NAME",
+	"rename":          "rename OLD-NAME NEW-NAME",
+	"post":            "post URL",
+	"get":             "get URL",
+	"put":             "put URL",
+	"delete":          "delete URL",
+	"head":            "head URL",
+	"patch":           "patch URL",
+	"options":         "options URL",
+	"call":            "call METHOD URL",
+	"stream":          "stream [METHOD] URL",
+	"ws":              "ws URL\nws close",
+	"send":            "send [-b] [TEXT]",
+	"grpc":            "grpc URL\ngrpc list URL\ngrpc describe URL",
+	"graphql":         "graphql URL\ngraphql on|off\ngraphql schema URL [TYPE]",
 }
 
 // helpDescriptions A mapping between commands and their help descriptions.
@@ -462,16 +1603,103 @@ Assuming a UNIX system.
                         the last 30 lines and filters those lines
                         again to those that contain 'KEY'`,
 	">": `
-Saves the call response to the given file (and overrides the contents).`,
+Saves the call response to the given file (and overrides the contents).
+When the response body view shows a call, the exact bytes of the
+response body are saved, even if it's shown pretty or as a hex dump.
+Otherwise, what is in the view is saved.`,
 	">>": `
-Saves and appends the call response to the given file.`,
+Saves and appends the call response to the given file, see '>'.`,
 	"<": `
 Loads the given file into the call response (and overrides the contents).`,
 	"env": `
 Displays the environment or stores the given key value pair in the
 'User' environment. Use {{User.KEY}} to extract the value.`,
+	"secret": `
+Stores the given key value pairs in the 'User' environment encrypted
+with age, so API keys and passwords aren't written to the profile's
+state file, or copied to remote hosts by tcb, as plain text. They are
+used like other variables, e.g. {{User.API_KEY}}, but are only
+decrypted in memory when a call is made. Their values are masked in
+the environment and replaced by the variables in the history. Without
+arguments, the names of the secret variables are output. Storing a
+variable with 'env' replaces the secret of the same name.
+
+The secrets are encrypted with the passphrase or age key given to
+'unlock', which must be used before storing or using them. It can
+also be given by the CALL_BUDDY_PASSPHRASE or CALL_BUDDY_AGE_KEY
+variables of the OS environment, which aren't in the 'Var' one.
+
+EXAMPLES
+
+unlock age ~/.config/call-buddy/key.txt
+secret API_KEY=sk_live_51H8 DB_PASSWORD=hunter2
+header Authorization=Bearer {{User.API_KEY}}`,
+	"unlock": `
+Decrypts the secret variables of the current profile with the
+passphrase or the age key file, like one made by age-keygen, and
+keeps the key in memory to encrypt new ones and to decrypt those of
+profiles used later. It fails if the key doesn't decrypt the secrets
+already stored. 'unlock off' forgets the key. See 'secret'.
+
+EXAMPLES
+
+unlock correct horse battery staple
+unlock age ~/.config/call-buddy/key.txt`,
 	"header": `
 Stores the given key value header in the request header view.`,
+	"set": `
+Outputs or changes how the current profile makes HTTP calls. The
+settings are stored with the profile. Without arguments, every
+setting is output. An empty VALUE resets a setting to its default.
+
+SETTINGS
+
+  timeout=DURATION    How long a whole call may take, e.g. 30s or
+                      2m. A plain number is in seconds. No limit by
+                      default.
+  redirects=on|off    Whether redirects are followed. When off, the
+                      redirect itself is the response. On by default.
+  max-redirects=N     How many redirects are followed. 10 by default,
+                      use redirects=off not to follow any.
+  proxy=URL           The HTTP proxy to use, e.g. localhost:3128. By
+                      default the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+                      environment variables are used.
+  insecure=on|off     Skips verifying the server's certificate. Off by
+                      default.
+  cacert=FILE         A PEM file of CA certificates to trust along with
+                      the system ones.
+  cert=FILE           A PEM client certificate for mutual TLS, needs
+                      key to be set too.
+  key=FILE            The PEM key of the client certificate.
+  max-body=SIZE       Response bodies larger than this, e.g. 512KB or
+                      1GB, are saved to a file instead of being kept in
+                      memory. At most their first 64 KiB is shown, and
+                      assertions, captures and jq on their body fail.
+                      '>' and '!' still use the whole body. 'none'
+                      keeps every body in memory. 16 MiB by default.
+  body-dir=DIR        The directory large bodies are saved to. The
+                      system's temporary directory by default. The
+                      files are kept until removed.
+  http=VERSION        The HTTP version calls are made with. 1.1 never
+                      uses HTTP/2. 2 only uses HTTP/2 over TLS and
+                      fails when the server doesn't support it. h2c
+                      also uses HTTP/2 without TLS for http:// URLs,
+                      which the server must support, and can't be used
+                      with a proxy. 3 uses HTTP/3 over QUIC for https://
+                      URLs, fails when the server doesn't support it and
+                      can't be used with a proxy. auto, the default,
+                      uses HTTP/2 when the server supports it over TLS.
+                      Templates can use another version, see 'protocol'.
+                      The version used is shown with the response and
+                      in the history.
+
+EXAMPLES
+
+set timeout=10s redirects=off
+set proxy=http://bastion:3128
+set cert=client.pem key=client.key
+set max-body=100MB body-dir=/var/tmp
+set http=h2c`,
 	"help": `
 Provides help on call-buddy and on specific commands.
 
@@ -479,6 +1707,328 @@ ALIASES
 	?, man`,
 	"history": `
 Enters the history view.`,
+	"pretty": `
+Shows responses with their headers sorted and JSON, XML and HTML
+bodies indented and colored, YAML bodies are only colored. The
+format is taken from the Content-Type header, or from what the body
+looks like when there is none. Bodies that can't be read in their
+format are shown as is. This is the default.
+
+Bodies that aren't text, such as images, protobuf or gzipped bodies,
+are shown as a hex dump of their start instead, see 'hex'.
+
+Saving the response using '>' or piping it using '!' uses the exact
+bytes of the response body, unless it has been edited in the view.`,
+	"raw": `
+Shows responses as they were received, see 'pretty'.`,
+	"hex": `
+Outputs a hex dump of the whole body of the response shown last,
+along with its size, its Content-Type and what it looks like going
+by its first bytes. Text bodies can be dumped too, e.g. to find
+stray control characters.`,
+	"jq": `
+Applies a jq-like filter to the JSON body of the response shown last
+and outputs the results, one JSON value each, without needing jq
+installed. With -r, strings are output without quotes. Expressions
+starting with $ are JSON paths as used by 'assert' instead. Object
+keys are output sorted.
+
+The following subset of jq is understood:
+
+  .                      The whole value
+  .a.b, ."a b", .["a b"] The value of a key, null if missing
+  .[0], .[-1]            The first and last element of an array
+  .[1:3], .[2:]          A slice of an array or string
+  .[]                    Every element of an array or object
+  ..                     The value and everything in it
+  f?                     Nothing instead of an error
+  f | g                  g applied to every result of f
+  f, g                   The results of f then those of g
+  [f]                    The results of f in an array
+  {a: f, "b c": g, d}    An object, d is short for d: .d
+  == != < <= > >= and or Comparisons
+  length, keys, first, last, type, not, tostring, empty
+  map(f), select(f), has(KEY)
+
+EXAMPLES
+
+jq .hits.hits[]._source.name
+jq -r .rows[].id
+jq .hits.hits[] | select(._source.age > 30) | {id: ._id}
+jq [.items[] | select(.status == "failed")] | length
+jq $.items[*].id
+
+ALIASES
+	filter`,
+	"filter": `
+See 'jq'.`,
+	"save": `
+Saves the method, url, request headers and request body in the views
+as a template with the given name in the current profile. Saving
+under an existing name replaces that template. A valid name can only
+contain letters, digits, '.', '-', '/' and underscores.`,
+	"load": `
+Loads the template with the given name into the method, request
+header and request body views.`,
+	"templates": `
+Lists the templates saved in the current profile.`,
+	"delete-template": `
+Deletes the templates with the given names from the current profile.`,
+	"assert": `
+Adds an assertion on the response to the template in the views. The
+assertions are checked after every call and the results are shown
+above the response. They are saved along with the template using
+the 'save' command. Without arguments, the assertions are listed;
+'remove N' removes the Nth one and 'clear' removes them all.
+
+ASSERTIONS
+
+  status == CODE          The status code
+  header NAME == VALUE    A response header equals the value
+  header NAME ~ REGEXP    A response header matches the regular
+                          expression
+  json PATH == VALUE      The value at the JSON path equals the
+                          value, compared as JSON so 1.0 equals 1
+  json PATH ~ REGEXP      The value at the JSON path matches the
+                          regular expression
+  body ~ REGEXP           The response body matches the regular
+                          expression
+  latency <= DURATION     The call took at most the duration
+
+JSON paths look like $.items[0].name, $['a key'] or $.items[-1].
+
+Saved templates can be run without the TUI, e.g. in CI, using
+'call-buddy run NAME'. NAME is a template or a folder of templates
+such as 'api' for 'api/users/get' and 'api/health'. The results are
+written in TAP or, using -format junit, as JUnit XML. The exit code
+is 1 if any call or assertion failed.
+
+EXAMPLES
+
+assert status == 201
+assert header Location ~ ^/users/[0-9]+$
+assert json $.user.name == "alice"
+assert latency <= 500ms`,
+	"capture": `
+Adds a capture to the template in the views. After every call, the
+value the capture takes from the response is stored in the 'User'
+environment under the given name, where the headers and body of
+later calls can use it as {{User.NAME}}. Variables whose capture
+fails are left as they were. Captures into secret variables stay
+encrypted, and fail while the secrets are locked, see 'secret'.
+Captures are saved along with the template using the 'save' command
+and are applied by 'call-buddy run' after each template, so a login
+template can capture the token the templates after it use. Without
+arguments, the captures are listed; 'remove N' removes the Nth one
+and 'clear' removes them all.
+
+SOURCES
+
+  json:PATH       The value at the JSON path, e.g. $.access_token.
+                  Strings are stored without quotes, anything else
+                  as JSON
+  header:NAME     The first value of the response header
+  status          The status code
+  body            The whole response body
+  body:REGEXP     The first group of the regular expression's first
+                  match in the body, or the whole match if it has no
+                  groups
+
+EXAMPLES
+
+capture User.TOKEN = json:$.access_token
+capture NEXT = header:Location
+capture CSRF = body:name="csrf" value="([^"]+)"`,
+	"auth": `
+Makes calls with the template in the views authenticate. The
+Authorization header is set once the other headers are expanded,
+replacing any in the request header view. Every argument is expanded
+like headers are, so secrets can be kept in variables rather than in
+the template, which the authentication is saved along with. Without
+arguments, it is output with the secrets that aren't in variables
+hidden; 'off' removes it.
+
+TYPES
+
+  basic USER PASSWORD   HTTP Basic authentication
+  bearer TOKEN          A bearer token
+  oauth2                The access token got as configured with the
+                        oauth2 command, which is renewed when it
+                        expires or the server answers 401
+  digest USER PASSWORD  HTTP Digest authentication, MD5 or SHA-256.
+                        The call is made again answering the server's
+                        challenge. Streams and WebSockets don't
+                        answer it.
+  aws ACCESS-KEY SECRET-KEY REGION SERVICE [SESSION-TOKEN]
+                        Signs calls using AWS Signature Version 4,
+                        e.g. for S3 (service s3) or OpenSearch
+                        (service es). The session token is needed
+                        for temporary credentials.
+
+gRPC calls send basic, bearer and oauth2 authentication as the
+authorization metadata. Digest and aws sign HTTP requests, so gRPC
+calls using them fail.
+
+EXAMPLES
+
+auth basic admin {{User.ADMIN_PASSWORD}}
+auth bearer {{User.TOKEN}}
+auth aws {{Var.AWS_ACCESS_KEY_ID}} {{Var.AWS_SECRET_ACCESS_KEY}} eu-west-1 s3`,
+	"oauth2": `
+Configures how the current profile gets OAuth2 access tokens for the
+templates using 'auth oauth2'. A token is requested before the first
+such call and cached in User.OAUTH2_ACCESS_TOKEN, along with
+User.OAUTH2_REFRESH_TOKEN and User.OAUTH2_EXPIRES when the identity
+provider sends them. It's renewed before a call once it has expired,
+and the call is made again with a new one if the server answers 401.
+Renewing uses the refresh token when there is one, and the grant
+otherwise. 'token' gets a new token right away.
+
+While secret variables are unlocked, see 'unlock', the tokens are
+stored encrypted like secrets. Otherwise they are only kept until
+call-buddy exits, so they are never saved in plaintext.
+
+The client authenticates with HTTP Basic authentication, a
+CLIENT-SECRET of - is for public clients, which only send their ID.
+Every argument is expanded like headers are, so secrets can be kept in
+variables. Without arguments, the configuration is output with the
+secrets that aren't in variables hidden; 'off' removes it along with
+the cached tokens.
+
+GRANTS
+
+  client-credentials TOKEN-URL CLIENT-ID CLIENT-SECRET [SCOPE]
+  password TOKEN-URL CLIENT-ID CLIENT-SECRET USER PASSWORD [SCOPE]
+  refresh-token TOKEN-URL CLIENT-ID CLIENT-SECRET REFRESH-TOKEN [SCOPE]
+
+EXAMPLES
+
+oauth2 client-credentials https://auth.example.com/oauth/token api {{User.CLIENT_SECRET}} read write
+oauth2 password https://auth.example.com/token cli - alice {{User.PASSWORD}}
+oauth2 token`,
+	"connect-to": `
+Makes calls with the template in the views connect to HOST instead of
+the host of their URL, like curl's --connect-to. The Host header and
+the TLS server name are still the URL's, so a pod or a node behind a
+load balancer can be called with the name it expects. The port is the
+URL's when none is given, and variables are expanded like in URLs.
+Only connections to the URL's own host are affected, redirects to
+other hosts connect to them as usual. The address is saved along with
+the template. Without arguments, it is output; 'off' removes it.
+
+Calls can also be made over Unix domain sockets using URLs like
+unix:///var/run/docker.sock:/containers/json, where the path of the
+call follows the socket after a colon.
+
+EXAMPLES
+
+connect-to 10.42.0.17:8443
+connect-to {{User.POD_IP}}
+get unix:///var/run/docker.sock:/containers/json?all=1`,
+	"protocol": `
+Makes calls with the template in the views use the given HTTP version
+instead of the profile's 'http' setting, so the same service can be
+called over each version in turn. The versions are those of the 'set'
+command. The version is saved along with the template. Without
+arguments, it is output; 'off' uses the profile's version again.
+
+EXAMPLES
+
+protocol 3
+protocol 1.1
+protocol off`,
+	"cookies": `
+Outputs the cookies of the current profile, one per line like a
+Set-Cookie header would set it. Cookies servers set are kept in the
+profile and sent with later calls to their domain and path like a
+browser would, so apps using session cookies can be called. Which
+cookies a call sent is shown with its response, and they are part of
+curl command lines made from the history. 'cookies clear' removes every
+cookie, or those of a domain and its subdomains. 'cookies set' keeps
+a cookie as if the server of the URL had set it, where attributes like
+Path, Domain, Max-Age and Secure can follow the value. The URL and the
+cookie are expanded like headers are. Runs start with the profile's
+cookies but don't change them.
+
+EXAMPLES
+
+cookies set https://app.example.com session={{User.SESSION}}
+cookies set https://app.example.com theme=dark; Path=/ui; Max-Age=3600
+cookies clear example.com`,
+	"redact": `
+Outputs or changes what is redacted from the history of the current
+profile, so tokens don't end up in state files checked into git or
+copied by tcb. Redacted values are replaced by [REDACTED] when the
+history is saved, shown in the history view or exported with 'curl
+history'. The call just made is shown whole, but calls loaded from
+the history have their redacted values replaced. The values of secret
+variables are always replaced by the variables, see 'secret'.
+
+By default the Authorization, Proxy-Authorization, Cookie, Set-Cookie
+and X-Api-Key headers of requests and responses are redacted, which
+also hides the cookies the cookie jar sent. 'header' adds headers.
+'pattern' adds a regular expression redacted in URLs, header values
+and bodies; when it has a group, only what the group matches is
+redacted. 'remove' removes a header or a pattern, 'reset' goes back to
+the defaults and 'off' redacts nothing.
+
+EXAMPLES
+
+redact header X-Session-Token
+redact pattern access_token=([^&]+)
+redact pattern "password":\s*"([^"]*)"
+redact remove Cookie`,
+	"curl": `
+Outputs a curl command line that makes the same call, with every
+variable expanded and every argument quoted for a POSIX shell. It
+can be pasted into a terminal or saved to a file using '>'.
+
+Without arguments, the call in the method, request header and
+request body views is used. With 'history', the Nth call in the
+history view is used, counting from 1 at the top. If N is not given,
+the most recent call is used.
+
+With a URL, the curl command line is loaded into the method, request
+header and request body views instead, e.g. one copied using "Copy
+as cURL" in a browser's developer tools. The template's name,
+assertions, captures, authentication and connect-to address are
+kept. Single quotes, double quotes, $'...' quotes and backslashes are
+handled like bash would. The following options are understood:
+
+  -X, --request METHOD        The method
+  -H, --header 'KEY: VALUE'   A request header
+  -d, --data, --data-binary,  The request body, POST is used unless
+  --data-raw, --data-urlencode  given otherwise. Multiple are joined
+                              using '&'. @FILE reads the file except
+                              for --data-raw
+  --json DATA                 A JSON body, also setting the
+                              Content-Type and Accept headers
+  -G, --get                   Appends the data to the URL instead
+  -u, --user USER:PASSWORD    Basic authorization header
+  --oauth2-bearer TOKEN       Bearer authorization header
+  -A, --user-agent, -e,       The User-Agent, Referer and Cookie
+  --referer, -b, --cookie     headers
+  -I, --head                  The HEAD method
+
+Other options such as --compressed are ignored and listed, along
+with the value of those that take one. The -k
+option is ignored since certificate verification is a setting of
+the profile, see the 'set' command.`,
+	"import": `
+Imports a Postman v2.1 collection or a Postman environment file into
+the current profile.
+
+Every request in a collection is saved as a template named after
+the collection, its folders and the request, e.g. the 'Get user'
+request in the 'users' folder of the 'My API' collection is saved
+as 'My_API/users/Get_user'. Existing templates with the same name
+are replaced. Postman {{NAME}} variables are rewritten as
+{{User.NAME}}.
+
+Collection variables and enabled environment values are stored in
+the 'User' environment. Spaces, dots, dashes and other characters
+variable names can't have are replaced by _, both in the variables
+and in the templates, e.g. {{base url}} becomes {{User.base_url}}.`,
 	"profiles": `
 Lists the available profiles.`,
 	"create": `
@@ -510,6 +2060,114 @@ view.`,
 Issues a http DELETE request.`,
 	"head": `
 Issues a http HEAD request.`,
+	"patch": `
+Issues a http PATCH request with the request headers and body in the
+view.`,
+	"options": `
+Issues a http OPTIONS request, e.g. to see how a server answers a
+CORS preflight request when given Origin and
+Access-Control-Request-Method headers.`,
+	"call": `
+Issues a http request with the given method and the request headers
+and body in the view. Besides the methods above, TRACE and CONNECT
+as well as custom methods such as WebDAV's PROPFIND can be used. The
+standard methods are case insensitive and sent in upper case, custom
+methods are case sensitive and sent as given.
+
+EXAMPLES
+
+call PROPFIND http://localhost/dav/   A WebDAV directory listing
+call trace http://localhost/          A TRACE request`,
+	"stream": `
+Issues a http request, GET unless another method is given, and keeps
+the connection open, appending the response to the response body
+view as it arrives along with the time each part arrived at and how
+long after the start that was. Server-Sent Events (text/event-stream)
+are shown one event at a time with their event type and id, any
+other response such as NDJSON or chunked output one line at a time.
+The stream goes on until the server ends it or Ctrl-C cancels it.
+The call is then added to the history with the first 1 MiB of the
+stream as its body. The timeout set using 'set' doesn't apply.
+
+EXAMPLES
+
+stream http://localhost:8080/events
+stream http://localhost:8001/api/v1/pods?watch=true
+stream post http://localhost/v1/completions`,
+	"ws": `
+Opens a WebSocket to the URL, which may start with ws://, wss://,
+http:// or https://, with the headers in the request header view.
+Variables in the URL and headers are expanded like for calls, and
+the proxy and TLS settings of 'set' are used. Frames are sent using
+'send' and the frames sent and received are appended to the response
+body view in order, each with the time it was sent or received at.
+Sent frames start with > and received ones with <. Binary frames are
+shown as hex dumps.
+
+'ws close' or Ctrl-C closes the WebSocket. It is then added to the
+history with the log of its frames as the body. Only one WebSocket
+can be open at a time.
+
+EXAMPLES
+
+ws ws://localhost:8080/socket
+ws https://example.com/api/live`,
+	"send": `
+Sends TEXT, or the request body view when there is no TEXT, as a text
+frame over the WebSocket opened using 'ws'. Variables in it are
+expanded like in a request body. With -b, the text is the hex of the
+bytes to send in a binary frame, spaces are ignored.
+
+EXAMPLES
+
+send {"type": "subscribe", "channel": "{{User.CHANNEL}}"}
+send -b 00 01 ff`,
+	"grpc": `
+Issues a unary gRPC call to the method in the URL, which looks like
+grpc://HOST:PORT/package.Service/Method, or grpcs:// for TLS. The
+grpc:// can be left out. The request body view holds the request
+message as JSON and the request headers are sent as metadata.
+Variables are expanded in all of them like for other calls. The
+response message is shown as JSON, or the status when the call
+failed, and the response metadata and trailers as headers. The
+status code is the HTTP one matching the gRPC status, e.g. 404 for
+NOT_FOUND, and the gRPC code is in the Grpc-Status header, so
+assertions and captures work as for other calls. The call is added
+to the history and can be saved as a template. Any method with a
+grpc:// URL is a gRPC call.
+
+The server must support gRPC server reflection, which is used to
+find the messages of the method. 'grpc list' outputs the services
+and methods of a server and 'grpc describe' outputs the fields of
+the messages a method takes and returns. Streaming methods can't
+be called.
+
+EXAMPLES
+
+grpc list localhost:50051
+grpc describe localhost:50051/grpc.health.v1.Health/Check
+grpc localhost:50051/grpc.health.v1.Health/Check`,
+	"graphql": `
+Posts the GraphQL query in the request body view to the URL. A
+GraphQL Variables view is shown below the query, which is sent along
+with it when it holds a JSON object. Variables in the query, the
+GraphQL variables and the headers are expanded like for other calls.
+Any errors in the response are listed above it. The query and its
+variables are saved with a template and loaded again with it.
+
+'graphql on' and 'graphql off' show and hide the GraphQL variables
+view. Other calls send the request body as it is.
+
+'graphql schema' uses the introspection of the server to output the
+query and mutation types of its schema with their fields, and a list
+of the other types. With TYPE, the fields of that type are output
+instead.
+
+EXAMPLES
+
+graphql schema https://api.example.com/graphql
+graphql schema https://api.example.com/graphql User
+graphql https://api.example.com/graphql`,
 }
 
 // helpMessagesOrder The order to display the help messages in since go
@@ -523,9 +2181,38 @@ var helpMessagesOrder []string = []string{
 	"put",
 	"delete",
 	"head",
+	"patch",
+	"options",
+	"call",
+	"stream",
+	"ws",
+	"send",
+	"grpc",
+	"graphql",
 	"header",
 	"history",
+	"pretty",
+	"raw",
+	"hex",
+	"jq",
+	"save",
+	"load",
+	"templates",
+	"delete-template",
+	"assert",
+	"capture",
+	"auth",
+	"oauth2",
+	"connect-to",
+	"protocol",
+	"cookies",
+	"redact",
+	"import",
+	"curl",
 	"env",
+	"secret",
+	"unlock",
+	"set",
 	"!",
 	">",
 	">>",
@@ -583,31 +2270,32 @@ func lookupShell() (shellArgv []string) {
 	return
 }
 
-func bang(argv []string, input string) string {
+func bang(argv []string, input io.Reader) string {
 	shellArgv := lookupShell()
 	shellArgv = append(shellArgv, argv[1:]...)
 
 	cmd := exec.Command(shellArgv[0], shellArgv[1:]...)
-	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdin = input
 
 	// Grab out stderr and stdout
-	// FIXME DG: We shouldn't trust stdout/stderr to be a valid string,
-	//           but rather a byte stream so string(output) might cause
-	//           problems...
 	var outputBuf bytes.Buffer
 	cmd.Stdout = &outputBuf
 	cmd.Stderr = &outputBuf
 	err := cmd.Run()
 
+	output := outputBuf.String()
+	// e.g. '! gunzip' of a body that isn't gzipped after all
+	if t.IsBinaryBody("", outputBuf.Bytes()) {
+		output = t.HexDump(outputBuf.Bytes(), "", t.HexDumpLimit)
+	}
 	if err != nil {
-		return outputBuf.String() + "\n" + err.Error()
+		return output + "\n" + err.Error()
 	}
-	return outputBuf.String()
+	return output
 }
 
 func evalCmdLine(g *gocui.Gui) (err error) {
 	var ourErr error // Returning an error causes panic! wtf
-	var historicalCall t.HistoricalCall
 	var appendToFile bool
 	// FIXME: Deal with errors!
 	cmdLineView, _ := g.View(CMD_LINE_VIEW)
@@ -633,7 +2321,13 @@ func evalCmdLine(g *gocui.Gui) (err error) {
 			break
 		}
 		rest := strings.Join(argv[1:], " ")
-		message := bang([]string{command, rest}, rspBodyView.Buffer())
+		contents, ourErr := responseViewContents(rspBodyView)
+		if ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+			break
+		}
+		message := bang([]string{command, rest}, contents)
+		contents.Close()
 		rspBodyView, _ := g.View(RSP_BODY_VIEW)
 		updateResponseBodyView(rspBodyView, message)
 
@@ -654,16 +2348,22 @@ func evalCmdLine(g *gocui.Gui) (err error) {
 		loadResponseFromFile(rqtBodyView, argv[1])
 
 	case ">":
-		appendToFile = false
 		fallthrough
 	case ">>":
-		appendToFile = true
+		appendToFile = command == ">>"
 		if len(argv) < 2 {
 			message := help([]string{"help", command})
 			updateResponseBodyView(rspBodyView, message)
 			break
 		}
-		saveResponseToFile(rspBodyView.Buffer(), argv[1], appendToFile)
+		contents, ourErr := responseViewContents(rspBodyView)
+		if ourErr == nil {
+			ourErr = saveResponseToFile(contents, argv[1], appendToFile)
+			contents.Close()
+		}
+		if ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		}
 
 	case "env":
 		if len(argv) < 2 {
@@ -679,84 +2379,270 @@ func evalCmdLine(g *gocui.Gui) (err error) {
 		}
 		updateCommandLineView(cmdLineView, "")
 
-	case "create":
-		if len(argv) < 2 {
-			message := help([]string{"help", command})
+	case "create":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		_, ourErr := profiles.New(stateDir, argv[1])
+		if ourErr == nil {
+			ourErr = unlockCurrentProfile()
+		}
+		if ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, "Profile "+argv[1]+" has been created and is now active.")
+		}
+
+	case "use":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		_, ourErr := profiles.Use(argv[1])
+		if ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else if ourErr = unlockCurrentProfile(); ourErr != nil {
+			updateResponseBodyView(rspBodyView, argv[1]+" is now the current profile, its secret variables are locked: "+ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, argv[1]+" is now the current profile.")
+		}
+
+	case "remove":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+
+		var tempComplete string
+		for _, selected := range argv[1:] {
+			ourErr := profiles.Remove(stateDir, selected)
+			if ourErr != nil {
+				tempComplete += "Failed to remove " + selected + ": " + ourErr.Error() + "\n"
+			} else {
+				tempComplete += "Successfully Removed " + selected + "\n"
+			}
+		}
+		updateResponseBodyView(rspBodyView, tempComplete)
+
+	case "rename":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+
+		ourErr := profiles.Rename(argv[1], argv[2])
+		if ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, argv[1]+" is now named "+argv[2])
+		}
+
+	case "profiles":
+		if len(argv) >= 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+
+		var curList = profiles.List()
+		var tempList string
+		for i, selected := range curList {
+			if i == 0 {
+				tempList += selected.Name + " <-- Current\n"
+			} else {
+				tempList += selected.Name + "\n"
+			}
+		}
+		updateResponseBodyView(rspBodyView, tempList)
+
+	case "history":
+		enterHistoryView(g)
+
+	case "save":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		if ourErr := saveTemplate(g, argv[1]); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, "Template "+argv[1]+" has been saved.")
+		}
+
+	case "load":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		if ourErr := loadTemplate(g, argv[1]); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, "Template "+argv[1]+" has been loaded.")
+		}
+
+	case "templates":
+		updateResponseBodyView(rspBodyView, listTemplates())
+
+	case "pretty":
+		setPrettyResponses(rspBodyView, true)
+
+	case "hex":
+		if call, ourErr := shownOrLatestCall(); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, call.Response.TruncatedDescription()+t.HexDump(call.Response.Body, call.Response.Header.Get("Content-Type"), 0))
+		}
+
+	case "filter":
+		fallthrough
+	case "jq":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		if message, ourErr := filterResponse(argv, rawCommand); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
+		}
+
+	case "raw":
+		setPrettyResponses(rspBodyView, false)
+
+	case "assert":
+		if message, ourErr := assertCommand(argv, rawCommand); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
+		}
+
+	case "capture":
+		if message, ourErr := captureCommand(argv, rawCommand); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
+		}
+
+	case "auth":
+		if message, ourErr := authCommand(argv); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
+		}
+
+	case "oauth2":
+		if message, ourErr := oauth2Command(argv); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
+		}
+
+	case "connect-to":
+		if message, ourErr := connectToCommand(argv); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
+		}
+
+	case "protocol":
+		if message, ourErr := protocolCommand(argv); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
+		}
+
+	case "secret":
+		if message, ourErr := secretCommand(argv); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
+		}
+		updateCommandLineView(cmdLineView, "")
+
+	case "unlock":
+		if message, ourErr := unlockCommand(argv); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
 			updateResponseBodyView(rspBodyView, message)
-			break
 		}
-		_, ourErr := profiles.New(stateDir, argv[1])
-		if ourErr != nil {
+		updateCommandLineView(cmdLineView, "")
+
+	case "redact":
+		if message, ourErr := redactCommand(argv, rawCommand); ourErr != nil {
 			updateResponseBodyView(rspBodyView, ourErr.Error())
 		} else {
-			updateResponseBodyView(rspBodyView, "Profile "+argv[1]+" has been created and is now active.")
+			updateResponseBodyView(rspBodyView, message)
 		}
 
-	case "use":
-		if len(argv) < 2 {
-			message := help([]string{"help", command})
+	case "cookies":
+		if message, ourErr := cookiesCommand(argv); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
 			updateResponseBodyView(rspBodyView, message)
-			break
 		}
-		_, ourErr := profiles.Use(argv[1])
+
+	case "curl":
+		var message string
+		if len(argv) >= 2 && argv[1] != "history" {
+			message, ourErr = loadCurlCommand(g, rawCommand)
+		} else {
+			message, ourErr = curlCommand(g, argv)
+		}
 		if ourErr != nil {
 			updateResponseBodyView(rspBodyView, ourErr.Error())
 		} else {
-			updateResponseBodyView(rspBodyView, argv[1]+" is now the current profile.")
+			updateResponseBodyView(rspBodyView, message)
 		}
 
-	case "remove":
+	case "set":
 		if len(argv) < 2 {
-			message := help([]string{"help", command})
-			updateResponseBodyView(rspBodyView, message)
+			updateResponseBodyView(rspBodyView, profiles.CurrentState().ClientConfig.String())
 			break
 		}
-
-		var tempComplete string
-		for _, selected := range argv[1:] {
-			ourErr := profiles.Remove(stateDir, selected)
-			if ourErr != nil {
-				tempComplete += "Failed to remove " + selected + ": " + ourErr.Error() + "\n"
-			} else {
-				tempComplete += "Successfully Removed " + selected + "\n"
-			}
+		if message, ourErr := setClientConfig(argv[1:]); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		} else {
+			updateResponseBodyView(rspBodyView, message)
 		}
-		updateResponseBodyView(rspBodyView, tempComplete)
 
-	case "rename":
-		if len(argv) < 2 {
+	case "import":
+		if len(argv) < 3 || strings.ToLower(argv[1]) != "postman" {
 			message := help([]string{"help", command})
 			updateResponseBodyView(rspBodyView, message)
 			break
 		}
-
-		ourErr := profiles.Rename(argv[1], argv[2])
-		if ourErr != nil {
+		if message, ourErr := importPostman(argv[2]); ourErr != nil {
 			updateResponseBodyView(rspBodyView, ourErr.Error())
 		} else {
-			updateResponseBodyView(rspBodyView, argv[1]+" is now named "+argv[2])
+			updateResponseBodyView(rspBodyView, message)
 		}
 
-	case "profiles":
-		if len(argv) >= 2 {
+	case "delete-template":
+		if len(argv) < 2 {
 			message := help([]string{"help", command})
 			updateResponseBodyView(rspBodyView, message)
 			break
 		}
 
-		var curList = profiles.List()
-		var tempList string
-		for i, selected := range curList {
-			if i == 0 {
-				tempList += selected.Name + " <-- Current\n"
+		var tempComplete string
+		for _, selected := range argv[1:] {
+			ourErr := profiles.CurrentState().Templates().Remove(selected)
+			if ourErr != nil {
+				tempComplete += "Failed to delete " + selected + ": " + ourErr.Error() + "\n"
 			} else {
-				tempList += selected.Name + "\n"
+				tempComplete += "Successfully deleted " + selected + "\n"
 			}
 		}
-		updateResponseBodyView(rspBodyView, tempList)
-
-	case "history":
-		enterHistoryView(g)
+		profiles.Save(stateDir)
+		updateResponseBodyView(rspBodyView, tempComplete)
 
 	case "q":
 		fallthrough
@@ -783,20 +2669,136 @@ func evalCmdLine(g *gocui.Gui) (err error) {
 	case "delete":
 		fallthrough
 	case "head":
+		fallthrough
+	case "patch":
+		fallthrough
+	case "options":
+		fallthrough
+	case "stream":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		method, url := "get", argv[1]
+		if len(argv) > 2 {
+			method, url = argv[1], argv[2]
+		}
+		theTemplate, client, ourErr := callTemplate(method, url, requestBodyBuffer, requestHeadersBuffer)
+		if ourErr == nil {
+			ourErr = startStream(g, theTemplate, client)
+		}
+		if ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		}
+
+	case "ws":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		if argv[1] == "close" {
+			if !closeWebSocket() {
+				updateResponseBodyView(rspBodyView, "No WebSocket is open.")
+			}
+			break
+		}
+		theTemplate, client, ourErr := callTemplate("get", argv[1], "", requestHeadersBuffer)
+		if ourErr == nil {
+			ourErr = startWebSocket(g, theTemplate, client)
+		}
+		if ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		}
+
+	case "send":
+		binary := len(argv) > 1 && argv[1] == "-b"
+		text := strings.TrimSpace(rawCommand[len(command):])
+		if binary {
+			text = strings.TrimSpace(text[len("-b"):])
+		}
+		if text == "" {
+			text = requestBodyBuffer
+		}
+		if ourErr := sendWebSocketFrame(g, text, binary); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		}
+
+	case "grpc":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		if argv[1] == "list" || argv[1] == "describe" {
+			if len(argv) < 3 {
+				message := help([]string{"help", command})
+				updateResponseBodyView(rspBodyView, message)
+				break
+			}
+			if message, ourErr := describeGrpc(argv[2]); ourErr != nil {
+				updateResponseBodyView(rspBodyView, ourErr.Error())
+			} else {
+				updateResponseBodyView(rspBodyView, message)
+			}
+			break
+		}
+		if ourErr = call(g, "post", grpcUrl(argv[1]), requestBodyBuffer, requestHeadersBuffer); ourErr != nil {
+			updateResponseBodyView(rspBodyView, ourErr.Error())
+		}
+
+	case "graphql":
+		if len(argv) < 2 {
+			message := help([]string{"help", command})
+			updateResponseBodyView(rspBodyView, message)
+			break
+		}
+		switch argv[1] {
+		case "on", "off":
+			graphqlMode = argv[1] == "on"
+		case "schema":
+			if len(argv) < 3 {
+				message := help([]string{"help", command})
+				updateResponseBodyView(rspBodyView, message)
+				break
+			}
+			typeName := ""
+			if len(argv) > 3 {
+				typeName = argv[3]
+			}
+			if message, ourErr := describeGraphQL(argv[2], typeName, requestHeadersBuffer); ourErr != nil {
+				updateResponseBodyView(rspBodyView, ourErr.Error())
+			} else {
+				updateResponseBodyView(rspBodyView, message)
+			}
+		default:
+			if ourErr = graphqlCall(g, argv[1], requestBodyBuffer, requestHeadersBuffer); ourErr != nil {
+				updateResponseBodyView(rspBodyView, ourErr.Error())
+			}
+		}
+
+	case "call":
 		// Assume is a call
+		method := command
+		if command == "call" {
+			if len(argv) < 3 {
+				message := help([]string{"help", command})
+				updateResponseBodyView(rspBodyView, message)
+				break
+			}
+			method, argv = argv[1], argv[1:]
+		}
 		if len(argv) < 2 {
 			updateResponseBodyView(rspBodyView, "Invalid Usage: <call-type> <url>")
 			break
 		}
 		url := argv[1]
-		if historicalCall, ourErr = call(command, url, requestBodyBuffer, requestHeadersBuffer); ourErr != nil {
+		if ourErr = call(g, method, url, requestBodyBuffer, requestHeadersBuffer); ourErr != nil {
 			// Print error out in place of response body
 			updateResponseBodyView(rspBodyView, ourErr.Error())
 			return
 		}
-		profiles.CurrentState().History.AddFinishedCall(historicalCall)
-		profiles.Save(stateDir)
-		updateViewsWithCall(g, historicalCall)
 
 	default:
 		updateResponseBodyView(rspBodyView, "No such command '"+command+"'. Use help.")
@@ -805,12 +2807,17 @@ func evalCmdLine(g *gocui.Gui) (err error) {
 }
 
 func updateViewsWithCall(g *gocui.Gui, call t.HistoricalCall) {
+	updateViewsWithCheckedCall(g, call, "")
+}
+
+// updateViewsWithCheckedCall Updates the views with the call and shows the
+// report on the template's assertions and captures above the response
+func updateViewsWithCheckedCall(g *gocui.Gui, call t.HistoricalCall, report string) {
 	// Print out new response
 
 	g.Update(func(gui *gocui.Gui) error {
 		rspBodyView, _ := gui.View(RSP_BODY_VIEW)
-		responseBody := call.Response.String()
-		updateResponseBodyView(rspBodyView, responseBody)
+		updateResponseBodyViewWithCall(rspBodyView, call, report)
 		return nil
 	})
 	g.Update(func(gui *gocui.Gui) error {
@@ -827,6 +2834,33 @@ func updateViewsWithCall(g *gocui.Gui, call t.HistoricalCall) {
 	})
 }
 
+func updateViewsWithTemplate(g *gocui.Gui, template t.RequestTemplate) {
+	g.Update(func(gui *gocui.Gui) error {
+		methodBodyView, _ := gui.View(MTD_BODY_VIEW)
+		updateMethodBodyView(methodBodyView, template.Url, template.Method)
+		return nil
+	})
+	g.Update(func(gui *gocui.Gui) error {
+		requestHeaderView, _ := gui.View(RQT_HEAD_VIEW)
+		updateRequestHeaderView(requestHeaderView, template.Headers)
+		return nil
+	})
+	g.Update(func(gui *gocui.Gui) error {
+		requestBodyView, _ := gui.View(RQT_BODY_VIEW)
+		updateRequestBodyView(requestBodyView, template.Body)
+		return nil
+	})
+	g.Update(func(gui *gocui.Gui) error {
+		// The layout shows or hides the variables view
+		graphqlMode = template.GraphQL
+		graphqlVariables = template.Variables
+		if variablesView, err := gui.View(GQL_VARS_VIEW); err == nil {
+			updateRequestBodyView(variablesView, template.Variables)
+		}
+		return nil
+	})
+}
+
 func setView(gui *gocui.Gui, name string, state ViewState) {
 	currView = state
 	currViewPtr, _ := gui.SetCurrentView(name)
@@ -850,7 +2884,15 @@ func switchNextView(g *gocui.Gui, v *gocui.View) error {
 		// -> request body
 		setView(g, RQT_BODY_VIEW, RQT_BODY)
 	case RQT_BODY:
-		// -> reqponse body
+		if graphqlMode {
+			// -> GraphQL variables
+			setView(g, GQL_VARS_VIEW, GQL_VARS)
+		} else {
+			// -> reqponse body
+			setView(g, RSP_BODY_VIEW, RSP_BODY)
+		}
+	case GQL_VARS:
+		// -> response body
 		setView(g, RSP_BODY_VIEW, RSP_BODY)
 	case RSP_BODY:
 		// -> command line
@@ -883,7 +2925,15 @@ func switchPrevView(g *gocui.Gui, v *gocui.View) error {
 		// -> reqponse body
 		setView(g, RQT_HEAD_VIEW, RQT_HEAD)
 	case RSP_BODY:
-		// -> command line
+		if graphqlMode {
+			// -> GraphQL variables
+			setView(g, GQL_VARS_VIEW, GQL_VARS)
+		} else {
+			// -> request body
+			setView(g, RQT_BODY_VIEW, RQT_BODY)
+		}
+	case GQL_VARS:
+		// -> request body
 		setView(g, RQT_BODY_VIEW, RQT_BODY)
 	case HIST_BODY:
 		exitHistoryView(g)
@@ -923,12 +2973,21 @@ func updateMethodBodyView(view *gocui.View, url string, method t.HttpMethod) {
 
 	fmt.Fprintln(view, url)
 	fmt.Fprintln(view)
-	for _, possibleMethod := range t.AllHttpMethods() {
+	// Two columns so every method fits
+	for i, possibleMethod := range t.AllHttpMethods() {
 		x := " "
 		if possibleMethod == method {
 			x = "x"
 		}
-		fmt.Fprintf(view, "[%s] %s\n", x, possibleMethod.String())
+		if i%2 == 0 {
+			fmt.Fprintf(view, "[%s] %-9s", x, possibleMethod.String())
+		} else {
+			fmt.Fprintf(view, "[%s] %s\n", x, possibleMethod.String())
+		}
+	}
+	fmt.Fprintln(view)
+	if method.IsCustom() && method != "" {
+		fmt.Fprintf(view, "[x] %s\n", method.String())
 	}
 }
 
@@ -951,20 +3010,230 @@ func updateResponseBodyView(view *gocui.View, body string) {
 	view.Clear()
 	fmt.Fprint(view, "")
 	fmt.Fprint(view, body)
+	shownResponse = responseViewState{}
+	view.Autoscroll = false
+}
+
+// responseViewState What the response body view shows when it shows a call
+type responseViewState struct {
+	// The call shown, nil when the view shows something else
+	call   *t.HistoricalCall
+	report string
+
+	// The text drawn in the view without colors, to tell when it's edited
+	drawn string
+
+	// The view shows a stream, the events of which are appended as they
+	// arrive
+	streaming bool
+}
+
+var shownResponse responseViewState
+
+// lastShownCall The call shown last in the response body view, even if the
+// view shows something else now
+var lastShownCall *t.HistoricalCall
+
+// prettyResponses Whether response bodies are shown indented and colored,
+// changed using the 'pretty' and 'raw' commands
+var prettyResponses = true
+
+var ansiEscapes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// updateResponseBodyViewWithCall Shows the call's response along with the
+// report on its assertions and captures
+func updateResponseBodyViewWithCall(view *gocui.View, call t.HistoricalCall, report string) {
+	text := formatResponse(call, report, prettyResponses)
+	view.Clear()
+	fmt.Fprint(view, text)
+	shownResponse = responseViewState{call: &call, report: report, drawn: ansiEscapes.ReplaceAllString(text, "")}
+	lastShownCall = &call
+}
+
+// formatResponse Returns the response headers and body, indented and colored
+// when pretty is set, after the report and the timing
+func formatResponse(call t.HistoricalCall, report string, pretty bool) (text string) {
+	if report != "" {
+		text += report + "\n"
+	}
+	// Calls made before timings were recorded have none
+	if call.Timing.Total > 0 {
+		text += "Timing: " + call.Timing.String() + "\n"
+	}
+	// So are calls made before protocols were
+	if call.Response.Proto != "" {
+		text += "Protocol: " + call.Response.Proto + "\n"
+	}
+	if len(call.Request.Cookies) > 0 {
+		text += "Cookies sent: " + strings.Join(call.Request.Cookies, "; ") + "\n"
+	}
+	if !pretty {
+		return text + call.Response.String()
+	}
+
+	if len(call.Response.Header) > 0 {
+		text += t.FormatHeaders(call.Response.Header, true) + "\n"
+	}
+	text += call.Response.TruncatedDescription()
+	if call.Response.IsBinary() {
+		return text + call.Response.BodyText()
+	}
+	// Bodies that aren't what their Content-Type says are shown as is
+	body, _ := t.FormatBody(call.Response.BodyFormat(), call.Response.Body, true)
+	return text + body
+}
+
+// sameViewText Returns whether the text of a view is the given text, since
+// views end every line with a newline
+func sameViewText(buffer, text string) bool {
+	normalize := func(text string) string {
+		return strings.TrimRight(strings.Replace(text, "\r", "", -1), "\n")
+	}
+	return normalize(buffer) == normalize(text)
+}
+
+// responseViewContents Returns what is in the response body view for saving
+// or piping. When it shows a call, that is the exact bytes of the response
+// body, unless it has been edited in the view. Bodies too large to keep in
+// memory are read from the file they were saved to.
+func responseViewContents(view *gocui.View) (io.ReadCloser, error) {
+	buffer := view.Buffer()
+	if shownResponse.call != nil && sameViewText(buffer, shownResponse.drawn) {
+		return shownResponse.call.Response.OpenBody()
+	}
+	return ioutil.NopCloser(strings.NewReader(buffer)), nil
+}
+
+// shownOrLatestCall Returns the call shown last in the response body view,
+// or the most recent call
+func shownOrLatestCall() (*t.HistoricalCall, error) {
+	if lastShownCall != nil {
+		return lastShownCall, nil
+	}
+	history := &profiles.CurrentState().History
+	if history.Size() == 0 {
+		return nil, errors.New("No response yet, make a call first.")
+	}
+	latest, _ := history.Get(history.Size() - 1)
+	return &latest, nil
+}
+
+// filterResponse Applies the jq-like filter in the command to the body of
+// the call shown last, or the most recent call
+func filterResponse(argv []string, rawCommand string) (string, error) {
+	expression := strings.TrimSpace(rawCommand[len(argv[0]):])
+	raw := false
+	if strings.HasPrefix(expression, "-r ") {
+		raw, expression = true, strings.TrimSpace(expression[len("-r "):])
+	}
+
+	call, err := shownOrLatestCall()
+	if err != nil {
+		return "", err
+	}
+	if call.Response.IsTruncated() {
+		return "", call.Response.TruncatedBodyError()
+	}
+	outputs, err := t.Filter(call.Response.Body, expression)
+	if err != nil {
+		return "", err
+	}
+	if len(outputs) == 0 {
+		return "No results", nil
+	}
+	return t.FilterOutput(outputs, raw, prettyResponses)
+}
+
+// setPrettyResponses Changes whether responses are shown pretty and redraws
+// the shown response unless it has been edited
+func setPrettyResponses(view *gocui.View, pretty bool) {
+	prettyResponses = pretty
+	if shownResponse.call != nil && sameViewText(view.Buffer(), shownResponse.drawn) {
+		updateResponseBodyViewWithCall(view, *shownResponse.call, shownResponse.report)
+		return
+	}
+	if pretty {
+		updateResponseBodyView(view, "Responses are now shown pretty.")
+	} else {
+		updateResponseBodyView(view, "Responses are now shown raw.")
+	}
+}
+
+// historyCall Returns the Nth call in the history, counting from 0, redacted
+// like it is when saved
+func historyCall(n int) (t.HistoricalCall, error) {
+	state := profiles.CurrentState()
+	call, err := state.History.Get(n)
+	if err != nil {
+		return call, err
+	}
+	return state.RedactionRules().Call(call), nil
 }
 
 func updateHistoryView(view *gocui.View) {
 	view.Clear()
-	histFormat := profiles.CurrentState().History.GetSimpleWholeHistoryReport()
+	state := profiles.CurrentState()
+	redacted := state.RedactionRules().History(state.History)
+	histFormat := redacted.GetSimpleWholeHistoryReport()
 	fmt.Fprint(view, histFormat)
 }
 
+// updateTitleView Shows the title followed by the given status, if any
+func updateTitleView(view *gocui.View, status string) {
+	view.Clear()
+	fmt.Fprint(view, "\u001b[32mTerminal "+"\u001b[29mCall "+"\u001b[29mBuddy")
+	if status != "" {
+		fmt.Fprint(view, " "+status)
+	}
+}
+
 func updateCommandLineView(view *gocui.View, command string) {
 	view.Clear()
 	fmt.Fprint(view, command)
 	view.SetCursor(len(command), 0)
 }
 
+// layoutRequestBody Lays out the request body view between y0 and y1, with the
+// GraphQL variables view below it in GraphQL mode
+func layoutRequestBody(g *gocui.Gui, x1, y0, y1 int) error {
+	requestBodyYEnd := y1
+	if graphqlMode {
+		requestBodyYEnd = y0 + (y1-y0)*2/3
+	}
+	v, err := g.SetView(RQT_BODY_VIEW, 0, y0, x1, requestBodyYEnd, 0)
+	if err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		v.Wrap = true
+		v.Autoscroll = false
+		v.Editable = true
+	}
+	v.Title = "Request Body"
+	if !graphqlMode {
+		if variablesView, err := g.View(GQL_VARS_VIEW); err == nil {
+			// Keep the variables for when the view is shown again
+			graphqlVariables = variablesView.Buffer()
+			return g.DeleteView(GQL_VARS_VIEW)
+		}
+		return nil
+	}
+	v.Title = "GraphQL Query"
+
+	// GraphQL Variables (e.g. {"id": 42})
+	if v, err := g.SetView(GQL_VARS_VIEW, 0, requestBodyYEnd+1, x1, y1, 0); err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		v.Title = "GraphQL Variables"
+		v.Wrap = true
+		v.Autoscroll = false
+		v.Editable = true
+		updateRequestBodyView(v, graphqlVariables)
+	}
+	return nil
+}
+
 //Setting the manager
 func layout(g *gocui.Gui) error {
 	maxX, maxY := g.Size()
@@ -979,7 +3248,7 @@ func layout(g *gocui.Gui) error {
 		if !gocui.IsUnknownView(err) {
 			return err
 		}
-		fmt.Fprint(v, "\u001b[32mTerminal "+"\u001b[29mCall "+"\u001b[29mBuddy")
+		updateTitleView(v, "")
 	}
 
 	// Response Body (e.g. html)
@@ -1019,14 +3288,8 @@ func layout(g *gocui.Gui) error {
 
 	// Request Body (e.g. json: {})
 	requestBodyYStart := requestHeadersYEnd + 1
-	if v, err := g.SetView(RQT_BODY_VIEW, 0, requestBodyYStart, verticalSplitX, horizontalSplitY, 0); err != nil {
-		if !gocui.IsUnknownView(err) {
-			return err
-		}
-		v.Title = "Request Body"
-		v.Wrap = true
-		v.Autoscroll = false
-		v.Editable = true
+	if err := layoutRequestBody(g, verticalSplitX, requestBodyYStart, horizontalSplitY); err != nil {
+		return err
 	}
 
 	// Command Line (e.g. :get http://httpbin.org/get)
@@ -1055,7 +3318,7 @@ func histLayout(g *gocui.Gui) error {
 		if !gocui.IsUnknownView(err) {
 			return err
 		}
-		fmt.Fprint(v, "\u001b[32mTerminal "+"\u001b[29mCall "+"\u001b[29mBuddy")
+		updateTitleView(v, "")
 	}
 
 	historyYEnd := titleYStart + 6
@@ -1107,14 +3370,8 @@ func histLayout(g *gocui.Gui) error {
 
 	// Request Body (e.g. json: {})
 	requestBodyYStart := requestHeadersYEnd + 1
-	if v, err := g.SetView(RQT_BODY_VIEW, 0, requestBodyYStart, verticalSplitX, horizontalSplitY, 0); err != nil {
-		if !gocui.IsUnknownView(err) {
-			return err
-		}
-		v.Title = "Request Body"
-		v.Wrap = true
-		v.Autoscroll = false
-		v.Editable = true
+	if err := layoutRequestBody(g, verticalSplitX, requestBodyYStart, horizontalSplitY); err != nil {
+		return err
 	}
 
 	// Command Line (e.g. :get http://httpbin.org/get)
@@ -1135,6 +3392,15 @@ func quit(g *gocui.Gui, v *gocui.View) error {
 	return gocui.ErrQuit
 }
 
+// cancelOrQuit Cancels the call being made or closes the open WebSocket, or
+// quits if there is neither
+func cancelOrQuit(g *gocui.Gui, v *gocui.View) error {
+	if cancelCall() || closeWebSocket() {
+		return nil
+	}
+	return quit(g, v)
+}
+
 func setKeybindings(g *gocui.Gui) error {
 
 	// Global Keybindings
@@ -1168,7 +3434,7 @@ func setKeybindings(g *gocui.Gui) error {
 		if err := g.SetKeybinding("", gocui.KeyCtrlW, gocui.ModNone, clearWord); err != nil {
 			log.Panicln(err)
 		}
-		if err := g.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, quit); err != nil {
+		if err := g.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, cancelOrQuit); err != nil {
 			log.Panicln(err)
 		}
 	}
@@ -1204,6 +3470,17 @@ func main() {
 	if envFile != nil {
 		profiles.CurrentState().Environment.Home.PopulateFromFile(*envFile)
 	}
+	if flag.Arg(0) == "run" {
+		os.Exit(runCollection(flag.Args()[1:]))
+	}
+	if key, err := t.SecretKeyFromEnviron(); err != nil {
+		log.Printf("Failed to read the secret key: %s\n", err)
+	} else {
+		secretKey = key
+		if err := unlockCurrentProfile(); err != nil {
+			log.Printf("Failed to unlock the secret variables: %s\n", err)
+		}
+	}
 
 	//Setting up a new TUI
 	g, err := gocui.NewGui(gocui.OutputNormal, false)
@@ -1237,6 +3514,8 @@ type viewBackup struct {
 	requestHeaderBuffer string
 	requestBodyBuffer   string
 	responseBodyBuffer  string
+	shownResponse       responseViewState
+	lastShownCall       *t.HistoricalCall
 }
 
 // store Given a GUI, stores the relevant state of the GUI into the backup.
@@ -1252,6 +3531,8 @@ func (backup *viewBackup) store(g *gocui.Gui) {
 
 	responseBodyView, _ := g.View(RSP_BODY_VIEW)
 	backup.responseBodyBuffer = responseBodyView.Buffer()
+	backup.shownResponse = shownResponse
+	backup.lastShownCall = lastShownCall
 }
 
 // restore Given a GUI, restores the stored state into the relevant parts of the GUI.
@@ -1269,8 +3550,14 @@ func (backup *viewBackup) restore(g *gocui.Gui) {
 	fmt.Fprint(requestBodyView, backup.requestBodyBuffer)
 
 	responseBodyView, _ := g.View(RSP_BODY_VIEW)
-	responseBodyView.Clear()
-	fmt.Fprint(responseBodyView, backup.responseBodyBuffer)
+	shown := backup.shownResponse
+	if shown.call != nil && sameViewText(backup.responseBodyBuffer, shown.drawn) {
+		// Redraw it so it keeps its colors
+		updateResponseBodyViewWithCall(responseBodyView, *shown.call, shown.report)
+	} else {
+		updateResponseBodyView(responseBodyView, backup.responseBodyBuffer)
+	}
+	lastShownCall = backup.lastShownCall
 }
 
 func (backup *viewBackup) clear() {
@@ -1278,6 +3565,8 @@ func (backup *viewBackup) clear() {
 	backup.requestHeaderBuffer = ""
 	backup.requestBodyBuffer = ""
 	backup.responseBodyBuffer = ""
+	backup.shownResponse = responseViewState{}
+	backup.lastShownCall = nil
 }
 
 var histHintViewBackup viewBackup
@@ -1294,7 +3583,7 @@ func histArrowUp(gui *gocui.Gui, view *gocui.View) error {
 		curY -= 1
 
 		// Show hint for selected history
-		call, _ := profiles.CurrentState().History.Get(curY)
+		call, _ := historyCall(curY)
 		updateViewsWithCall(gui, call)
 	}
 	view.SetCursor(curX, curY)
@@ -1307,7 +3596,7 @@ func histArrowDown(gui *gocui.Gui, view *gocui.View) error {
 		curY += 1
 
 		// Show hint for selected history
-		call, _ := profiles.CurrentState().History.Get(curY)
+		call, _ := historyCall(curY)
 		updateViewsWithCall(gui, call)
 	}
 	view.SetCursor(curX, curY)
@@ -1356,7 +3645,7 @@ func histOnEnter(g *gocui.Gui, v *gocui.View) error {
 	// into the view
 	_, curY := v.Cursor()
 	var cmd string
-	historicalCall, err := profiles.CurrentState().History.Get(curY)
+	historicalCall, err := historyCall(curY)
 	if err != nil {
 		cmd = ""
 	}
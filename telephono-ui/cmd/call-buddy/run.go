@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	t "github.com/call-buddy/call-buddy/telephono"
+)
+
+// The exit codes of the run command
+const (
+	runPassed = 0
+	runFailed = 1
+	runUsage  = 2
+)
+
+// keyValueFlags A flag that can be given many times, each time as KEY=VALUE
+type keyValueFlags []string
+
+func (kvs *keyValueFlags) String() string {
+	return strings.Join(*kvs, " ")
+}
+
+func (kvs *keyValueFlags) Set(kv string) error {
+	if !strings.Contains(kv, "=") {
+		return errors.New("Expected KEY=VALUE, got " + kv)
+	}
+	*kvs = append(*kvs, kv)
+	return nil
+}
+
+// runCollection Calls the templates of a collection without the TUI and
+// writes whether their assertions passed to stdout. Returns the exit code:
+// runPassed if every template passed, runFailed if any didn't and runUsage
+// when the arguments are wrong.
+func runCollection(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	format := flags.String("format", "tap", "Output format, tap or junit")
+	profileName := flags.String("profile", "", "Profile to run the templates of, the current one by default")
+	var vars, settings keyValueFlags
+	flags.Var(&vars, "var", "Set a User environment variable, can be given many times")
+	flags.Var(&settings, "set", "Change a HTTP setting as the 'set' command does, can be given many times")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: call-buddy [-e env-file] run [OPTIONS] COLLECTION")
+		fmt.Fprintln(flags.Output(), "\nCOLLECTION is a template or folder of templates in the profile, e.g. api/users,")
+		fmt.Fprint(flags.Output(), "a Postman collection file, or - to run every template in the profile.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return runUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return runUsage
+	}
+	if *format != "tap" && *format != "junit" {
+		fmt.Fprintln(os.Stderr, "Unknown format "+*format+", use tap or junit")
+		return runUsage
+	}
+
+	state := profiles.CurrentState()
+	if *profileName != "" {
+		profile, err := profiles.Get(*profileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return runUsage
+		}
+		state = profile.State
+	}
+
+	// Nothing the run changes is saved to the profile
+	env := state.Environment.Clone()
+	key, err := t.SecretKeyFromEnviron()
+	if err == nil && key != nil {
+		err = env.User.Unlock(key)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return runUsage
+	}
+	if env.User.Locked() {
+		fmt.Fprintln(os.Stderr, "The secret variables are locked, set "+t.PassphraseVariable+" or "+t.AgeKeyVariable+" to unlock them")
+		return runUsage
+	}
+	config := state.ClientConfig
+	collectionName := flags.Arg(0)
+	templates, err := selectRunTemplates(state, collectionName, &env)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return runUsage
+	}
+	for _, kv := range vars {
+		splatted := strings.SplitN(kv, "=", 2)
+		env.User.Mapping[splatted[0]] = splatted[1]
+	}
+	for _, kv := range settings {
+		splatted := strings.SplitN(kv, "=", 2)
+		if err := config.Set(splatted[0], splatted[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return runUsage
+		}
+	}
+	client, err := config.NewClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return runUsage
+	}
+	client.Jar = state.CookieJar().Clone()
+
+	// Ctrl-C cancels the call being made and skips the rest
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	results := t.Run(ctx, client, &env, templates, state.OAuth2, config.BodyLimit(nil))
+	if err := writeRunResults(os.Stdout, *format, collectionName, results); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return runFailed
+	}
+	for _, result := range results {
+		if !result.Passed() {
+			return runFailed
+		}
+	}
+	return runPassed
+}
+
+// selectRunTemplates Returns the templates to run. A Postman collection
+// file's variables are stored in the given environment.
+func selectRunTemplates(state *t.CallBuddyState, name string, env *t.CallBuddyEnvironment) ([]*t.RequestTemplate, error) {
+	if name == "-" {
+		if templates := state.Templates().Select(""); len(templates) > 0 {
+			return templates, nil
+		}
+		return nil, errors.New("No templates saved in the profile")
+	}
+	if info, err := os.Stat(name); err == nil && !info.IsDir() {
+		fd, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		imported, err := t.ImportPostman(fd)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range imported.Variables {
+			env.User.Mapping[key] = value
+		}
+		return imported.Collection.Select(""), nil
+	}
+
+	templates := state.Templates().Select(name)
+	if len(templates) == 0 {
+		return nil, errors.New("No templates named " + name + " or in a folder named " + name)
+	}
+	return templates, nil
+}
+
+func writeRunResults(w io.Writer, format, name string, results []t.RunResult) error {
+	if format == "junit" {
+		return t.WriteJUnit(w, name, results)
+	}
+	return t.WriteTAP(w, results)
+}
@@ -0,0 +1,117 @@
+package telephono
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		text     string
+		shouldbe Assertion
+	}{
+		{"status == 200", Assertion{"status", "", "==", "200"}},
+		{"header Content-Type == application/json", Assertion{"header", "Content-Type", "==", "application/json"}},
+		{"json $.user.name == \"alice smith\"", Assertion{"json", "$.user.name", "==", "\"alice smith\""}},
+		{"body  ~  \"ok\": true", Assertion{"body", "", "~", "\"ok\": true"}},
+		{"Latency <= 500ms", Assertion{"latency", "", "<=", "500ms"}},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			assertion, err := ParseAssertion(test.text)
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			if assertion != test.shouldbe {
+				t.Errorf("Expected %+v, got %+v", test.shouldbe, assertion)
+			}
+		})
+	}
+}
+
+func TestParseAssertionErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"size == 3",
+		"status",
+		"status ~ 2..",
+		"status == ok",
+		"header == x",
+		"body == ok",
+		"body ~ (",
+		"latency <= soon",
+		"json $.a[ == 1",
+	}
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			if _, err := ParseAssertion(test); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestAssertionCheck(t *testing.T) {
+	call := HistoricalCall{
+		Response: Response{
+			StatusCode: 201,
+			Header:     http.Header{"Location": {"/users/42"}, "Content-Type": {"application/json"}},
+			Body:       []byte(`{"user": {"name": "alice", "id": 42, "score": 1.0}, "ok": true}`),
+		},
+		Timing: CallTiming{Total: 120 * time.Millisecond},
+	}
+	tests := []struct {
+		text   string
+		passes bool
+	}{
+		{"status == 201", true},
+		{"status == 200", false},
+		{"header content-type == application/json", true},
+		{"header Location ~ ^/users/[0-9]+$", true},
+		{"header X-Missing ~ .", false},
+		{"json $.user.name == alice", true},
+		{"json $.user.name == \"alice\"", true},
+		{"json $.user.name == bob", false},
+		{"json $.user.id == 42", true},
+		{"json $.user.score == 1", true},
+		{"json $.user == {\"id\": 42, \"name\": \"alice\", \"score\": 1}", true},
+		{"json $.missing == 1", false},
+		{"json $.user.name ~ ^al", true},
+		{"body ~ \"ok\": true", true},
+		{"body ~ error", false},
+		{"latency <= 1s", true},
+		{"latency <= 100ms", false},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			assertion, err := ParseAssertion(test.text)
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			err = assertion.Check(call)
+			if test.passes && err != nil {
+				t.Errorf("Expected to pass, got %s", err)
+			} else if !test.passes && err == nil {
+				t.Error("Expected to fail")
+			}
+		})
+	}
+}
+
+func TestRequestTemplateCheck(t *testing.T) {
+	template := RequestTemplate{Assertions: []Assertion{
+		{"status", "", "==", "200"},
+		{"body", "", "~", "hello"},
+	}}
+	results, passed := template.Check(HistoricalCall{Response: Response{StatusCode: 200, Body: []byte("goodbye")}})
+	if passed || len(results) != 2 || results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("Expected only the body assertion to fail, got %+v", results)
+	}
+
+	clone := template.Clone()
+	clone.Assertions[0].Expected = "404"
+	if template.Assertions[0].Expected != "200" {
+		t.Error("Expected the clone's assertions to be a copy")
+	}
+}
@@ -0,0 +1,111 @@
+package telephono
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAWS(t *testing.T) {
+	// The example of https://docs.aws.amazon.com/general/latest/gr/sigv4-create-canonical-request.html
+	httpRequest, _ := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	auth := Auth{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", Region: "us-east-1", Service: "iam"}
+	signAWS(httpRequest, "", auth, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	shouldbe := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if authorization := httpRequest.Header.Get("Authorization"); authorization != shouldbe {
+		t.Errorf("Expected %s, got %s", shouldbe, authorization)
+	}
+	if date := httpRequest.Header.Get("X-Amz-Date"); date != "20150830T123600Z" {
+		t.Errorf("Unexpected X-Amz-Date %s", date)
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	// The example of https://tools.ietf.org/html/rfc2617#section-3.5
+	challenge := parseAuthParams(`realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+	authorization, err := digestAuthorization(challenge, "GET", "/dir/index.html", "", "Mufasa", "Circle Of Life", "0a4f113b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{`response="6629fae49393a05397450978507c4ef1"`, `qop=auth,`, `nc=00000001`, `opaque="5ccc069c403ebaf9f0171e9517f40e41"`} {
+		if !strings.Contains(authorization, part) {
+			t.Errorf("Expected %s in %s", part, authorization)
+		}
+	}
+
+	if _, err = digestAuthorization(map[string]string{"algorithm": "SHA-512-256"}, "GET", "/", "", "a", "b", "c"); err == nil {
+		t.Errorf("Expected an unsupported algorithm to fail")
+	}
+}
+
+func TestParseAuth(t *testing.T) {
+	tests := []struct {
+		args     []string
+		shouldbe string
+	}{
+		{[]string{"basic", "alice", "secret"}, "basic alice ********"},
+		{[]string{"Bearer", "{{User.TOKEN}}"}, "bearer {{User.TOKEN}}"},
+		{[]string{"aws", "AKID", "{{User.SECRET}}", "eu-west-1", "es"}, "aws AKID {{User.SECRET}} eu-west-1 es"},
+		{[]string{"OAuth2"}, "oauth2"},
+	}
+	for _, test := range tests {
+		auth, err := ParseAuth(test.args)
+		if err != nil {
+			t.Errorf("Parsing %v failed: %s", test.args, err)
+		} else if auth.String() != test.shouldbe {
+			t.Errorf("Expected %s, got %s", test.shouldbe, auth)
+		}
+	}
+
+	for _, invalid := range [][]string{{}, {"basic", "alice"}, {"aws", "AKID"}, {"ntlm", "a", "b"}, {"oauth2", "token"}} {
+		if _, err := ParseAuth(invalid); err == nil {
+			t.Errorf("Expected %v to fail", invalid)
+		}
+	}
+}
+
+func TestExecuteWithAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if r.URL.Path == "/digest" && !strings.HasPrefix(authorization, "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Basic realm="other", Digest realm="api", qop="auth", nonce="abc"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+		w.Write([]byte(authorization + "|" + string(body)))
+	}))
+	defer server.Close()
+
+	env := CallBuddyEnvironment{
+		OS:   Environment{Name: "Var", Mapping: map[string]string{}},
+		User: Environment{Name: "User", Mapping: map[string]string{"TOKEN": "t0ken"}},
+	}
+	tests := []struct {
+		path     string
+		auth     Auth
+		shouldbe string
+	}{
+		{"/basic", Auth{Type: BasicAuth, Username: "alice", Password: "secret"}, "Basic YWxpY2U6c2VjcmV0|body"},
+		{"/bearer", Auth{Type: BearerAuth, Token: "{{User.TOKEN}}"}, "Bearer t0ken|body"},
+		{"/digest", Auth{Type: DigestAuth, Username: "alice", Password: "secret"}, `Digest username="alice", realm="api", nonce="abc", uri="/digest"`},
+	}
+	for _, test := range tests {
+		template := RequestTemplate{Method: Post, Url: server.URL + test.path, Headers: http.Header{}, Body: "body", Auth: &test.auth}
+		call, err := template.Execute(http.DefaultClient, &env)
+		if err != nil {
+			t.Fatalf("Execute failed: %s", err)
+		}
+		if !strings.HasPrefix(string(call.Response.Body), test.shouldbe) {
+			t.Errorf("Expected %s, got %s", test.shouldbe, call.Response.Body)
+		}
+		if call.Response.StatusCode != http.StatusOK || !strings.HasSuffix(string(call.Response.Body), "|body") {
+			t.Errorf("Expected the body to be sent, got %d %s", call.Response.StatusCode, call.Response.Body)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package telephono
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIsBinaryBody(t *testing.T) {
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write([]byte(`{"a": 1}`))
+	writer.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		shouldbe    bool
+	}{
+		{"json", "application/json", []byte(`{"a": 1}`), false},
+		{"gzipped json", "application/json", gzipped.Bytes(), true},
+		{"png", "image/png", []byte("\x89PNG\r\n\x1a\n"), true},
+		{"svg", "image/svg+xml", []byte(`<svg/>`), false},
+		{"protobuf", "application/x-protobuf", []byte("text-like"), true},
+		{"untyped text", "", []byte("héllo\tworld\r\n"), false},
+		{"colored text", "text/plain", []byte("\x1b[31mred\x1b[0m"), false},
+		{"nul", "", []byte("a\x00b"), true},
+		{"latin-1", "text/plain", []byte("caf\xe9"), true},
+		{"empty", "", []byte{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if binary := IsBinaryBody(test.contentType, test.body); binary != test.shouldbe {
+				t.Errorf("Expected %v, got %v", test.shouldbe, binary)
+			}
+		})
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	body := []byte("\x89PNG\r\n\x1a\n0123456789")
+	dump := HexDump(body, "application/octet-stream", 16)
+	shouldbe := `Binary body of 18 bytes, application/octet-stream, looks like image/png
+
+00000000  89 50 4e 47 0d 0a 1a 0a  30 31 32 33 34 35 36 37  |.PNG....01234567|
+... 2 more bytes
+`
+	if dump != shouldbe {
+		t.Errorf("Expected\n%s\ngot\n%s", shouldbe, dump)
+	}
+
+	dump = HexDump(body, "image/png", 0)
+	if !strings.HasPrefix(dump, "Binary body of 18 bytes, image/png\n") || strings.Contains(dump, "more bytes") {
+		t.Errorf("Unexpected dump\n%s", dump)
+	}
+}
+
+func TestResponseStringBinary(t *testing.T) {
+	response := Response{Header: http.Header{"Content-Type": {"image/png"}}, Body: []byte("\x89PNG\r\n\x1a\n")}
+	if !strings.HasPrefix(response.String(), "Binary body of 8 bytes, image/png") {
+		t.Errorf("Expected a hex dump, got %s", response.String())
+	}
+	if formatSize(3<<20) != "3.0 MiB" || formatSize(1536) != "1.5 KiB" {
+		t.Errorf("Unexpected sizes %s and %s", formatSize(3<<20), formatSize(1536))
+	}
+}
@@ -0,0 +1,100 @@
+package telephono_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+func TestExecuteLimited(t *testing.T) {
+	large := strings.Repeat("0123456789abcdef", 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(large)))
+			w.Write([]byte(large))
+		} else {
+			w.Write([]byte(`{"small": true}`))
+		}
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "call-buddy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := newTestEnvironment()
+	progress := &telephono.BodyProgress{}
+	limit := telephono.BodyLimit{MaxInMemory: 100 << 10, Dir: dir, Progress: progress}
+
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL + "/small", Headers: http.Header{}}
+	call, err := template.ExecuteLimited(context.Background(), http.DefaultClient, &env, limit)
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	if call.Response.IsTruncated() || string(call.Response.Body) != `{"small": true}` {
+		t.Errorf("Expected the small body in memory, got %q in %q", call.Response.Body, call.Response.BodyFile)
+	}
+
+	template.Url = server.URL + "/large"
+	call, err = template.ExecuteLimited(context.Background(), http.DefaultClient, &env, limit)
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	if !call.Response.IsTruncated() {
+		t.Fatalf("Expected the large body to be saved to a file")
+	}
+	if len(call.Response.Body) != telephono.BodyPreviewSize || call.Response.Size() != int64(len(large)) {
+		t.Errorf("Expected a %d byte preview of %d bytes, got %d of %d", telephono.BodyPreviewSize, len(large), len(call.Response.Body), call.Response.Size())
+	}
+	var whole bytes.Buffer
+	if err := call.Response.WriteBody(&whole); err != nil || whole.String() != large {
+		t.Errorf("Expected the file to hold the whole body, got %d bytes, %v", whole.Len(), err)
+	}
+	if received, total := progress.Received(); received != int64(len(large)) || total != int64(len(large)) {
+		t.Errorf("Expected %d of %d bytes received, got %d of %d", len(large), len(large), received, total)
+	}
+
+	template.Assertions = []telephono.Assertion{{Kind: "body", Operator: "~", Expected: "abc"}}
+	if _, passed := template.Check(call); passed {
+		t.Errorf("Expected a body assertion on a saved body to fail")
+	}
+}
+
+func TestExecuteLimitedBelowPreview(t *testing.T) {
+	large := strings.Repeat("é", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(large))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "call-buddy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := newTestEnvironment()
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL, Headers: http.Header{}}
+	for _, max := range []int64{1, 2, 1023, 1024} {
+		limit := telephono.BodyLimit{MaxInMemory: max, Dir: dir}
+		call, err := template.ExecuteLimited(context.Background(), http.DefaultClient, &env, limit)
+		if err != nil {
+			t.Fatalf("Call failed: %s", err)
+		}
+		if !call.Response.IsTruncated() || call.Response.Size() != int64(len(large)) {
+			t.Errorf("Expected the body to be saved to a file with a limit of %d", max)
+		}
+		// The preview doesn't cut the two byte characters in half
+		if int64(len(call.Response.Body)) > max || !strings.HasPrefix(large, string(call.Response.Body)) || len(call.Response.Body)%2 != 0 {
+			t.Errorf("Unexpected preview %q with a limit of %d", call.Response.Body, max)
+		}
+	}
+}
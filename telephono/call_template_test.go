@@ -0,0 +1,112 @@
+package telephono_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/call-buddy/call-buddy/telephono"
+	"github.com/call-buddy/call-buddy/telephono/cmd/test_server"
+)
+
+func newTestEnvironment() telephono.CallBuddyEnvironment {
+	return telephono.CallBuddyEnvironment{
+		OS:   telephono.Environment{Name: "Var", Mapping: map[string]string{}},
+		User: telephono.Environment{Name: "User", Mapping: map[string]string{}},
+		Home: telephono.Environment{Name: "Home", Mapping: map[string]string{}},
+	}
+}
+
+func TestExecuteMethods(t *testing.T) {
+	setUpServer()
+	env := newTestEnvironment()
+
+	for _, method := range []telephono.HttpMethod{telephono.Patch, telephono.Options, "PROPFIND"} {
+		t.Run(method.String(), func(t *testing.T) {
+			template := telephono.RequestTemplate{
+				Method:  method,
+				Url:     GlobalTestState.getPrefix() + "/resource",
+				Headers: http.Header{},
+				Body:    `[{"op": "remove", "path": "/a"}]`,
+			}
+			call, err := template.Execute(http.DefaultClient, &env)
+			if err != nil {
+				t.Fatalf("Execute failed: %s", err)
+			}
+			if call.Request.Method != method {
+				t.Errorf("Expected the request method to be %s, got %s", method, call.Request.Method)
+			}
+
+			var report test_server.ReportResponse
+			if err := json.Unmarshal(call.Response.Body, &report); err != nil {
+				t.Fatalf("Bad report: %s", err)
+			}
+			if report.Method != method.String() {
+				t.Errorf("Expected the server to see %s, got %s", method, report.Method)
+			}
+		})
+	}
+}
+
+func TestExecuteContextCancel(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	env := newTestEnvironment()
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL, Headers: http.Header{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	started := time.Now()
+	_, err := template.ExecuteContext(ctx, http.DefaultClient, &env)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the call to be cancelled, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Error("Cancelling took too long")
+	}
+}
+
+func TestExecuteTiming(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	env := newTestEnvironment()
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL, Headers: http.Header{}}
+	call, err := template.Execute(server.Client(), &env)
+	if err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+
+	timing := call.Timing
+	if timing.Connect <= 0 || timing.TLSHandshake <= 0 {
+		t.Errorf("Expected a connection and handshake to be timed: %+v", timing)
+	}
+	if timing.FirstByte < 20*time.Millisecond || timing.Total < timing.FirstByte {
+		t.Errorf("Unexpected first byte and total times: %+v", timing)
+	}
+	if timing.ReusedConnection {
+		t.Error("The first call can't reuse a connection")
+	}
+
+	// The connection is kept alive for the next call
+	call, err = template.Execute(server.Client(), &env)
+	if err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	if !call.Timing.ReusedConnection || call.Timing.TLSHandshake != 0 {
+		t.Errorf("Expected the connection to be reused: %+v", call.Timing)
+	}
+}
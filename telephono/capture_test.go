@@ -0,0 +1,129 @@
+package telephono
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseCapture(t *testing.T) {
+	tests := []struct {
+		text     string
+		shouldbe Capture
+	}{
+		{"User.TOKEN = json:$.access_token", Capture{"TOKEN", "json", "$.access_token"}},
+		{"NEXT=header:Location", Capture{"NEXT", "header", "Location"}},
+		{"CODE = STATUS", Capture{"CODE", "status", ""}},
+		{"PAGE = body", Capture{"PAGE", "body", ""}},
+		{`CSRF = body:value="([^"]+)"`, Capture{"CSRF", "body", `value="([^"]+)"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			capture, err := ParseCapture(test.text)
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			if capture != test.shouldbe {
+				t.Errorf("Expected %+v, got %+v", test.shouldbe, capture)
+			}
+		})
+	}
+}
+
+func TestParseCaptureErrors(t *testing.T) {
+	tests := []string{
+		"TOKEN",
+		"Var.TOKEN = status",
+		"2FA = status",
+		"TOKEN = json",
+		"TOKEN = json:$.a[",
+		"TOKEN = header",
+		"TOKEN = status:200",
+		"TOKEN = body:(",
+		"TOKEN = cookie:session",
+	}
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			if _, err := ParseCapture(test); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestRequestTemplateCapture(t *testing.T) {
+	call := HistoricalCall{Response: Response{
+		StatusCode: 201,
+		Header:     http.Header{"Location": {"/users/42"}},
+		Body:       []byte(`{"access_token": "abc", "expires_in": 3600}`),
+	}}
+	template := RequestTemplate{}
+	for _, text := range []string{
+		"User.TOKEN = json:$.access_token",
+		"EXPIRES = json:$.expires_in",
+		"NEXT = header:location",
+		"CODE = status",
+		`QUOTED = body:"access_token": "([a-z]+)"`,
+		"MISSING = json:$.refresh_token",
+	} {
+		capture, err := ParseCapture(text)
+		if err != nil {
+			t.Fatalf("Parse failed: %s", err)
+		}
+		template.Captures = append(template.Captures, capture)
+	}
+
+	env := CallBuddyEnvironment{User: Environment{Name: "User", Mapping: map[string]string{"MISSING": "old"}}}
+	results := template.Capture(call, &env)
+	shouldbe := map[string]string{
+		"TOKEN":   "abc",
+		"EXPIRES": "3600",
+		"NEXT":    "/users/42",
+		"CODE":    "201",
+		"QUOTED":  "abc",
+		"MISSING": "old",
+	}
+	for key, value := range shouldbe {
+		if env.User.Mapping[key] != value {
+			t.Errorf("Expected %s=%s, got %s", key, value, env.User.Mapping[key])
+		}
+	}
+	if len(results) != 6 || results[5].Err == nil {
+		t.Errorf("Expected only the last capture to fail, got %+v", results)
+	}
+}
+
+func TestCaptureIntoSecret(t *testing.T) {
+	call := HistoricalCall{Response: Response{StatusCode: 200, Body: []byte(`{"access_token": "t0ken"}`)}}
+	capture, err := ParseCapture("TOKEN = json:$.access_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := RequestTemplate{Captures: []Capture{capture}}
+	key, err := PassphraseKey("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := CallBuddyEnvironment{User: Environment{Name: "User", Mapping: map[string]string{}}}
+	env.User.Unlock(key)
+	if err := env.User.SetSecret("TOKEN", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The secret stays encrypted
+	if results := template.Capture(call, &env); results[0].Err != nil {
+		t.Fatalf("Capture failed: %s", results[0].Err)
+	}
+	if _, plain := env.User.Mapping["TOKEN"]; plain || env.User.Expand("{{User.TOKEN}}") != "t0ken" {
+		t.Errorf("Expected the captured token to be a secret, got %v %v", env.User.Mapping, env.User.Secrets)
+	}
+
+	// Locked secrets can't be encrypted, so they aren't replaced
+	ciphertext := env.User.Secrets["TOKEN"]
+	env.User.Lock()
+	if results := template.Capture(call, &env); results[0].Err == nil || results[0].Value != "" {
+		t.Errorf("Expected capturing into a locked secret to fail, got %+v", results[0])
+	}
+	if _, plain := env.User.Mapping["TOKEN"]; plain || env.User.Secrets["TOKEN"] != ciphertext {
+		t.Errorf("Expected the locked secret to be left as it was, got %v %v", env.User.Mapping, env.User.Secrets)
+	}
+}
@@ -0,0 +1,117 @@
+package telephono_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+func TestClientConfigSet(t *testing.T) {
+	config := telephono.ClientConfig{}
+	tests := []struct {
+		key, value, shouldbe string
+	}{
+		{"timeout", "1m30s", "1m30s"},
+		{"timeout", "5", "5s"},
+		{"timeout", "", "none"},
+		{"redirects", "off", "off"},
+		{"redirects", "", "on"},
+		{"max-redirects", "3", "3"},
+		{"proxy", "localhost:3128", "localhost:3128"},
+		{"proxy", "", "from environment"},
+		{"insecure", "on", "on"},
+		{"cacert", "/etc/ca.pem", "/etc/ca.pem"},
+		{"max-body", "64MB", "64.0 MiB"},
+		{"max-body", "512kib", "512.0 KiB"},
+		{"max-body", "none", "none"},
+		{"max-body", "", "16.0 MiB"},
+		{"body-dir", "/tmp/bodies", "/tmp/bodies"},
+		{"http", "HTTP/1.1", "1.1"},
+		{"http", "h2c", "h2c"},
+		{"http", "h3", "3"},
+		{"http", "", "auto"},
+	}
+	for _, test := range tests {
+		t.Run(test.key+"="+test.value, func(t *testing.T) {
+			if err := config.Set(test.key, test.value); err != nil {
+				t.Fatalf("Set failed: %s", err)
+			}
+			if value, _ := config.Get(test.key); value != test.shouldbe {
+				t.Errorf("Expected %s, got %s", test.shouldbe, value)
+			}
+		})
+	}
+
+	for _, invalid := range [][2]string{{"timeout", "soon"}, {"redirects", "maybe"}, {"max-redirects", "-1"}, {"max-redirects", "0"}, {"max-body", "lots"}, {"max-body", "0"}, {"max-body", "inf"}, {"max-body", "-Inf"}, {"max-body", "nan"}, {"max-body", "1e30"}, {"max-body", "9e9GB"}, {"http", "spdy"}, {"nope", "1"}} {
+		if err := config.Set(invalid[0], invalid[1]); err == nil {
+			t.Errorf("Expected %s=%s to fail", invalid[0], invalid[1])
+		}
+	}
+}
+
+func TestClientConfigRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/final" {
+			writer.Write([]byte("done"))
+			return
+		}
+		http.Redirect(writer, request, "/final", http.StatusFound)
+	}))
+	defer server.Close()
+
+	followed, _ := (&telephono.ClientConfig{}).NewClient()
+	response, err := followed.Get(server.URL + "/start")
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Expected the redirect to be followed, got %d", response.StatusCode)
+	}
+
+	notFollowed, _ := (&telephono.ClientConfig{NoRedirects: true}).NewClient()
+	response, err = notFollowed.Get(server.URL + "/start")
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if response.StatusCode != http.StatusFound {
+		t.Errorf("Expected the redirect to be returned, got %d", response.StatusCode)
+	}
+}
+
+func TestClientConfigInsecureAndTimeout(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	verified, _ := (&telephono.ClientConfig{}).NewClient()
+	if _, err := verified.Get(server.URL); err == nil {
+		t.Error("Expected the self signed certificate to be rejected")
+	}
+
+	insecure, _ := (&telephono.ClientConfig{Insecure: true, Timeout: 50 * time.Millisecond}).NewClient()
+	if _, err := insecure.Get(server.URL); err != nil {
+		t.Errorf("Expected the certificate to be skipped: %s", err)
+	}
+	if _, err := insecure.Get(server.URL + "/slow"); err == nil {
+		t.Error("Expected the call to time out")
+	}
+}
+
+func TestClientConfigMissingFiles(t *testing.T) {
+	configs := []telephono.ClientConfig{
+		{CACert: "/does/not/exist.pem"},
+		{ClientCert: "/does/not/exist.pem"},
+		{ClientCert: "/does/not/exist.pem", ClientKey: "/does/not/exist.key"},
+	}
+	for _, config := range configs {
+		if _, err := config.NewClient(); err == nil {
+			t.Errorf("Expected %+v to fail", config)
+		}
+	}
+}
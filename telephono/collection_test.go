@@ -0,0 +1,81 @@
+package telephono
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCollectionSaveAndGet(t *testing.T) {
+	collection := CallBuddyCollection{Name: "test"}
+	template := RequestTemplate{
+		Name:    "login",
+		Method:  Post,
+		Url:     "http://localhost/login",
+		Headers: http.Header{"Content-Type": {"application/json"}},
+		Body:    "{}",
+	}
+	if err := collection.Save(template); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+
+	// The saved template must not share headers with the original
+	template.Headers.Set("Content-Type", "text/plain")
+
+	saved, err := collection.Get("login")
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if saved.Method != Post || saved.Url != "http://localhost/login" || saved.Body != "{}" {
+		t.Errorf("Saved template didn't match: %+v", saved)
+	}
+	if saved.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("Saved template headers were modified: %s", saved.Headers.Get("Content-Type"))
+	}
+}
+
+func TestCollectionSaveReplaces(t *testing.T) {
+	collection := CallBuddyCollection{Name: "test"}
+	collection.Save(RequestTemplate{Name: "a", Method: Get, Url: "http://one"})
+	collection.Save(RequestTemplate{Name: "a", Method: Get, Url: "http://two"})
+
+	if len(collection.List()) != 1 {
+		t.Fatalf("Expected 1 template, got %d", len(collection.List()))
+	}
+	saved, _ := collection.Get("a")
+	if saved.Url != "http://two" {
+		t.Errorf("Template wasn't replaced, got %s", saved.Url)
+	}
+}
+
+func TestCollectionInvalidName(t *testing.T) {
+	collection := CallBuddyCollection{Name: "test"}
+	tests := []string{"", "has space", "semi;colon"}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := collection.Save(RequestTemplate{Name: name, Method: Get}); err == nil {
+				t.Error("Expected an invalid name error")
+			}
+		})
+	}
+}
+
+func TestCollectionRemoveAndList(t *testing.T) {
+	collection := CallBuddyCollection{Name: "test"}
+	// Unnamed templates are left over from older states and are never listed
+	collection.RequestTemplates = append(collection.RequestTemplates, &RequestTemplate{Method: Get})
+	for _, name := range []string{"c", "a", "b"} {
+		collection.Save(RequestTemplate{Name: name, Method: Get})
+	}
+
+	if err := collection.Remove("b"); err != nil {
+		t.Fatalf("Remove failed: %s", err)
+	}
+	if err := collection.Remove("b"); err == nil {
+		t.Error("Expected removing a missing template to fail")
+	}
+
+	listed := collection.List()
+	if len(listed) != 2 || listed[0].Name != "a" || listed[1].Name != "c" {
+		t.Errorf("Unexpected listing: %v", listed)
+	}
+}
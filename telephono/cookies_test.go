@@ -0,0 +1,115 @@
+package telephono_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+func cookieNames(cookies []*http.Cookie) (names []string) {
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name+"="+cookie.Value)
+	}
+	return
+}
+
+func TestCookieJar(t *testing.T) {
+	jar := &telephono.CookieJar{}
+	login, _ := url.Parse("https://app.example.com/login")
+	jar.SetCookies(login, []*http.Cookie{
+		{Name: "session", Value: "abc"},
+		{Name: "auth", Value: "1", Path: "/auth/"},
+		{Name: "shared", Value: "2", Domain: ".example.com", Secure: true},
+		{Name: "other", Value: "3", Domain: "other.com"},
+		{Name: "tld", Value: "4", Domain: "com"},
+	})
+
+	tests := []struct {
+		url      string
+		shouldbe string
+	}{
+		{"https://app.example.com/auth/me", "[auth=1 session=abc shared=2]"},
+		{"https://app.example.com/", "[session=abc shared=2]"},
+		{"http://api.example.com/", "[]"},
+		{"https://api.example.com/", "[shared=2]"},
+		{"https://other.com/", "[]"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if cookies := strings.Join(cookieNames(jar.Cookies(u)), " "); "["+cookies+"]" != test.shouldbe {
+			t.Errorf("Expected %s for %s, got [%s]", test.shouldbe, test.url, cookies)
+		}
+	}
+
+	// Cookies are replaced and removed by the server that set them
+	jar.SetCookies(login, []*http.Cookie{{Name: "session", Value: "def"}, {Name: "auth", Path: "/auth/", MaxAge: -1}})
+	if cookies := cookieNames(jar.Cookies(login)); strings.Join(cookies, " ") != "session=def shared=2" {
+		t.Errorf("Unexpected cookies %v", cookies)
+	}
+
+	// The jar is saved with the profile
+	saved, err := json.Marshal(jar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &telephono.CookieJar{}
+	if err := json.Unmarshal(saved, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.List()) != 2 || loaded.List()[1].String() != "shared=2; Domain=example.com; Path=/; Secure" {
+		t.Errorf("Unexpected cookies after loading %v", loaded.List())
+	}
+
+	if err := jar.Set("https://app.example.com", "theme=dark; Path=/ui"); err != nil {
+		t.Errorf("Setting a cookie failed: %s", err)
+	}
+	if err := jar.Set("https://app.example.com", "theme=dark; Domain=other.com"); err == nil {
+		t.Errorf("Expected a cookie for another domain to fail")
+	}
+	if removed := jar.Clear("example.com"); removed != 3 {
+		t.Errorf("Expected 3 cookies to be removed, got %d", removed)
+	}
+}
+
+func TestExecuteWithCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cret", Path: "/"})
+		}
+		w.Write([]byte(r.Header.Get("Cookie")))
+	}))
+	defer server.Close()
+
+	state := telephono.CallBuddyState{}
+	client, err := state.HttpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnvironment()
+	login := telephono.RequestTemplate{Method: telephono.Post, Url: server.URL + "/login", Headers: http.Header{}}
+	if _, err := login.Execute(client, &env); err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	me := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL + "/me", Headers: http.Header{}}
+	call, err := me.Execute(client, &env)
+	if err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	if string(call.Response.Body) != "session=s3cret" {
+		t.Errorf("Expected the session cookie to be sent, got %q", call.Response.Body)
+	}
+	if len(call.Request.Cookies) != 1 || call.Request.Cookies[0] != "session=s3cret" {
+		t.Errorf("Expected the sent cookies in the history, got %v", call.Request.Cookies)
+	}
+	if !strings.Contains(call.Curl(), "-b session=s3cret") {
+		t.Errorf("Expected the cookies in %s", call.Curl())
+	}
+	if len(state.Cookies.List()) != 1 {
+		t.Errorf("Expected the cookie in the state, got %v", state.Cookies.List())
+	}
+}
@@ -0,0 +1,253 @@
+package telephono
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		arg      string
+		shouldbe string
+	}{
+		{"", "''"},
+		{"http://localhost:8080/a?b=c", "'http://localhost:8080/a?b=c'"},
+		{"https://example.com/path", "https://example.com/path"},
+		{"Content-Type: application/json", "'Content-Type: application/json'"},
+		{"it's", `'it'\''s'`},
+	}
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			if quoted := shellQuote(test.arg); quoted != test.shouldbe {
+				t.Errorf("Expected %s, got %s", test.shouldbe, quoted)
+			}
+		})
+	}
+}
+
+func TestRequestTemplateCurl(t *testing.T) {
+	env := CallBuddyEnvironment{
+		OS:   Environment{Name: "Var", Mapping: map[string]string{}},
+		User: Environment{Name: "User", Mapping: map[string]string{"Host": "example.com", "Token": "s3cr3t"}},
+		Home: Environment{Name: "Home", Mapping: map[string]string{}},
+	}
+	template := RequestTemplate{
+		Method: Post,
+		Url:    "https://{{User.Host}}/items",
+		Headers: http.Header{
+			"Content-Type":  {"application/json"},
+			"Authorization": {"Bearer {{User.Token}}"},
+		},
+		Body: `{"name": "it's"}`,
+	}
+
+	curl, err := template.Curl(&env)
+	if err != nil {
+		t.Fatalf("Curl failed: %s", err)
+	}
+	shouldbe := `curl -X POST https://example.com/items -H 'Authorization: Bearer s3cr3t' -H 'Content-Type: application/json' --data-raw '{"name": "it'\''s"}'`
+	if curl != shouldbe {
+		t.Errorf("Expected\n%s\ngot\n%s", shouldbe, curl)
+	}
+}
+
+func TestHistoricalCallCurl(t *testing.T) {
+	tests := []struct {
+		method   HttpMethod
+		body     string
+		shouldbe string
+	}{
+		{Get, "", "curl https://example.com/"},
+		{Get, "q=1", "curl -X GET https://example.com/ --data-raw q=1"},
+		{Head, "", "curl --head https://example.com/"},
+		{Delete, "", "curl -X DELETE https://example.com/"},
+	}
+	for _, test := range tests {
+		t.Run(test.method.String()+test.body, func(t *testing.T) {
+			call := HistoricalCall{Request: Request{Method: test.method, URL: "https://example.com/", Body: []byte(test.body)}}
+			if curl := call.Curl(); curl != test.shouldbe {
+				t.Errorf("Expected %s, got %s", test.shouldbe, curl)
+			}
+		})
+	}
+}
+
+func TestSplitShellWords(t *testing.T) {
+	words, err := splitShellWords(`curl 'http://a/b?c=d' -H "X-Quote: \"hi\"" \
+  --data-raw it\'s`)
+	if err != nil {
+		t.Fatalf("Split failed: %s", err)
+	}
+	shouldbe := []string{"curl", "http://a/b?c=d", "-H", `X-Quote: "hi"`, "--data-raw", "it's"}
+	if len(words) != len(shouldbe) {
+		t.Fatalf("Expected %q, got %q", shouldbe, words)
+	}
+	for i := range words {
+		if words[i] != shouldbe[i] {
+			t.Errorf("Expected %q, got %q", shouldbe[i], words[i])
+		}
+	}
+
+	if _, err := splitShellWords(`curl 'http://a`); err == nil {
+		t.Error("Expected an unterminated quote error")
+	}
+	if _, err := splitShellWords(`curl $'http://a\'`); err == nil {
+		t.Error("Expected an unterminated ANSI-C quote error")
+	}
+}
+
+func TestSplitShellWordsAnsiC(t *testing.T) {
+	tests := []struct {
+		word     string
+		shouldbe string
+	}{
+		{`$'a\nb\tc'`, "a\nb\tc"},
+		{`$'it\'s \\ \"q\"'`, `it's \ "q"`},
+		{`$'caf\xc3\xa9 caf\u00e9 \101'`, "café café A"},
+		{`$'\q'`, `\q`},
+		{`pre$'\x41'post`, "preApost"},
+		{`"$'a'"`, "$'a'"},
+	}
+	for _, test := range tests {
+		words, err := splitShellWords(test.word)
+		if err != nil {
+			t.Errorf("Split of %s failed: %s", test.word, err)
+		} else if len(words) != 1 || words[0] != test.shouldbe {
+			t.Errorf("Expected %q for %s, got %q", test.shouldbe, test.word, words)
+		}
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	parsed, err := ParseCurl(`curl 'https://example.com/api' -H 'accept: application/json' -H 'content-type: application/json' --data-raw '{"a":1}' --compressed -k`)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	template := parsed.Template
+	if template.Method != Post || template.Url != "https://example.com/api" || template.Body != `{"a":1}` {
+		t.Errorf("Unexpected template %+v", template)
+	}
+	if template.Headers.Get("Accept") != "application/json" || template.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected headers %v", template.Headers)
+	}
+	if !parsed.Insecure {
+		t.Error("Expected -k to be insecure")
+	}
+	if len(parsed.Ignored) != 1 || parsed.Ignored[0] != "--compressed" {
+		t.Errorf("Expected --compressed to be ignored, got %v", parsed.Ignored)
+	}
+}
+
+func TestParseBrowserCurl(t *testing.T) {
+	// Copied as cURL (bash) from Chrome's developer tools
+	parsed, err := ParseCurl(`curl 'https://api.example.com/graphql' \
+  -H 'authority: api.example.com' \
+  -H 'accept: */*' \
+  -H 'content-type: application/json' \
+  -H 'cookie: session=abc' \
+  -H 'user-agent: Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.198 Safari/537.36' \
+  --data-raw $'{"query":"query {\\n  me { name }\\n}","variables":{"note":"it\'s caf\u00e9\\n"}}' \
+  --compressed`)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	template := parsed.Template
+	shouldbe := `{"query":"query {\n  me { name }\n}","variables":{"note":"it's café\n"}}`
+	if template.Method != Post || template.Url != "https://api.example.com/graphql" || template.Body != shouldbe {
+		t.Errorf("Expected a POST of %s, got %+v", shouldbe, template)
+	}
+	if template.Headers.Get("Cookie") != "session=abc" || !strings.HasPrefix(template.Headers.Get("User-Agent"), "Mozilla/5.0") {
+		t.Errorf("Unexpected headers %v", template.Headers)
+	}
+}
+
+func TestParseCurlOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		commandLine string
+		method      HttpMethod
+		url         string
+		body        string
+		header      string
+		value       string
+	}{
+		{"method", "curl -XDELETE localhost:8080/a", Delete, "http://localhost:8080/a", "", "", ""},
+		{"combined", "curl -sSLXPUT http://a -d x=1", Put, "http://a", "x=1", "Content-Type", "application/x-www-form-urlencoded"},
+		{"data", "curl http://a -d x=1 --data y=2", Post, "http://a", "x=1&y=2", "", ""},
+		{"get", "curl -G http://a?z=0 -d x=1", Get, "http://a?z=0&x=1", "", "", ""},
+		{"urlencode", "curl http://a --data-urlencode 'q=a b'", Post, "http://a", "q=a+b", "", ""},
+		{"user", "curl -u alice:secret http://a", Get, "http://a", "", "Authorization", "Basic YWxpY2U6c2VjcmV0"},
+		{"head", "curl -I --url=http://a", Head, "http://a", "", "", ""},
+		{"ignored", "curl -o out.json --max-time 3 http://a", Get, "http://a", "", "", ""},
+		{"ignored values", "curl --max-redirs 3 -T up.txt --retry-delay 1 --retry-max-time 9 --connect-to a:80:b:80 --resolve a:80:127.0.0.1 -w '%{http_code}' --cacert ca.pem http://a", Get, "http://a", "", "", ""},
+		{"ignored short values", "curl -Tup.txt -y 5 -Y 10 http://a", Get, "http://a", "", "", ""},
+		{"referer", "curl -e http://b http://a", Get, "http://a", "", "Referer", "http://b"},
+		{"json", `curl --json '{"a":1}' http://a`, Post, "http://a", `{"a":1}`, "Content-Type", "application/json"},
+		{"bearer", "curl --oauth2-bearer t0ken http://a", Get, "http://a", "", "Authorization", "Bearer t0ken"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := ParseCurl(test.commandLine)
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			template := parsed.Template
+			if template.Method != test.method || template.Url != test.url || template.Body != test.body {
+				t.Errorf("Unexpected template %+v", template)
+			}
+			if test.header != "" && template.Headers.Get(test.header) != test.value {
+				t.Errorf("Expected %s: %s, got %v", test.header, test.value, template.Headers)
+			}
+		})
+	}
+}
+
+func TestParseCurlDataFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "call-buddy-curl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("line one\nline two\n")
+	file.Close()
+
+	parsed, err := ParseCurl("curl http://a -d @" + file.Name())
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if parsed.Template.Body != "line oneline two" {
+		t.Errorf("Expected newlines to be stripped, got %q", parsed.Template.Body)
+	}
+
+	parsed, err = ParseCurl("curl http://a --data-binary @" + file.Name())
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if parsed.Template.Body != "line one\nline two\n" {
+		t.Errorf("Expected the exact file, got %q", parsed.Template.Body)
+	}
+}
+
+func TestParseCurlErrors(t *testing.T) {
+	tests := []string{
+		"curl",
+		"curl -H",
+		"curl http://a http://b",
+		"curl -F file=@x http://a",
+		"curl -X 'BAD VERB' http://a",
+		// Non-ASCII short options used to be expanded forever
+		"curl -é http://a",
+		"curl -sé http://a",
+		"curl -s€X POST http://a",
+	}
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			if _, err := ParseCurl(test); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package telephono_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+func TestParseUnixUrl(t *testing.T) {
+	tests := []struct {
+		url, socket, path string
+	}{
+		{"unix:///var/run/docker.sock:/containers/json?all=1", "/var/run/docker.sock", "/containers/json?all=1"},
+		{"unix:///var/run/docker.sock", "/var/run/docker.sock", "/"},
+		{"unix://relative.sock:info", "relative.sock", "/info"},
+	}
+	for _, test := range tests {
+		socket, path, err := telephono.ParseUnixUrl(test.url)
+		if err != nil {
+			t.Errorf("Parsing %s failed: %s", test.url, err)
+		} else if socket != test.socket || path != test.path {
+			t.Errorf("Expected %s and %s, got %s and %s", test.socket, test.path, socket, path)
+		}
+	}
+
+	for _, invalid := range []string{"http://localhost", "unix://", "unix://:/info"} {
+		if _, _, err := telephono.ParseUnixUrl(invalid); err == nil {
+			t.Errorf("Expected %s to fail", invalid)
+		}
+	}
+}
+
+func echoHostAndPath(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.Host + " " + r.URL.RequestURI()))
+}
+
+func TestExecuteUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "call-buddy-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "api.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(echoHostAndPath)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client, _ := (&telephono.ClientConfig{}).NewClient()
+	env := newTestEnvironment()
+	url := "unix://" + socket + ":/containers/json?all=1"
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: url, Headers: http.Header{}}
+	call, err := template.ExecuteContext(context.Background(), client, &env)
+	if err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	if shouldbe := "localhost /containers/json?all=1"; string(call.Response.Body) != shouldbe {
+		t.Errorf("Expected %q, got %q", shouldbe, call.Response.Body)
+	}
+	if call.Request.URL != url {
+		t.Errorf("Expected the unix URL in the history, got %s", call.Request.URL)
+	}
+
+	// Templates with an HTTP version or connect-to of their own still use
+	// the socket
+	for _, protocol := range []string{"1.1", "2"} {
+		template := telephono.RequestTemplate{Method: telephono.Get, Url: url, Headers: http.Header{}, ConnectTo: "127.0.0.1"}
+		if err := template.SetProtocol(protocol); err != nil {
+			t.Fatal(err)
+		}
+		call, err := template.ExecuteContext(context.Background(), client, &env)
+		if err != nil {
+			t.Fatalf("Execute with HTTP/%s failed: %s", protocol, err)
+		}
+		if shouldbe := "localhost /containers/json?all=1"; string(call.Response.Body) != shouldbe {
+			t.Errorf("Expected %q with HTTP/%s, got %q", shouldbe, protocol, call.Response.Body)
+		}
+	}
+}
+
+func TestExecuteConnectTo(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(echoHostAndPath))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// The test certificate is for example.com, so TLS must use the URL's host
+	caFile, err := ioutil.TempFile("", "call-buddy-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caFile.Close()
+	client, err := (&telephono.ClientConfig{CACert: caFile.Name()}).NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := newTestEnvironment()
+	env.User.Mapping["POD"] = "127.0.0.1"
+	for _, connectTo := range []string{"{{User.POD}}", "127.0.0.1:" + port} {
+		template := telephono.RequestTemplate{
+			Method:    telephono.Get,
+			Url:       "https://example.com:" + port + "/healthz",
+			Headers:   http.Header{},
+			ConnectTo: connectTo,
+		}
+		call, err := template.ExecuteContext(context.Background(), client, &env)
+		if err != nil {
+			t.Fatalf("Execute with %s failed: %s", connectTo, err)
+		}
+		if shouldbe := "example.com:" + port + " /healthz"; string(call.Response.Body) != shouldbe {
+			t.Errorf("Expected %q, got %q", shouldbe, call.Response.Body)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package telephono
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	document := []byte(`{
+		"took": 3,
+		"hits": {"total": 3, "hits": [
+			{"_id": "a", "_source": {"name": "alice", "age": 31, "tags": ["x"]}},
+			{"_id": "b", "_source": {"name": "bob", "age": 25, "tags": []}},
+			{"_id": "c", "_source": {"name": "carol", "age": 40, "active": true}}
+		]},
+		"a key": "<&>"
+	}`)
+	tests := []struct {
+		expression string
+		shouldbe   string
+	}{
+		{".", `{"a key":"<&>","hits":{"hits":[{"_id":"a","_source":{"age":31,"name":"alice","tags":["x"]}},{"_id":"b","_source":{"age":25,"name":"bob","tags":[]}},{"_id":"c","_source":{"active":true,"age":40,"name":"carol"}}],"total":3},"took":3}`},
+		{".took", `3`},
+		{".hits.hits[0]._id", `"a"`},
+		{".hits.hits[-1]._id", `"c"`},
+		{".hits.hits[]._id", `"a" "b" "c"`},
+		{".hits.hits | length", `3`},
+		{`."a key"`, `"<&>"`},
+		{`.["a key"]`, `"<&>"`},
+		{".missing", `null`},
+		{".missing.deeper", `null`},
+		{".hits.hits[1:]|map(._id)", `["b","c"]`},
+		{".hits.hits[:1][]._id", `"a"`},
+		{"[.hits.hits[]._source.name]", `["alice","bob","carol"]`},
+		{`.hits.hits[] | select(._source.age > 30) | ._id`, `"a" "c"`},
+		{`.hits.hits[] | select(._source.name == "bob" or ._source.active) | ._id`, `"b" "c"`},
+		{`.hits.hits[] | select(._source.age >= 25 and (._source.tags | length) == 0) | ._id`, `"b" "c"`},
+		{`.hits.hits[] | select(._source | has("active")) | ._id`, `"c"`},
+		{`.hits.hits[0] | {id: ._id, name: ._source.name}`, `{"id":"a","name":"alice"}`},
+		{`.hits.hits[0]._source | {name, "the age": .age}`, `{"name":"alice","the age":31}`},
+		{`.hits.hits[0]._source | keys`, `["age","name","tags"]`},
+		{`.took, .hits.total`, `3 3`},
+		{`.took | type, tostring`, `"number" "3"`},
+		{`.hits.hits | first | ._id`, `"a"`},
+		{`[.. | ._id? | select(. != null)]`, `["a","b","c"]`},
+		{`.took[0]?`, ``},
+		{`.hits.hits[] | ._source.tags[]?`, `"x"`},
+		{`.hits.hits[] | empty`, ``},
+		{`$.hits.hits[*]._id`, `"a" "b" "c"`},
+	}
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			outputs, err := Filter(document, test.expression)
+			if err != nil {
+				t.Fatalf("Filter failed: %s", err)
+			}
+			var encoded []string
+			for _, output := range outputs {
+				encoded = append(encoded, strings.TrimSuffix(string(jsonQuoteValue(output)), "\n"))
+			}
+			if got := strings.Join(encoded, " "); got != test.shouldbe {
+				t.Errorf("Expected %s, got %s", test.shouldbe, got)
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []string{
+		".took[0]",
+		".took[]",
+		".hits |",
+		".hits[",
+		"(.hits",
+		"nosuch",
+		".hits.hits | keys | .[] | . < [1]",
+		`"unterminated`,
+		".a @",
+	}
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			if _, err := Filter([]byte(`{"took": 1, "hits": [{"a": 1}, {"b": 2}]}`), test); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if _, err := Filter([]byte(`not json`), "."); err == nil {
+		t.Error("Expected a not JSON error")
+	}
+}
+
+func TestFilterOutput(t *testing.T) {
+	output, err := FilterOutput([]interface{}{"a\tb", map[string]interface{}{"x": []interface{}{}}}, true, false)
+	if err != nil {
+		t.Fatalf("Output failed: %s", err)
+	}
+	if output != "a\tb\n{\n  \"x\": []\n}\n" {
+		t.Errorf("Unexpected output %q", output)
+	}
+
+	output, _ = FilterOutput([]interface{}{"a\tb"}, false, false)
+	if output != "\"a\\tb\"\n" {
+		t.Errorf("Unexpected output %q", output)
+	}
+}
@@ -1,8 +1,33 @@
 module github.com/call-buddy/call-buddy/telephono
 
-go 1.14
+go 1.21
 
-require github.com/cbroglie/mustache v1.0.1
+require (
+	filippo.io/age v1.0.0
+	github.com/cbroglie/mustache v1.0.1
+	github.com/gorilla/websocket v1.4.2
+	github.com/quic-go/quic-go v0.41.0
+	golang.org/x/net v0.11.0
+	google.golang.org/grpc v1.55.0
+	google.golang.org/protobuf v1.30.0
+)
+
+require (
+	github.com/go-task/slim-sprig v0.0.0-20230315185526-52ccab3ef572 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/pprof v0.0.0-20210720184732-4bb14d4b1be1 // indirect
+	github.com/onsi/ginkgo/v2 v2.9.5 // indirect
+	github.com/quic-go/qpack v0.4.0 // indirect
+	github.com/stretchr/testify v1.8.1 // indirect
+	go.uber.org/mock v0.3.0 // indirect
+	golang.org/x/crypto v0.10.0 // indirect
+	golang.org/x/exp v0.0.0-20221205204356-47842c84f3db // indirect
+	golang.org/x/mod v0.11.0 // indirect
+	golang.org/x/sys v0.9.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	golang.org/x/tools v0.9.1 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+)
 
 // require golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e
 
@@ -0,0 +1,126 @@
+package telephono_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+const graphQLTestSchema = `{"data": {"__schema": {
+  "queryType": {"name": "Query"},
+  "mutationType": null,
+  "subscriptionType": null,
+  "types": [
+    {"kind": "OBJECT", "name": "Query", "fields": [
+      {"name": "user", "description": "Finds a user", "args": [
+        {"name": "id", "type": {"kind": "NON_NULL", "name": null, "ofType": {"kind": "SCALAR", "name": "ID"}}, "defaultValue": null}
+      ], "type": {"kind": "OBJECT", "name": "User"}}
+    ]},
+    {"kind": "OBJECT", "name": "User", "fields": [
+      {"name": "name", "args": [], "type": {"kind": "SCALAR", "name": "String"}},
+      {"name": "roles", "args": [], "type": {"kind": "NON_NULL", "name": null, "ofType": {"kind": "LIST", "name": null, "ofType": {"kind": "ENUM", "name": "Role"}}}}
+    ]},
+    {"kind": "ENUM", "name": "Role", "enumValues": [{"name": "ADMIN"}, {"name": "GUEST"}]},
+    {"kind": "SCALAR", "name": "ID"},
+    {"kind": "OBJECT", "name": "__Type", "fields": []}
+  ]
+}}}`
+
+func graphQLTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var envelope struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &envelope); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON envelope, got %s %q", r.Header.Get("Content-Type"), body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(envelope.Query, "__schema") {
+			w.Write([]byte(graphQLTestSchema))
+			return
+		}
+		if envelope.Variables["id"] != "42" {
+			w.Write([]byte(`{"data": {"user": null}, "errors": [{"message": "No user", "path": ["user", 0], "locations": [{"line": 1, "column": 3}]}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"user": {"name": "Ada"}}}`))
+	}))
+}
+
+func TestExecuteGraphQL(t *testing.T) {
+	server := graphQLTestServer(t)
+	defer server.Close()
+
+	env := newTestEnvironment()
+	env.User.Mapping["id"] = "42"
+	template := telephono.RequestTemplate{
+		Method:    telephono.Post,
+		Url:       server.URL,
+		Headers:   http.Header{},
+		Body:      "query($id: ID!) { user(id: $id) { name } }",
+		GraphQL:   true,
+		Variables: `{"id": "{{User.id}}"}`,
+	}
+	call, err := template.ExecuteContext(context.Background(), http.DefaultClient, &env)
+	if err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	if errs := telephono.GraphQLErrors(call.Response.Body); errs != nil {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+	if !strings.Contains(string(call.Request.Body), `"variables":{"id":"42"}`) {
+		t.Errorf("Expected the variables in the envelope, got %s", call.Request.Body)
+	}
+
+	template.Variables = ""
+	call, err = template.ExecuteContext(context.Background(), http.DefaultClient, &env)
+	if err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	errs := telephono.GraphQLErrors(call.Response.Body)
+	if len(errs) != 1 || errs[0].String() != "No user (at user.0, line 1:3)" {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	template.Variables = "[1]"
+	if _, err = template.ExecuteContext(context.Background(), http.DefaultClient, &env); err == nil {
+		t.Errorf("Expected variables that aren't an object to fail")
+	}
+}
+
+func TestIntrospectGraphQL(t *testing.T) {
+	server := graphQLTestServer(t)
+	defer server.Close()
+
+	env := newTestEnvironment()
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL, Headers: http.Header{}}
+	schema, err := template.IntrospectGraphQL(context.Background(), http.DefaultClient, &env)
+	if err != nil {
+		t.Fatalf("Introspection failed: %s", err)
+	}
+
+	described, err := schema.Describe("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shouldbe := "type Query {\n  user(id: ID!): User  # Finds a user\n}\n\nOther types:\n  enum         Role\n  object       User\n  scalar       ID\n"
+	if described != shouldbe {
+		t.Errorf("Expected %q, got %q", shouldbe, described)
+	}
+
+	described, _ = schema.Describe("User")
+	if shouldbe := "type User {\n  name: String\n  roles: [Role]!\n}\n"; described != shouldbe {
+		t.Errorf("Expected %q, got %q", shouldbe, described)
+	}
+	if _, err = schema.Describe("Nope"); err == nil {
+		t.Errorf("Expected an unknown type to fail")
+	}
+}
@@ -0,0 +1,172 @@
+package telephono_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+func grpcTestServer(t *testing.T, options ...grpc.ServerOption) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(options...)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("users", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+	go server.Serve(listener)
+	return "grpc://" + listener.Addr().String(), server.Stop
+}
+
+func TestParseGrpcUrl(t *testing.T) {
+	tests := []struct {
+		url      string
+		shouldbe telephono.GrpcTarget
+	}{
+		{"grpc://localhost:50051", telephono.GrpcTarget{Address: "localhost:50051"}},
+		{"grpcs://api.example.com/pkg.Users/Get", telephono.GrpcTarget{Address: "api.example.com:443", TLS: true, Service: "pkg.Users", Method: "Get"}},
+		{"grpc://localhost:50051/pkg.Users.Get", telephono.GrpcTarget{Address: "localhost:50051", Service: "pkg.Users", Method: "Get"}},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			target, err := telephono.ParseGrpcUrl(test.url)
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			if target != test.shouldbe {
+				t.Errorf("Expected %+v, got %+v", test.shouldbe, target)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"http://localhost", "grpc://", "grpc:///pkg.Users/Get"} {
+		if _, err := telephono.ParseGrpcUrl(invalid); err == nil {
+			t.Errorf("Expected %s to fail", invalid)
+		}
+	}
+}
+
+func TestDescribeGrpc(t *testing.T) {
+	url, stop := grpcTestServer(t)
+	defer stop()
+
+	services, err := telephono.DescribeGrpc(context.Background(), http.DefaultClient, url)
+	if err != nil {
+		t.Fatalf("Describe failed: %s", err)
+	}
+	if !strings.Contains(services, "grpc.health.v1.Health\n  Check(grpc.health.v1.HealthCheckRequest) returns (grpc.health.v1.HealthCheckResponse)\n") ||
+		!strings.Contains(services, "Watch(grpc.health.v1.HealthCheckRequest) returns (stream grpc.health.v1.HealthCheckResponse)") {
+		t.Errorf("Expected the health service, got\n%s", services)
+	}
+	if strings.Contains(services, "ServerReflection") {
+		t.Errorf("Expected reflection to be left out, got\n%s", services)
+	}
+
+	method, err := telephono.DescribeGrpc(context.Background(), http.DefaultClient, url+"/grpc.health.v1.Health/Check")
+	if err != nil {
+		t.Fatalf("Describe failed: %s", err)
+	}
+	if !strings.Contains(method, "string service = 1; // JSON: service") || !strings.Contains(method, "grpc.health.v1.HealthCheckResponse.ServingStatus status = 1;") {
+		t.Errorf("Expected the messages, got\n%s", method)
+	}
+
+	if _, err := telephono.DescribeGrpc(context.Background(), http.DefaultClient, url+"/nope.Service"); err == nil {
+		t.Errorf("Expected an unknown service to fail")
+	}
+}
+
+func TestExecuteGrpc(t *testing.T) {
+	url, stop := grpcTestServer(t)
+	defer stop()
+	env := newTestEnvironment()
+	env.User.Set("SERVICE", "users")
+
+	tests := []struct {
+		body       string
+		statusCode int
+		contains   string
+	}{
+		{"", 200, `"status":"SERVING"`},
+		{`{"service": "{{User.SERVICE}}"}`, 200, `"status":"NOT_SERVING"`},
+		{`{"service": "missing"}`, 404, `"code":5`},
+	}
+	for _, test := range tests {
+		t.Run(test.body, func(t *testing.T) {
+			template := telephono.RequestTemplate{Method: telephono.Post, Url: url + "/grpc.health.v1.Health/Check", Headers: http.Header{}, Body: test.body}
+			template.Headers.Set("X-Request-Id", "1")
+			call, err := template.Execute(http.DefaultClient, &env)
+			if err != nil {
+				t.Fatalf("Call failed: %s", err)
+			}
+			if call.Response.StatusCode != test.statusCode {
+				t.Errorf("Expected %d, got %s", test.statusCode, call.Response.Status)
+			}
+			if body := strings.Replace(string(call.Response.Body), " ", "", -1); !strings.Contains(body, test.contains) {
+				t.Errorf("Expected %s in the body, got %s", test.contains, body)
+			}
+			if call.Response.BodyFormat() != telephono.JsonBody {
+				t.Errorf("Expected the body to be shown as JSON")
+			}
+		})
+	}
+
+	for _, invalid := range []string{url + "/grpc.health.v1.Health/Watch", url + "/grpc.health.v1.Health/Nope", url + "/grpc.health.v1.Health"} {
+		template := telephono.RequestTemplate{Method: telephono.Post, Url: invalid, Headers: http.Header{}}
+		if _, err := template.Execute(http.DefaultClient, &env); err == nil {
+			t.Errorf("Expected calling %s to fail", invalid)
+		}
+	}
+	template := telephono.RequestTemplate{Method: telephono.Post, Url: url + "/grpc.health.v1.Health/Check", Headers: http.Header{}, Body: `{"nope": 1}`}
+	if _, err := template.Execute(http.DefaultClient, &env); err == nil || !strings.Contains(err.Error(), "HealthCheckRequest") {
+		t.Errorf("Expected a bad body to fail, got %v", err)
+	}
+}
+
+func TestExecuteGrpcAuth(t *testing.T) {
+	// Only calls to the health service need the token, not reflection
+	url, stop := grpcTestServer(t, grpc.UnaryInterceptor(func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if authorization := md.Get("authorization"); len(authorization) != 1 || authorization[0] != "Bearer t0ken" {
+			return nil, status.Error(codes.Unauthenticated, "Expected the token, got "+strings.Join(authorization, ", "))
+		}
+		return handler(ctx, request)
+	}))
+	defer stop()
+	env := newTestEnvironment()
+	env.User.Set("TOKEN", "t0ken")
+	env.User.Set(telephono.OAuth2AccessToken, "t0ken")
+
+	for _, auth := range []telephono.Auth{{Type: telephono.BearerAuth, Token: "{{User.TOKEN}}"}, {Type: telephono.OAuth2Auth}} {
+		template := telephono.RequestTemplate{Method: telephono.Post, Url: url + "/grpc.health.v1.Health/Check", Headers: http.Header{}, Auth: &auth}
+		call, err := template.Execute(http.DefaultClient, &env)
+		if err != nil {
+			t.Fatalf("Call failed: %s", err)
+		}
+		if call.Response.StatusCode != 200 {
+			t.Errorf("Expected %s authentication to be sent, got %s", auth.Type, call.Response.Body)
+		}
+		if call.Request.Header.Get("Authorization") != "Bearer t0ken" {
+			t.Errorf("Expected the authorization in the history, got %v", call.Request.Header)
+		}
+	}
+
+	for _, auth := range []telephono.Auth{{Type: telephono.DigestAuth, Username: "alice", Password: "secret"}, {Type: telephono.AWSAuth, AccessKey: "AKID", SecretKey: "secret", Region: "us-east-1", Service: "execute-api"}} {
+		template := telephono.RequestTemplate{Method: telephono.Post, Url: url + "/grpc.health.v1.Health/Check", Headers: http.Header{}, Auth: &auth}
+		if _, err := template.Execute(http.DefaultClient, &env); err == nil || !strings.Contains(err.Error(), "gRPC") {
+			t.Errorf("Expected %s authentication to fail for gRPC, got %v", auth.Type, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package telephono
+
+import (
+	"testing"
+)
+
+func TestJsonPathString(t *testing.T) {
+	document := []byte(`{"user": {"name": "alice", "id": 12345678901234567890, "tags": ["a", "b", "c"]}, "a key": true, "items": [{"id": 1}, {"id": 2}]}`)
+	tests := []struct {
+		path     string
+		shouldbe string
+	}{
+		{"$.user.name", "alice"},
+		{"user.name", "alice"},
+		{"$.user.id", "12345678901234567890"},
+		{"$.user.tags[1]", "b"},
+		{"$.user.tags[-1]", "c"},
+		{"$['a key']", "true"},
+		{"$.items[0]", `{"id":1}`},
+		{"$.user.tags", `["a","b","c"]`},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			value, err := JsonPathString(document, test.path)
+			if err != nil {
+				t.Fatalf("Failed: %s", err)
+			}
+			if value != test.shouldbe {
+				t.Errorf("Expected %s, got %s", test.shouldbe, value)
+			}
+		})
+	}
+}
+
+func TestJsonPathWildcard(t *testing.T) {
+	values, err := JsonPath([]byte(`{"items": [{"id": 1}, {"id": 2}, {"name": "x"}]}`), "$.items[*].id")
+	if err != nil {
+		t.Fatalf("Failed: %s", err)
+	}
+	if len(values) != 2 || jsonValueString(values[0]) != "1" || jsonValueString(values[1]) != "2" {
+		t.Errorf("Expected [1 2], got %v", values)
+	}
+}
+
+func TestJsonPathErrors(t *testing.T) {
+	tests := []struct {
+		document string
+		path     string
+	}{
+		{`{"a": 1}`, "$.b"},
+		{`{"a": [1, 2]}`, "$.a[*]"},
+		{`{"a": [1, 2]}`, "$.a[x]"},
+		{`{"a": [1, 2]}`, "$.a[0"},
+		{`{"a": 1}`, "$..a"},
+		{`not json`, "$.a"},
+		{`{"a": 1} {"a": 2}`, "$.a"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if _, err := JsonPathString([]byte(test.document), test.path); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -19,3 +19,44 @@ func TestHttpMethodAsString(t *testing.T) {
 		})
 	}
 }
+
+func TestToHttpMethod(t *testing.T) {
+	tests := []struct {
+		method   string
+		shouldbe HttpMethod
+		custom   bool
+	}{
+		{"get", Get, false},
+		{"Patch", Patch, false},
+		{"OPTIONS", Options, false},
+		{"trace", Trace, false},
+		{"CONNECT", Connect, false},
+		{"PROPFIND", "PROPFIND", true},
+		{"_search", "_search", true},
+		{"Purge", "Purge", true},
+	}
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			method, err := ToHttpMethod(test.method)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if method != test.shouldbe {
+				t.Errorf("Expected %s, got %s", test.shouldbe, method)
+			}
+			if method.IsCustom() != test.custom {
+				t.Errorf("Expected custom to be %t", test.custom)
+			}
+		})
+	}
+}
+
+func TestToHttpMethodInvalid(t *testing.T) {
+	for _, method := range []string{"", "GET POST", "GE/T", "métode"} {
+		t.Run(method, func(t *testing.T) {
+			if _, err := ToHttpMethod(method); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
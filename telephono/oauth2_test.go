@@ -0,0 +1,173 @@
+package telephono_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+func TestParseOAuth2(t *testing.T) {
+	tests := []struct {
+		args     []string
+		shouldbe string
+	}{
+		{[]string{"client-credentials", "https://auth/token", "api", "secret", "read", "write"}, "client-credentials https://auth/token api ******** read write"},
+		{[]string{"password", "https://auth/token", "cli", "-", "alice", "{{User.PASSWORD}}"}, "password https://auth/token cli - alice {{User.PASSWORD}}"},
+		{[]string{"refresh-token", "https://auth/token", "cli", "-", "r3fresh"}, "refresh-token https://auth/token cli - ********"},
+	}
+	for _, test := range tests {
+		config, err := telephono.ParseOAuth2(test.args)
+		if err != nil {
+			t.Errorf("Parsing %v failed: %s", test.args, err)
+		} else if config.String() != test.shouldbe {
+			t.Errorf("Expected %s, got %s", test.shouldbe, config)
+		}
+	}
+
+	for _, invalid := range [][]string{{}, {"implicit", "u", "id", "secret"}, {"password", "u", "id", "secret", "alice"}, {"refresh-token", "u", "id", "-"}} {
+		if _, err := telephono.ParseOAuth2(invalid); err == nil {
+			t.Errorf("Expected %v to fail", invalid)
+		}
+	}
+}
+
+// oauth2Server Hands out access-1, access-2... which the API accepts until
+// the next one is handed out
+type oauth2Server struct {
+	tokens int
+	grants []string
+}
+
+func (server *oauth2Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		r.ParseForm()
+		if id, secret, _ := r.BasicAuth(); id != "api" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"Unknown client"}`))
+			return
+		}
+		server.grants = append(server.grants, r.PostForm.Get("grant_type"))
+		server.tokens++
+		fmt.Fprintf(w, `{"access_token":"access-%d","token_type":"bearer","expires_in":3600,"refresh_token":"refresh-%d"}`, server.tokens, server.tokens)
+		return
+	}
+	if r.Header.Get("Authorization") != fmt.Sprintf("Bearer access-%d", server.tokens) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func TestExecuteOAuth2(t *testing.T) {
+	tokenServer := &oauth2Server{}
+	server := httptest.NewServer(tokenServer)
+	defer server.Close()
+
+	config := &telephono.OAuth2Config{Grant: telephono.ClientCredentialsGrant, TokenUrl: server.URL + "/token", ClientID: "api", ClientSecret: "{{User.SECRET}}"}
+	env := newTestEnvironment()
+	env.User.Mapping["SECRET"] = "secret"
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL + "/me", Headers: http.Header{}, Auth: &telephono.Auth{Type: telephono.OAuth2Auth}}
+	execute := func(shouldbe string) {
+		t.Helper()
+		call, err := template.ExecuteOAuth2(context.Background(), http.DefaultClient, &env, config, telephono.BodyLimit{})
+		if err != nil {
+			t.Fatalf("Execute failed: %s", err)
+		}
+		if call.Response.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", call.Response.StatusCode)
+		}
+		if token := env.User.Mapping[telephono.OAuth2AccessToken]; token != shouldbe {
+			t.Errorf("Expected the token %s, got %s", shouldbe, token)
+		}
+	}
+
+	// The first call gets a token, the second one uses it
+	execute("access-1")
+	execute("access-1")
+	if expires, err := time.Parse(time.RFC3339, env.User.Mapping[telephono.OAuth2Expires]); err != nil || time.Until(expires) < 59*time.Minute {
+		t.Errorf("Unexpected expiry %s", env.User.Mapping[telephono.OAuth2Expires])
+	}
+
+	// Expired tokens are refreshed before the call
+	env.User.Mapping[telephono.OAuth2Expires] = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	execute("access-2")
+
+	// Revoked tokens are refreshed once the server refuses them
+	tokenServer.tokens++
+	execute("access-4")
+
+	shouldbe := []string{telephono.ClientCredentialsGrant, telephono.RefreshTokenGrant, telephono.RefreshTokenGrant}
+	if fmt.Sprint(tokenServer.grants) != fmt.Sprint(shouldbe) {
+		t.Errorf("Expected the grants %v, got %v", shouldbe, tokenServer.grants)
+	}
+
+	// Token endpoint errors are reported
+	delete(env.User.Mapping, telephono.OAuth2AccessToken)
+	env.User.Mapping["SECRET"] = "wrong"
+	if _, err := template.ExecuteOAuth2(context.Background(), http.DefaultClient, &env, config, telephono.BodyLimit{}); err == nil {
+		t.Errorf("Expected a refused client to fail")
+	}
+	if _, err := template.ExecuteOAuth2(context.Background(), http.DefaultClient, &env, nil, telephono.BodyLimit{}); err == nil {
+		t.Errorf("Expected a missing configuration to fail")
+	}
+}
+
+func TestSaveOAuth2Tokens(t *testing.T) {
+	tokenServer := &oauth2Server{}
+	server := httptest.NewServer(tokenServer)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "call-buddy-oauth2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state-default.json")
+
+	config := &telephono.OAuth2Config{Grant: telephono.ClientCredentialsGrant, TokenUrl: server.URL + "/token", ClientID: "api", ClientSecret: "secret"}
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL + "/me", Headers: http.Header{}, Auth: &telephono.Auth{Type: telephono.OAuth2Auth}}
+	for _, unlocked := range []bool{false, true} {
+		state := telephono.InitNewState()
+		if unlocked {
+			if err := state.Environment.User.Unlock(newAgeKey(t)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		call, err := template.ExecuteOAuth2(context.Background(), http.DefaultClient, &state.Environment, config, telephono.BodyLimit{})
+		if err != nil || call.Response.StatusCode != http.StatusOK {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		_, encrypted := state.Environment.User.Secrets[telephono.OAuth2AccessToken]
+		if encrypted != unlocked {
+			t.Errorf("Expected the token to be encrypted only while unlocked, got %v unlocked %v", encrypted, unlocked)
+		}
+
+		if err := state.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, token := range []string{"access-", "refresh-"} {
+			if strings.Contains(string(saved), token) {
+				t.Errorf("Expected no plaintext %s token in the saved state, unlocked %v", token, unlocked)
+			}
+		}
+		// The session keeps using the token
+		if _, err := template.ExecuteOAuth2(context.Background(), http.DefaultClient, &state.Environment, config, telephono.BodyLimit{}); err != nil {
+			t.Fatalf("Execute failed: %s", err)
+		}
+	}
+	if len(tokenServer.grants) != 2 {
+		t.Errorf("Expected a token per state, got the grants %v", tokenServer.grants)
+	}
+}
@@ -0,0 +1,166 @@
+package telephono
+
+import (
+	"strings"
+	"testing"
+)
+
+const postmanCollection = `{
+	"info": {
+		"name": "Pet Store",
+		"schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+	},
+	"variable": [{"key": "baseUrl", "value": "http://localhost:8080"}],
+	"item": [
+		{
+			"name": "pets",
+			"item": [
+				{
+					"name": "List pets",
+					"request": {
+						"method": "GET",
+						"header": [
+							{"key": "Authorization", "value": "Bearer {{token}}"},
+							{"key": "X-Debug", "value": "1", "disabled": true}
+						],
+						"url": {"raw": "{{baseUrl}}/pets?id={{$guid}}", "host": ["{{baseUrl}}"]}
+					}
+				},
+				{
+					"name": "Create pet",
+					"request": {
+						"method": "POST",
+						"body": {"mode": "raw", "raw": "{\"name\": \"{{ petName }}\"}", "options": {"raw": {"language": "json"}}},
+						"url": "{{baseUrl}}/pets"
+					}
+				}
+			]
+		},
+		{
+			"name": "Login",
+			"request": {
+				"method": "POST",
+				"body": {"mode": "urlencoded", "urlencoded": [{"key": "user", "value": "{{user}}"}, {"key": "pass", "value": "a b"}, {"key": "pet name", "value": "{{ petName }} & co"}, {"key": "id", "value": "{{$guid}}"}]},
+				"url": "{{baseUrl}}/login"
+			}
+		},
+		{
+			"name": "Upload",
+			"request": {"method": "POST", "body": {"mode": "file"}, "url": "{{baseUrl}}/upload"}
+		},
+		{"name": "Login", "request": "{{baseUrl}}/login"}
+	]
+}`
+
+func TestImportPostmanCollection(t *testing.T) {
+	imported, err := ImportPostman(strings.NewReader(postmanCollection))
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+
+	if imported.Variables["baseUrl"] != "http://localhost:8080" {
+		t.Errorf("Collection variable wasn't imported: %v", imported.Variables)
+	}
+	if len(imported.Skipped) != 1 {
+		t.Errorf("Expected the file body request to be skipped, got %v", imported.Skipped)
+	}
+
+	list, err := imported.Collection.Get("Pet_Store/pets/List_pets")
+	if err != nil {
+		t.Fatalf("Folder request wasn't imported: %s", err)
+	}
+	if list.Url != "{{User.baseUrl}}/pets?id={{$guid}}" {
+		t.Errorf("Unexpected url %s", list.Url)
+	}
+	if list.Headers.Get("Authorization") != "Bearer {{User.token}}" || list.Headers.Get("X-Debug") != "" {
+		t.Errorf("Unexpected headers %v", list.Headers)
+	}
+
+	create, _ := imported.Collection.Get("Pet_Store/pets/Create_pet")
+	if create == nil || create.Method != Post || create.Body != `{"name": "{{User.petName}}"}` {
+		t.Fatalf("Unexpected raw body request %+v", create)
+	}
+	if create.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected a JSON content type, got %s", create.Headers.Get("Content-Type"))
+	}
+
+	login, _ := imported.Collection.Get("Pet_Store/Login")
+	if login == nil || login.Body != "user={{User.user}}&pass=a+b&pet+name={{User.petName}}+%26+co&id={{$guid}}" {
+		t.Fatalf("Unexpected urlencoded request %+v", login)
+	}
+
+	// Requests with the same name don't replace each other
+	again, _ := imported.Collection.Get("Pet_Store/Login_2")
+	if again == nil || again.Method != Get || again.Url != "{{User.baseUrl}}/login" {
+		t.Errorf("Unexpected URL only request %+v", again)
+	}
+}
+
+func TestImportPostmanEnvironment(t *testing.T) {
+	environment := `{
+		"name": "staging",
+		"values": [
+			{"key": "token", "value": "abc", "enabled": true},
+			{"key": "old", "value": "xyz", "enabled": false}
+		]
+	}`
+	imported, err := ImportPostman(strings.NewReader(environment))
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if len(imported.Collection.RequestTemplates) != 0 {
+		t.Error("Environments shouldn't have requests")
+	}
+	if imported.Variables["token"] != "abc" {
+		t.Errorf("Expected token to be imported: %v", imported.Variables)
+	}
+	if _, found := imported.Variables["old"]; found {
+		t.Error("Disabled values shouldn't be imported")
+	}
+}
+
+func TestImportPostmanVariableNames(t *testing.T) {
+	collection := `{
+		"info": {"name": "API"},
+		"variable": [{"key": "base url", "value": "http://localhost:8080"}, {"key": "api.key", "value": "k3y"}],
+		"item": [{
+			"name": "Get",
+			"request": {
+				"method": "GET",
+				"header": [{"key": "X-Api-Key", "value": "{{api.key}}"}, {"key": "X-Request-Id", "value": "{{ request-id }}"}],
+				"url": "{{base url}}/items"
+			}
+		}]
+	}`
+	imported, err := ImportPostman(strings.NewReader(collection))
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	get, err := imported.Collection.Get("API/Get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get.Url != "{{User.base_url}}/items" || get.Headers.Get("X-Request-Id") != "{{User.request_id}}" {
+		t.Errorf("Unexpected placeholders %s %v", get.Url, get.Headers)
+	}
+
+	// The placeholders expand to the imported variables
+	user := Environment{Name: "User", Mapping: imported.Variables}
+	if expanded := user.Expand(get.Url + " " + get.Headers.Get("X-Api-Key")); expanded != "http://localhost:8080/items k3y" {
+		t.Errorf("Expected the variables to be expanded, got %q from %v", expanded, imported.Variables)
+	}
+
+	environment := `{"name": "staging", "values": [{"key": "api.key", "value": "abc"}]}`
+	if imported, err = ImportPostman(strings.NewReader(environment)); err != nil || imported.Variables["api_key"] != "abc" {
+		t.Errorf("Expected api_key to be imported: %v %v", imported.Variables, err)
+	}
+}
+
+func TestImportPostmanInvalid(t *testing.T) {
+	if _, err := ImportPostman(strings.NewReader(`{"hello": "world"}`)); err == nil {
+		t.Error("Expected an error for a non Postman file")
+	}
+	if _, err := ImportPostman(strings.NewReader(`{"info": {"schema": "v2.0.0"}, "item": []}`)); err == nil {
+		t.Error("Expected an error for an older collection schema")
+	}
+}
@@ -0,0 +1,134 @@
+package telephono
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDetectBodyFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		shouldbe    BodyFormat
+	}{
+		{"application/json; charset=utf-8", `{}`, JsonBody},
+		{"application/problem+json", `{}`, JsonBody},
+		{"text/html; charset=UTF-8", `<p>hi</p>`, HtmlBody},
+		{"application/atom+xml", `<feed/>`, XmlBody},
+		{"application/x-yaml", `a: 1`, YamlBody},
+		{"text/css", `{}`, PlainBody},
+		{"", ` [1, 2]`, JsonBody},
+		{"text/plain", `{not json`, PlainBody},
+		{"", `<!DOCTYPE html><html></html>`, HtmlBody},
+		{"application/octet-stream", `<?xml version="1.0"?><a/>`, XmlBody},
+		{"", ``, PlainBody},
+	}
+	for _, test := range tests {
+		t.Run(test.contentType+" "+test.body, func(t *testing.T) {
+			if format := DetectBodyFormat(test.contentType, []byte(test.body)); format != test.shouldbe {
+				t.Errorf("Expected %s, got %s", test.shouldbe, format)
+			}
+		})
+	}
+}
+
+func TestFormatBody(t *testing.T) {
+	tests := []struct {
+		format   BodyFormat
+		body     string
+		shouldbe string
+	}{
+		{JsonBody, `{"b":1,"a":[true,null,{}],"c":"<&>","d":12345678901234567890}`, `{
+  "b": 1,
+  "a": [
+    true,
+    null,
+    {}
+  ],
+  "c": "<&>",
+  "d": 12345678901234567890
+}
+`},
+		{XmlBody, `<?xml version="1.0"?><a x="1 &amp; 2"><b>text &lt;</b><c/><d><e>1</e></d></a>`, `<?xml version="1.0"?>
+<a x="1 &amp; 2">
+  <b>text &lt;</b>
+  <c/>
+  <d>
+    <e>1</e>
+  </d>
+</a>
+`},
+		{HtmlBody, `<!DOCTYPE html><html><body><p>Hi<br>there</p><input disabled></body></html>`, `<!DOCTYPE html>
+<html>
+  <body>
+    <p>
+      Hi
+      <br>
+      there
+    </p>
+    <input disabled="disabled">
+  </body>
+</html>
+`},
+		{YamlBody, "a: 1\n", "a: 1\n"},
+		{PlainBody, "as is", "as is"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			formatted, err := FormatBody(test.format, []byte(test.body), false)
+			if err != nil {
+				t.Fatalf("Format failed: %s", err)
+			}
+			if formatted != test.shouldbe {
+				t.Errorf("Expected\n%s\ngot\n%s", test.shouldbe, formatted)
+			}
+		})
+	}
+}
+
+func TestFormatBodyColored(t *testing.T) {
+	formatted, err := FormatBody(JsonBody, []byte(`{"a": "b"}`), true)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if formatted != "{\n  "+keyColor+`"a"`+ansiReset+": "+stringColor+`"b"`+ansiReset+"\n}\n" {
+		t.Errorf("Unexpected colors %q", formatted)
+	}
+
+	formatted, _ = FormatBody(YamlBody, []byte("# comment\n- name: x # why\n  url: 'http://a#b'\n"), true)
+	shouldbe := commentColor + "# comment" + ansiReset + "\n- " + keyColor + "name" + ansiReset + ": x" + commentColor + " # why" + ansiReset + "\n  " + keyColor + "url" + ansiReset + ": 'http://a#b'\n"
+	if formatted != shouldbe {
+		t.Errorf("Expected %q, got %q", shouldbe, formatted)
+	}
+}
+
+func TestFormatBodyErrors(t *testing.T) {
+	tests := []struct {
+		format BodyFormat
+		body   string
+	}{
+		{JsonBody, `{"a": }`},
+		{JsonBody, `{} {}`},
+		{XmlBody, `<a><b></a>`},
+		{XmlBody, `<a>`},
+	}
+	for _, test := range tests {
+		t.Run(test.body, func(t *testing.T) {
+			formatted, err := FormatBody(test.format, []byte(test.body), false)
+			if err == nil {
+				t.Error("Expected an error")
+			}
+			if formatted != test.body {
+				t.Errorf("Expected the body as is, got %s", formatted)
+			}
+		})
+	}
+}
+
+func TestFormatHeaders(t *testing.T) {
+	header := http.Header{"X-B": {"1", "2"}, "Content-Type": {"text/plain"}}
+	shouldbe := "Content-Type: text/plain\nX-B: 1, 2\n"
+	if formatted := FormatHeaders(header, false); formatted != shouldbe {
+		t.Errorf("Expected %q, got %q", shouldbe, formatted)
+	}
+}
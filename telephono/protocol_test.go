@@ -0,0 +1,145 @@
+package telephono_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func protocolTestCall(t *testing.T, config telephono.ClientConfig, url string) (telephono.HistoricalCall, error) {
+	client, err := config.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient failed: %s", err)
+	}
+	env := newTestEnvironment()
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: url, Headers: http.Header{}}
+	return template.ExecuteContext(context.Background(), client, &env)
+}
+
+func TestClientConfigProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		protocol, shouldbe string
+	}{
+		{"", "HTTP/2.0"},
+		{telephono.HTTP11, "HTTP/1.1"},
+		{telephono.HTTP2, "HTTP/2.0"},
+		{telephono.H2C, "HTTP/2.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.protocol, func(t *testing.T) {
+			call, err := protocolTestCall(t, telephono.ClientConfig{Insecure: true, Protocol: test.protocol}, server.URL)
+			if err != nil {
+				t.Fatalf("Execute failed: %s", err)
+			}
+			if call.Response.Proto != test.shouldbe || string(call.Response.Body) != test.shouldbe {
+				t.Errorf("Expected %s, got %s answered with %s", test.shouldbe, call.Response.Body, call.Response.Proto)
+			}
+		})
+	}
+
+	http1Server := httptest.NewTLSServer(handler)
+	defer http1Server.Close()
+	if _, err := protocolTestCall(t, telephono.ClientConfig{Insecure: true, Protocol: telephono.HTTP2}, http1Server.URL); err == nil {
+		t.Errorf("Expected forcing HTTP/2 on a server without it to fail")
+	}
+}
+
+func TestClientConfigH2C(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}), &http2.Server{}))
+	defer server.Close()
+
+	call, err := protocolTestCall(t, telephono.ClientConfig{Protocol: telephono.H2C}, server.URL)
+	if err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	if call.Response.Proto != "HTTP/2.0" || string(call.Response.Body) != "HTTP/2.0" {
+		t.Errorf("Expected h2c, got %s answered with %s", call.Response.Body, call.Response.Proto)
+	}
+	if report := call.GetSimpleReport(); !strings.Contains(report, "[HTTP/2.0]") {
+		t.Errorf("Expected the protocol in the report, got %s", report)
+	}
+
+	if _, err := (&telephono.ClientConfig{Protocol: telephono.H2C, Proxy: "localhost:3128"}).NewClient(); err == nil {
+		t.Errorf("Expected h2c through a proxy to fail")
+	}
+}
+
+func TestTemplateProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	// The HTTP/3 server uses the certificate of the HTTP/2 one, on the same
+	// port but over UDP
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	udp, err := net.ListenPacket("udp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3Server := &http3.Server{Handler: handler, TLSConfig: &tls.Config{Certificates: server.TLS.Certificates}}
+	go h3Server.Serve(udp)
+	defer h3Server.Close()
+
+	client, err := (&telephono.ClientConfig{Insecure: true}).NewClient()
+	if err != nil {
+		t.Fatalf("NewClient failed: %s", err)
+	}
+	env := newTestEnvironment()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	tests := []struct {
+		protocol, url, connectTo, shouldbe string
+	}{
+		{"", server.URL, "", "HTTP/2.0"},
+		{"1.1", server.URL, "", "HTTP/1.1"},
+		{"h3", server.URL, "", "HTTP/3.0"},
+		{"3", "https://call-buddy.test:" + port, "127.0.0.1", "HTTP/3.0"},
+		{"1.1", "https://call-buddy.test:" + port, "127.0.0.1", "HTTP/1.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.protocol+test.connectTo, func(t *testing.T) {
+			template := telephono.RequestTemplate{Method: telephono.Get, Url: test.url, Headers: http.Header{}, ConnectTo: test.connectTo}
+			if err := template.SetProtocol(test.protocol); err != nil {
+				t.Fatalf("SetProtocol failed: %s", err)
+			}
+			call, err := template.Execute(client, &env)
+			if err != nil {
+				t.Fatalf("Execute failed: %s", err)
+			}
+			if call.Response.Proto != test.shouldbe || string(call.Response.Body) != test.shouldbe {
+				t.Errorf("Expected %s, got %s answered with %s", test.shouldbe, call.Response.Body, call.Response.Proto)
+			}
+		})
+	}
+
+	template := telephono.RequestTemplate{}
+	if err := template.SetProtocol("spdy"); err == nil {
+		t.Errorf("Expected an unknown version to fail")
+	}
+	if err := template.SetProtocol("off"); err != nil || template.Protocol != "" {
+		t.Errorf("Expected off to use the profile's version, got %q: %v", template.Protocol, err)
+	}
+	if _, err := (&telephono.ClientConfig{Protocol: telephono.HTTP3, Proxy: "localhost:3128"}).NewClient(); err == nil {
+		t.Errorf("Expected HTTP/3 through a proxy to fail")
+	}
+}
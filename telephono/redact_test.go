@@ -0,0 +1,103 @@
+package telephono_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+func newSensitiveCall() telephono.HistoricalCall {
+	return telephono.HistoricalCall{
+		Request: telephono.Request{
+			Method:  telephono.Post,
+			URL:     "https://api.example.com/login?access_token=t0ken&page=2",
+			Header:  http.Header{"Authorization": {"Bearer t0ken"}, "Accept": {"application/json"}},
+			Body:    []byte(`{"user":"alice","password":"hunter2"}`),
+			Cookies: []string{"session=s3ss10n"},
+		},
+		Response: telephono.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Set-Cookie": {"session=s3ss10n"}, "Content-Type": {"application/json"}},
+			Body:       []byte(`{"access_token":"t0ken"}`),
+		},
+	}
+}
+
+func TestRedactCall(t *testing.T) {
+	call := newSensitiveCall()
+	redaction := telephono.DefaultRedaction()
+	redacted := redaction.Call(call)
+	if redacted.Request.Header.Get("Authorization") != telephono.Redacted || redacted.Response.Header.Get("Set-Cookie") != telephono.Redacted {
+		t.Errorf("Expected the default headers to be redacted, got %v and %v", redacted.Request.Header, redacted.Response.Header)
+	}
+	if redacted.Request.Header.Get("Accept") != "application/json" {
+		t.Errorf("Expected other headers to be kept, got %v", redacted.Request.Header)
+	}
+	if redacted.Request.Cookies[0] != "session="+telephono.Redacted {
+		t.Errorf("Expected the sent cookies to be redacted, got %v", redacted.Request.Cookies)
+	}
+	if call.Request.Header.Get("Authorization") != "Bearer t0ken" || call.Request.Cookies[0] != "session=s3ss10n" {
+		t.Errorf("Expected the call not to be changed")
+	}
+
+	if err := redaction.AddPattern(`access_token=([^&]+)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := redaction.AddPattern(`"(?:password|access_token)":"([^"]*)"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := redaction.AddPattern(`(`); err == nil {
+		t.Errorf("Expected an invalid pattern to fail")
+	}
+	redacted = redaction.Call(call)
+	if shouldbe := "https://api.example.com/login?access_token=[REDACTED]&page=2"; redacted.Request.URL != shouldbe {
+		t.Errorf("Expected %s, got %s", shouldbe, redacted.Request.URL)
+	}
+	if shouldbe := `{"user":"alice","password":"[REDACTED]"}`; string(redacted.Request.Body) != shouldbe {
+		t.Errorf("Expected %s, got %s", shouldbe, redacted.Request.Body)
+	}
+	if shouldbe := `{"access_token":"[REDACTED]"}`; string(redacted.Response.Body) != shouldbe {
+		t.Errorf("Expected %s, got %s", shouldbe, redacted.Response.Body)
+	}
+
+	if !redaction.Remove("authorization") || redaction.Remove("X-Unknown") {
+		t.Errorf("Expected only existing rules to be removed")
+	}
+	if redacted = redaction.Call(call); redacted.Request.Header.Get("Authorization") != "Bearer t0ken" {
+		t.Errorf("Expected the removed header to be kept, got %v", redacted.Request.Header)
+	}
+}
+
+func TestSaveRedactsHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "call-buddy-redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state-default.json")
+
+	state := telephono.InitNewState()
+	state.History.AddFinishedCall(newSensitiveCall())
+	if err := state.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"Bearer t0ken", "s3ss10n"} {
+		if strings.Contains(string(saved), secret) {
+			t.Errorf("Expected %s to be redacted in the saved state", secret)
+		}
+	}
+
+	// The session keeps the whole call, e.g. to filter its response
+	if call, _ := state.History.Get(0); call.Request.Header.Get("Authorization") != "Bearer t0ken" {
+		t.Errorf("Expected the history in memory not to be redacted")
+	}
+}
@@ -0,0 +1,149 @@
+package telephono_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+func newRunnerTestCollection(url string) telephono.CallBuddyCollection {
+	collection := telephono.CallBuddyCollection{Name: "Test"}
+	templates := []telephono.RequestTemplate{
+		{Name: "api/health", Method: telephono.Get, Url: url + "/health", Assertions: []telephono.Assertion{
+			{Kind: "status", Operator: "==", Expected: "200"},
+			{Kind: "json", Target: "$.status", Operator: "==", Expected: "up"},
+		}},
+		{Name: "api/missing", Method: telephono.Get, Url: url + "/missing", Assertions: []telephono.Assertion{
+			{Kind: "status", Operator: "==", Expected: "200"},
+		}},
+		{Name: "other", Method: telephono.Get, Url: url + "/health"},
+		{Name: "api/unreachable", Method: telephono.Get, Url: "http://127.0.0.1:1/"},
+	}
+	for _, template := range templates {
+		template.Headers = http.Header{}
+		collection.Save(template)
+	}
+	return collection
+}
+
+func runnerTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/health" {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(`{"status": "up"}`))
+	}))
+}
+
+func TestSelect(t *testing.T) {
+	collection := newRunnerTestCollection("http://localhost")
+	tests := []struct {
+		name     string
+		shouldbe []string
+	}{
+		{"", []string{"api/health", "api/missing", "other", "api/unreachable"}},
+		{"api", []string{"api/health", "api/missing", "api/unreachable"}},
+		{"api/", []string{"api/health", "api/missing", "api/unreachable"}},
+		{"other", []string{"other"}},
+		{"ap", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var names []string
+			for _, template := range collection.Select(test.name) {
+				names = append(names, template.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(test.shouldbe, ",") {
+				t.Errorf("Expected %v, got %v", test.shouldbe, names)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	server := runnerTestServer()
+	defer server.Close()
+	collection := newRunnerTestCollection(server.URL)
+	env := newTestEnvironment()
+
+	results := telephono.Run(context.Background(), http.DefaultClient, &env, collection.Select("api"), nil, telephono.BodyLimit{})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if !results[0].Passed() {
+		t.Errorf("Expected api/health to pass, got %v", results[0].Failures())
+	}
+	if results[1].Passed() || results[1].Err != nil {
+		t.Errorf("Expected api/missing to fail its assertion, got %+v", results[1])
+	}
+	if results[2].Passed() || results[2].Err == nil {
+		t.Errorf("Expected api/unreachable to fail to call, got %+v", results[2])
+	}
+
+	var tap bytes.Buffer
+	if err := telephono.WriteTAP(&tap, results); err != nil {
+		t.Fatal(err)
+	}
+	shouldbe := "TAP version 13\n1..3\nok 1 - api/health\nnot ok 2 - api/missing\n# status == 200: Expected status 200, got 404\nnot ok 3 - api/unreachable\n# "
+	if !strings.HasPrefix(tap.String(), shouldbe) {
+		t.Errorf("Expected TAP starting with\n%s\ngot\n%s", shouldbe, tap.String())
+	}
+
+	var junit bytes.Buffer
+	if err := telephono.WriteJUnit(&junit, "api", results); err != nil {
+		t.Fatal(err)
+	}
+	var suite struct {
+		Tests     int `xml:"tests,attr"`
+		Failures  int `xml:"failures,attr"`
+		Errors    int `xml:"errors,attr"`
+		TestCases []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"testcase"`
+	}
+	if err := xml.Unmarshal(junit.Bytes(), &suite); err != nil {
+		t.Fatalf("Bad JUnit XML: %s", err)
+	}
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Errors != 1 || len(suite.TestCases) != 3 {
+		t.Errorf("Unexpected test suite %+v", suite)
+	}
+}
+
+func TestRunCaptures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/login":
+			writer.Write([]byte(`{"access_token": "s3cr3t"}`))
+		case "/me":
+			if request.Header.Get("Authorization") != "Bearer s3cr3t" {
+				writer.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+
+	login := &telephono.RequestTemplate{Name: "login", Method: telephono.Post, Url: server.URL + "/login", Headers: http.Header{},
+		Captures: []telephono.Capture{{Variable: "TOKEN", Source: "json", Target: "$.access_token"}}}
+	me := &telephono.RequestTemplate{Name: "me", Method: telephono.Get, Url: server.URL + "/me",
+		Headers:    http.Header{"Authorization": {"Bearer {{User.TOKEN}}"}},
+		Assertions: []telephono.Assertion{{Kind: "status", Operator: "==", Expected: "200"}}}
+	env := newTestEnvironment()
+
+	results := telephono.Run(context.Background(), http.DefaultClient, &env, []*telephono.RequestTemplate{login, me}, nil, telephono.BodyLimit{})
+	for _, result := range results {
+		if !result.Passed() {
+			t.Errorf("Expected %s to pass, got %v", result.Template.Name, result.Failures())
+		}
+	}
+	if env.User.Mapping["TOKEN"] != "s3cr3t" {
+		t.Errorf("Expected the token to be captured, got %v", env.User.Mapping)
+	}
+}
@@ -0,0 +1,137 @@
+package telephono_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+// newAgeKey Returns a key for a new age identity, written to a file
+func newAgeKey(t *testing.T) *telephono.SecretKey {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, err := ioutil.TempFile("", "call-buddy-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyFile.Name())
+	keyFile.WriteString("# created: 2020-11-13T19:40:15Z\n" + identity.String() + "\n")
+	keyFile.Close()
+	key, err := telephono.AgeKey(keyFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSecretVariables(t *testing.T) {
+	key := newAgeKey(t)
+	env := newTestEnvironment()
+	if err := env.User.SetSecret("API_KEY", "sk_live_51H8"); err == nil {
+		t.Errorf("Expected storing a secret without a key to fail")
+	}
+	if err := env.User.Unlock(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.User.SetSecret("API_KEY", "sk_live_51H8"); err != nil {
+		t.Fatal(err)
+	}
+	clone := env.Clone()
+	if expanded := clone.Expand("key={{User.API_KEY}}"); expanded != "key=sk_live_51H8" {
+		t.Errorf("Expected the secret to be expanded, got %s", expanded)
+	}
+
+	// Only the encrypted value is saved
+	saved, err := json.Marshal(&env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(saved), "sk_live_51H8") || !strings.Contains(string(saved), `"Secrets":{"API_KEY":"`) {
+		t.Errorf("Expected the secret to be encrypted in %s", saved)
+	}
+	var loaded telephono.CallBuddyEnvironment
+	if err := json.Unmarshal(saved, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.User.Locked() || loaded.Expand("{{User.API_KEY}}") != "" {
+		t.Errorf("Expected the loaded secret to be locked")
+	}
+	if err := loaded.User.Unlock(newAgeKey(t)); err == nil {
+		t.Errorf("Expected another key to fail to unlock the secret")
+	}
+	if err := loaded.User.Unlock(key); err != nil || loaded.Expand("{{User.API_KEY}}") != "sk_live_51H8" {
+		t.Errorf("Expected the key to unlock the secret: %v", err)
+	}
+
+	// Plain variables replace secrets
+	loaded.User.Set("API_KEY", "plain")
+	if loaded.User.Locked() || loaded.Expand("{{User.API_KEY}}") != "plain" {
+		t.Errorf("Expected the plain variable to replace the secret")
+	}
+}
+
+func TestPassphraseKey(t *testing.T) {
+	key, err := telephono.PassphraseKey("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := key.Encrypt("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A key made from the same passphrase decrypts it
+	again, _ := telephono.PassphraseKey("correct horse battery staple")
+	if value, err := again.Decrypt(ciphertext); err != nil || value != "hunter2" {
+		t.Errorf("Expected hunter2, got %q: %v", value, err)
+	}
+	if _, err := telephono.PassphraseKey(""); err == nil {
+		t.Errorf("Expected an empty passphrase to fail")
+	}
+}
+
+func TestExecuteMasksSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Api-Key") + " " + r.URL.RawQuery))
+	}))
+	defer server.Close()
+
+	env := newTestEnvironment()
+	env.User.Unlock(newAgeKey(t))
+	env.User.SetSecret("API_KEY", "sk_live_51H8")
+	env.User.SetSecret("PASSWORD", "hunter2")
+	template := telephono.RequestTemplate{
+		Method:  telephono.Post,
+		Url:     server.URL + "/?key={{User.API_KEY}}",
+		Headers: http.Header{"X-Api-Key": {"{{User.API_KEY}}"}},
+		Body:    `{"password":"{{User.PASSWORD}}"}`,
+		Auth:    &telephono.Auth{Type: telephono.BasicAuth, Username: "alice", Password: "{{User.PASSWORD}}"},
+	}
+	call, err := template.Execute(http.DefaultClient, &env)
+	if err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	if string(call.Response.Body) != "sk_live_51H8 key=sk_live_51H8" {
+		t.Errorf("Expected the secret to be sent, got %s", call.Response.Body)
+	}
+	history, _ := json.Marshal(call.Request)
+	for _, secret := range []string{"sk_live_51H8", "hunter2"} {
+		if strings.Contains(string(history), secret) {
+			t.Errorf("Expected %s to be masked in %s", secret, history)
+		}
+	}
+	if header := call.Request.Header.Get("X-Api-Key"); header != "{{User.API_KEY}}" {
+		t.Errorf("Expected the variable in the history, got %s", header)
+	}
+	if authorization := call.Request.Header.Get("Authorization"); authorization != "Basic alice:{{User.PASSWORD}}" {
+		t.Errorf("Expected the password to be masked, got %s", authorization)
+	}
+}
@@ -0,0 +1,103 @@
+package telephono_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/call-buddy/call-buddy/telephono"
+)
+
+func TestStreamEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": keep-alive\n\nevent: update\nid: 1\ndata: {\"a\": 1}\n\ndata: first\ndata: second\n\nid: 3\n\ndata: cut off"))
+	}))
+	defer server.Close()
+
+	env := newTestEnvironment()
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL, Headers: http.Header{}}
+	var status int
+	var events []telephono.StreamEvent
+	call, err := template.Stream(context.Background(), http.DefaultClient, &env, func(response telephono.Response) {
+		status = response.StatusCode
+	}, func(event telephono.StreamEvent) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %s", err)
+	}
+	if status != 200 {
+		t.Errorf("Expected the response before the events, got status %d", status)
+	}
+
+	shouldbe := []telephono.StreamEvent{
+		{Event: "update", ID: "1", Data: `{"a": 1}`},
+		{Data: "first\nsecond"},
+	}
+	for i := range events {
+		if events[i].Received.IsZero() {
+			t.Errorf("Expected event %d to have a time", i)
+		}
+		events[i].Received = time.Time{}
+	}
+	if !reflect.DeepEqual(events, shouldbe) {
+		t.Errorf("Expected %+v, got %+v", shouldbe, events)
+	}
+	if !call.Response.IsEventStream() || len(call.Response.Body) == 0 {
+		t.Errorf("Expected the stream to be the body, got %q", call.Response.Body)
+	}
+}
+
+func TestStreamLinesUntilCancelled(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"type\": \"ADDED\"}\n\n{\"type\": \"MODIFIED\"}\n"))
+		w.(http.Flusher).Flush()
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	env := newTestEnvironment()
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL + "/?watch=true", Headers: http.Header{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var lines []string
+	call, err := template.Stream(ctx, http.DefaultClient, &env, nil, func(event telephono.StreamEvent) {
+		lines = append(lines, event.Data)
+		if len(lines) == 2 {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("Expected cancelling to end the stream, got %s", err)
+	}
+	if !reflect.DeepEqual(lines, []string{`{"type": "ADDED"}`, `{"type": "MODIFIED"}`}) {
+		t.Errorf("Unexpected lines %q", lines)
+	}
+	if call.Response.StatusCode != 200 {
+		t.Errorf("Expected the call to be returned, got status %d", call.Response.StatusCode)
+	}
+}
+
+func TestStreamEventFormat(t *testing.T) {
+	started := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	received := started.Add(1500 * time.Millisecond)
+	tests := []struct {
+		event    telephono.StreamEvent
+		shouldbe string
+	}{
+		{telephono.StreamEvent{Received: received, Data: "line"}, "[15:04:06.500 +1.50s] line\n"},
+		{telephono.StreamEvent{Received: received, Event: "ping", Data: "{}"}, "[15:04:06.500 +1.50s] event=ping\n{}\n"},
+	}
+	for _, test := range tests {
+		if formatted := test.event.Format(started); formatted != test.shouldbe {
+			t.Errorf("Expected %q, got %q", test.shouldbe, formatted)
+		}
+	}
+}
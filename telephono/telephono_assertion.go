@@ -0,0 +1,271 @@
+package telephono
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Assertion is a check on the result of a call, written as e.g.
+//
+//	status == 200
+//	header Content-Type == application/json
+//	header Location ~ ^/users/[0-9]+$
+//	json $.user.name == "alice"
+//	body ~ "ok": true
+//	latency <= 500ms
+type Assertion struct {
+	// status, header, json, body or latency
+	Kind string
+
+	// The header name or JSON path, empty for the other kinds
+	Target string
+
+	// == for equals, ~ for matches a regular expression or <= for latency
+	Operator string
+
+	Expected string
+}
+
+// AssertionResult is the outcome of checking an assertion
+type AssertionResult struct {
+	Assertion Assertion
+
+	// Why the assertion failed, nil if it passed
+	Err error
+}
+
+const (
+	equalsOperator  = "=="
+	matchesOperator = "~"
+	atMostOperator  = "<="
+)
+
+// assertionKinds Which operators each kind of assertion supports and whether
+// it has a target
+var assertionKinds = map[string]struct {
+	operators []string
+	hasTarget bool
+}{
+	"status":  {[]string{equalsOperator}, false},
+	"header":  {[]string{equalsOperator, matchesOperator}, true},
+	"json":    {[]string{equalsOperator, matchesOperator}, true},
+	"body":    {[]string{matchesOperator}, false},
+	"latency": {[]string{atMostOperator}, false},
+}
+
+// ParseAssertion Parses an assertion in the form "KIND [TARGET] OPERATOR
+// EXPECTED", see Assertion.
+func ParseAssertion(text string) (assertion Assertion, err error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		err = errors.New("Empty assertion")
+		return
+	}
+	assertion.Kind = strings.ToLower(fields[0])
+	kind, found := assertionKinds[assertion.Kind]
+	if !found {
+		err = errors.New("No such assertion " + fields[0] + ", use status, header, json, body or latency")
+		return
+	}
+
+	rest := skipField(text)
+	if kind.hasTarget {
+		if len(fields) < 2 {
+			err = errors.New("Missing the " + assertion.Kind + " to check")
+			return
+		}
+		assertion.Target, rest = fields[1], skipField(rest)
+	}
+	if len(strings.Fields(rest)) < 2 {
+		err = errors.New("Expected '" + assertion.Kind + " " + strings.Join(kind.operators, "|") + " VALUE'")
+		return
+	}
+	assertion.Operator = strings.Fields(rest)[0]
+	// The expected value keeps its spaces
+	assertion.Expected = strings.TrimSpace(skipField(rest))
+
+	err = assertion.validate()
+	return
+}
+
+// skipField Returns the text after its first whitespace separated field
+func skipField(text string) string {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	if end := strings.IndexFunc(text, unicode.IsSpace); end != -1 {
+		return strings.TrimLeftFunc(text[end:], unicode.IsSpace)
+	}
+	return ""
+}
+
+func (assertion *Assertion) validate() error {
+	kind, found := assertionKinds[assertion.Kind]
+	if !found {
+		return errors.New("No such assertion " + assertion.Kind)
+	}
+	supported := false
+	for _, operator := range kind.operators {
+		supported = supported || operator == assertion.Operator
+	}
+	if !supported {
+		return errors.New("The " + assertion.Kind + " assertion only supports " + strings.Join(kind.operators, " and "))
+	}
+
+	switch {
+	case assertion.Operator == matchesOperator:
+		if _, err := regexp.Compile(assertion.Expected); err != nil {
+			return err
+		}
+	case assertion.Kind == "status":
+		if _, err := strconv.Atoi(assertion.Expected); err != nil {
+			return errors.New("Not a status code " + assertion.Expected)
+		}
+	case assertion.Kind == "latency":
+		if _, err := time.ParseDuration(assertion.Expected); err != nil {
+			return errors.New("Not a duration " + assertion.Expected + ", use e.g. 500ms")
+		}
+	case assertion.Kind == "json":
+		if _, err := parseJsonPath(assertion.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (assertion Assertion) String() string {
+	parts := []string{assertion.Kind}
+	if assertion.Target != "" {
+		parts = append(parts, assertion.Target)
+	}
+	parts = append(parts, assertion.Operator, assertion.Expected)
+	return strings.Join(parts, " ")
+}
+
+// Check Checks the assertion against the call, returning why it failed or nil
+// if it passed.
+func (assertion *Assertion) Check(call HistoricalCall) error {
+	if err := assertion.validate(); err != nil {
+		return err
+	}
+
+	var actual string
+	switch assertion.Kind {
+	case "status":
+		expected, _ := strconv.Atoi(assertion.Expected)
+		if call.Response.StatusCode != expected {
+			return fmt.Errorf("Expected status %d, got %d", expected, call.Response.StatusCode)
+		}
+		return nil
+	case "latency":
+		expected, _ := time.ParseDuration(assertion.Expected)
+		if call.Timing.Total > expected {
+			return fmt.Errorf("Expected at most %s, took %s", expected, formatDuration(call.Timing.Total))
+		}
+		return nil
+	case "header":
+		values := call.Response.Header.Values(assertion.Target)
+		if len(values) == 0 {
+			return errors.New("No " + assertion.Target + " header")
+		}
+		actual = strings.Join(values, ", ")
+	case "body":
+		if call.Response.IsTruncated() {
+			return call.Response.TruncatedBodyError()
+		}
+		actual = string(call.Response.Body)
+	case "json":
+		if call.Response.IsTruncated() {
+			return call.Response.TruncatedBodyError()
+		}
+		var err error
+		if actual, err = JsonPathString(call.Response.Body, assertion.Target); err != nil {
+			return err
+		}
+		if assertion.Operator == equalsOperator && jsonEquals(actual, assertion.Expected) {
+			return nil
+		}
+	}
+
+	if assertion.Operator == matchesOperator {
+		matcher := regexp.MustCompile(assertion.Expected)
+		if !matcher.MatchString(actual) {
+			return fmt.Errorf("Expected %s to match %s, got %s", assertion.describeActual(), assertion.Expected, abbreviate(actual))
+		}
+		return nil
+	}
+	if actual != assertion.Expected {
+		return fmt.Errorf("Expected %s to be %s, got %s", assertion.describeActual(), assertion.Expected, abbreviate(actual))
+	}
+	return nil
+}
+
+func (assertion *Assertion) describeActual() string {
+	if assertion.Target != "" {
+		return assertion.Kind + " " + assertion.Target
+	}
+	return assertion.Kind
+}
+
+// jsonEquals Compares a value found in a JSON document with the expected value
+// as JSON when the expected value is JSON, so 1.0 equals 1 and "a" equals a
+func jsonEquals(actual, expected string) bool {
+	if actual == expected {
+		return true
+	}
+	expectedValue, err := decodeJson([]byte(expected))
+	if err != nil {
+		return false
+	}
+	if str, ok := expectedValue.(string); ok {
+		return str == actual
+	}
+	actualValue, err := decodeJson([]byte(actual))
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalizeJsonNumbers(actualValue), normalizeJsonNumbers(expectedValue))
+}
+
+// normalizeJsonNumbers Turns numbers into floats so 1 and 1.0 compare equal
+func normalizeJsonNumbers(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			typed[key] = normalizeJsonNumbers(child)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			typed[i] = normalizeJsonNumbers(child)
+		}
+	case json.Number:
+		if float, err := typed.Float64(); err == nil {
+			return float
+		}
+	}
+	return value
+}
+
+// abbreviate Shortens long values such as bodies in failure messages
+func abbreviate(value string) string {
+	if len(value) > 80 {
+		return value[:77] + "..."
+	}
+	return value
+}
+
+// Check Checks every assertion of the template against the call.
+func (r *RequestTemplate) Check(call HistoricalCall) (results []AssertionResult, passed bool) {
+	passed = true
+	for _, assertion := range r.Assertions {
+		err := assertion.Check(call)
+		results = append(results, AssertionResult{Assertion: assertion, Err: err})
+		passed = passed && err == nil
+	}
+	return
+}
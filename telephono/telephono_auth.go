@@ -0,0 +1,383 @@
+package telephono
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The kinds of authentication a template can use
+const (
+	BasicAuth  = "basic"
+	BearerAuth = "bearer"
+	DigestAuth = "digest"
+	AWSAuth    = "aws"
+	OAuth2Auth = "oauth2"
+)
+
+// Auth is how calls made with a template authenticate. Every field but Type
+// is expanded like headers are, so secrets can be kept in variables.
+type Auth struct {
+	// One of BasicAuth, BearerAuth, DigestAuth, AWSAuth and OAuth2Auth, which
+	// sends the access token the profile's OAuth2Config got
+	Type string
+
+	// For Basic and Digest
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+
+	// For Bearer
+	Token string `json:",omitempty"`
+
+	// For AWS Signature Version 4, the session token is only needed for
+	// temporary credentials
+	AccessKey    string `json:",omitempty"`
+	SecretKey    string `json:",omitempty"`
+	SessionToken string `json:",omitempty"`
+	Region       string `json:",omitempty"`
+	Service      string `json:",omitempty"`
+}
+
+// ParseAuth Parses authentication from the arguments of the auth command, e.g.
+// "basic USER PASSWORD" or "aws ACCESS-KEY SECRET-KEY REGION SERVICE"
+func ParseAuth(args []string) (Auth, error) {
+	if len(args) == 0 {
+		return Auth{}, errors.New("Expected basic, bearer, digest, aws or oauth2")
+	}
+	auth := Auth{Type: strings.ToLower(args[0])}
+	args = args[1:]
+	switch auth.Type {
+	case BasicAuth, DigestAuth:
+		if len(args) != 2 {
+			return Auth{}, errors.New("Expected " + auth.Type + " USER PASSWORD")
+		}
+		auth.Username, auth.Password = args[0], args[1]
+	case BearerAuth:
+		if len(args) != 1 {
+			return Auth{}, errors.New("Expected bearer TOKEN")
+		}
+		auth.Token = args[0]
+	case AWSAuth:
+		if len(args) != 4 && len(args) != 5 {
+			return Auth{}, errors.New("Expected aws ACCESS-KEY SECRET-KEY REGION SERVICE [SESSION-TOKEN]")
+		}
+		auth.AccessKey, auth.SecretKey, auth.Region, auth.Service = args[0], args[1], args[2], args[3]
+		if len(args) == 5 {
+			auth.SessionToken = args[4]
+		}
+	case OAuth2Auth:
+		if len(args) != 0 {
+			return Auth{}, errors.New("Expected oauth2 alone, the token is configured with the oauth2 command")
+		}
+	default:
+		return Auth{}, errors.New("No such authentication " + auth.Type + ", use basic, bearer, digest, aws or oauth2")
+	}
+	return auth, nil
+}
+
+// maskSecret Hides a secret unless it's taken from a variable
+func maskSecret(secret string) string {
+	if strings.Contains(secret, "{{") {
+		return secret
+	}
+	return "********"
+}
+
+// String Returns the authentication like it's given to the auth command, with
+// secrets that aren't in variables hidden
+func (auth Auth) String() string {
+	switch auth.Type {
+	case BasicAuth, DigestAuth:
+		return auth.Type + " " + auth.Username + " " + maskSecret(auth.Password)
+	case BearerAuth:
+		return auth.Type + " " + maskSecret(auth.Token)
+	case AWSAuth:
+		result := strings.Join([]string{auth.Type, auth.AccessKey, maskSecret(auth.SecretKey), auth.Region, auth.Service}, " ")
+		if auth.SessionToken != "" {
+			result += " " + maskSecret(auth.SessionToken)
+		}
+		return result
+	}
+	return auth.Type
+}
+
+// apply Authenticates the request, whose headers are already expanded. Digest
+// authentication needs the server's challenge, so it's answered by
+// answerDigest once the server sent it.
+func (auth *Auth) apply(httpRequest *http.Request, body string, env *CallBuddyEnvironment) error {
+	switch auth.Type {
+	case BasicAuth:
+		httpRequest.SetBasicAuth(env.Expand(auth.Username), env.Expand(auth.Password))
+	case BearerAuth:
+		httpRequest.Header.Set("Authorization", "Bearer "+env.Expand(auth.Token))
+	case AWSAuth:
+		expanded := Auth{
+			AccessKey:    env.Expand(auth.AccessKey),
+			SecretKey:    env.Expand(auth.SecretKey),
+			SessionToken: env.Expand(auth.SessionToken),
+			Region:       env.Expand(auth.Region),
+			Service:      env.Expand(auth.Service),
+		}
+		signAWS(httpRequest, body, expanded, time.Now())
+	case OAuth2Auth:
+		token := oauth2Token(env, OAuth2AccessToken)
+		if token == "" {
+			return errors.New("No OAuth2 access token in User." + OAuth2AccessToken)
+		}
+		httpRequest.Header.Set("Authorization", "Bearer "+token)
+	case DigestAuth:
+		// Answered once the server challenges the call
+	default:
+		return errors.New("No such authentication " + auth.Type)
+	}
+	return nil
+}
+
+// answerDigest Returns the request authenticated for the Digest challenge of
+// the response, or nil when the response has none
+func (auth *Auth) answerDigest(httpRequest *http.Request, body string, httpResponse *http.Response, env *CallBuddyEnvironment) (*http.Request, error) {
+	if auth.Type != DigestAuth || httpResponse.StatusCode != http.StatusUnauthorized {
+		return nil, nil
+	}
+	var challenge map[string]string
+	for _, value := range httpResponse.Header.Values("WWW-Authenticate") {
+		// A value may hold several challenges, e.g. Basic ..., Digest ...
+		if start := strings.Index(strings.ToLower(" "+value), " digest "); start >= 0 {
+			challenge = parseAuthParams(value[start+len("digest "):])
+			break
+		}
+	}
+	if challenge == nil {
+		return nil, nil
+	}
+
+	cnonce := make([]byte, 8)
+	if _, err := rand.Read(cnonce); err != nil {
+		return nil, err
+	}
+	authorization, err := digestAuthorization(challenge, httpRequest.Method, httpRequest.URL.RequestURI(), body, env.Expand(auth.Username), env.Expand(auth.Password), hex.EncodeToString(cnonce))
+	if err != nil {
+		return nil, err
+	}
+	answer := httpRequest.Clone(httpRequest.Context())
+	answer.Body, answer.GetBody = nil, nil
+	if httpRequest.GetBody != nil {
+		if answer.Body, err = httpRequest.GetBody(); err != nil {
+			return nil, err
+		}
+		answer.GetBody = httpRequest.GetBody
+	}
+	answer.Header.Set("Authorization", authorization)
+	return answer, nil
+}
+
+// parseAuthParams Parses the comma separated KEY=VALUE parameters of a
+// challenge, values may be quoted and contain commas
+func parseAuthParams(params string) map[string]string {
+	result := map[string]string{}
+	for params != "" {
+		params = strings.TrimLeft(params, " ,")
+		equals := strings.IndexByte(params, '=')
+		if equals < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(params[:equals]))
+		params = strings.TrimLeft(params[equals+1:], " ")
+		var value string
+		if strings.HasPrefix(params, `"`) {
+			var unquoted strings.Builder
+			end := 1
+			for ; end < len(params) && params[end] != '"'; end++ {
+				if params[end] == '\\' && end+1 < len(params) {
+					end++
+				}
+				unquoted.WriteByte(params[end])
+			}
+			value = unquoted.String()
+			if end < len(params) {
+				end++
+			}
+			params = params[end:]
+		} else {
+			end := strings.IndexByte(params, ',')
+			if end < 0 {
+				end = len(params)
+			}
+			value = strings.TrimSpace(params[:end])
+			params = params[end:]
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// digestAuthorization Returns the Authorization header answering the Digest
+// challenge, see https://tools.ietf.org/html/rfc7616
+func digestAuthorization(challenge map[string]string, method, uri, body, username, password, cnonce string) (string, error) {
+	algorithm := challenge["algorithm"]
+	var newHash func() hash.Hash
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", errors.New("Unsupported Digest algorithm " + algorithm)
+	}
+	h := func(data string) string {
+		digest := newHash()
+		digest.Write([]byte(data))
+		return hex.EncodeToString(digest.Sum(nil))
+	}
+
+	realm, nonce := challenge["realm"], challenge["nonce"]
+	ha1 := h(username + ":" + realm + ":" + password)
+	if strings.HasSuffix(strings.ToLower(algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	qop := ""
+	for _, offered := range strings.Split(challenge["qop"], ",") {
+		offered = strings.TrimSpace(offered)
+		if offered == "auth" || (offered == "auth-int" && qop == "") {
+			qop = offered
+		}
+	}
+	ha2 := h(method + ":" + uri)
+	if qop == "auth-int" {
+		ha2 = h(method + ":" + uri + ":" + h(body))
+	}
+
+	const nc = "00000001"
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	authorization := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`, username, realm, nonce, uri, response)
+	if algorithm != "" {
+		authorization += ", algorithm=" + algorithm
+	}
+	if qop != "" {
+		authorization += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		authorization += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return authorization, nil
+}
+
+// awsEncode URI encodes like AWS Signature Version 4 does, every byte but
+// unreserved ones and, unless encodeSlash, slashes
+func awsEncode(value string, encodeSlash bool) string {
+	var result strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			result.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			result.WriteByte(b)
+		default:
+			fmt.Fprintf(&result, "%%%02X", b)
+		}
+	}
+	return result.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signAWS Signs the request using AWS Signature Version 4 as of now, see
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signAWS(httpRequest *http.Request, body string, auth Auth, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	bodyHash := sha256.Sum256([]byte(body))
+	payloadHash := hex.EncodeToString(bodyHash[:])
+
+	httpRequest.Header.Set("X-Amz-Date", amzDate)
+	if auth.SessionToken != "" {
+		httpRequest.Header.Set("X-Amz-Security-Token", auth.SessionToken)
+	}
+	if auth.Service == "s3" {
+		httpRequest.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	// S3 paths are encoded once, every other service's twice
+	path := httpRequest.URL.EscapedPath()
+	if decoded, err := url.PathUnescape(path); err == nil {
+		path = awsEncode(decoded, false)
+	}
+	if auth.Service != "s3" {
+		path = awsEncode(path, false)
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	var query []string
+	for key, values := range httpRequest.URL.Query() {
+		for _, value := range values {
+			query = append(query, awsEncode(key, true)+"="+awsEncode(value, true))
+		}
+	}
+	sort.Strings(query)
+
+	// Only headers proxies leave alone are signed
+	host := httpRequest.Host
+	if host == "" {
+		host = httpRequest.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for key, values := range httpRequest.Header {
+		key = strings.ToLower(key)
+		if key == "content-type" || key == "content-md5" || strings.HasPrefix(key, "x-amz-") {
+			headers[key] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		}
+	}
+	var signedHeaders []string
+	for key := range headers {
+		signedHeaders = append(signedHeaders, key)
+	}
+	sort.Strings(signedHeaders)
+	var canonicalHeaders strings.Builder
+	for _, key := range signedHeaders {
+		canonicalHeaders.WriteString(key + ":" + headers[key] + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		httpRequest.Method,
+		path,
+		strings.Join(query, "&"),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + auth.Region + "/" + auth.Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+auth.SecretKey), date)
+	key = hmacSHA256(key, auth.Region)
+	key = hmacSHA256(key, auth.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	httpRequest.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		auth.AccessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
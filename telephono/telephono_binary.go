@@ -0,0 +1,96 @@
+package telephono
+
+import (
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// HexDumpLimit How much of a binary body is dumped when showing it
+const HexDumpLimit = 4096
+
+// binaryMediaTypes Media type prefixes that are never text
+var binaryMediaTypes = []string{
+	"image/", "audio/", "video/", "font/",
+	"application/zip", "application/gzip", "application/x-gzip", "application/pdf",
+	"application/protobuf", "application/x-protobuf", "application/grpc",
+	"application/msgpack", "application/x-msgpack", "application/cbor",
+}
+
+// IsBinaryBody Returns whether the body isn't text, going by its
+// Content-Type and what's in it. A JSON Content-Type doesn't make a gzipped
+// body text.
+func IsBinaryBody(contentType string, body []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "image/svg+xml" {
+		for _, binary := range binaryMediaTypes {
+			if strings.HasPrefix(mediaType, binary) {
+				return true
+			}
+		}
+	}
+	if !utf8.Valid(body) {
+		return true
+	}
+	for _, b := range body {
+		// Text has no control characters besides whitespace and escapes
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != 0x1b {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBinary Returns whether the response's body isn't text.
+func (response *Response) IsBinary() bool {
+	return IsBinaryBody(response.Header.Get("Content-Type"), response.Body)
+}
+
+// BodyText Returns the body if it's text, otherwise a hex dump of the start
+// of it.
+func (response *Response) BodyText() string {
+	if !response.IsBinary() {
+		return string(response.Body)
+	}
+	return HexDump(response.Body, response.Header.Get("Content-Type"), HexDumpLimit)
+}
+
+// HexDump Returns a line describing the body followed by a hex dump of up to
+// limit bytes of it, or all of it if limit is 0.
+func HexDump(body []byte, contentType string, limit int) string {
+	sniffed := http.DetectContentType(body)
+	description := fmt.Sprintf("Binary body of %s", formatSize(len(body)))
+	if contentType != "" {
+		description += ", " + contentType
+	}
+	// Only mention what the body looks like when that says something more
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if sniffed != "application/octet-stream" && (mediaType == "" || !strings.HasPrefix(sniffed, mediaType)) {
+		description += ", looks like " + sniffed
+	}
+
+	shown := body
+	if limit > 0 && len(body) > limit {
+		shown = body[:limit]
+	}
+	dump := description + "\n\n" + hex.Dump(shown)
+	if len(shown) < len(body) {
+		dump += fmt.Sprintf("... %d more bytes\n", len(body)-len(shown))
+	}
+	return dump
+}
+
+// formatSize Returns the size in bytes, KiB or MiB
+func formatSize(size int) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	case size == 1:
+		return "1 byte"
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
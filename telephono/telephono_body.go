@@ -0,0 +1,203 @@
+package telephono
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// BodyPreviewSize How much of a body written to a file is kept in memory
+const BodyPreviewSize = 64 << 10
+
+// DefaultMaxBodySize Bodies larger than this are written to a file unless
+// configured otherwise
+const DefaultMaxBodySize = 16 << 20
+
+// BodyLimit is how response bodies too large to keep in memory are handled
+type BodyLimit struct {
+	// Bodies larger than this many bytes are written to a file, 0 to keep
+	// every body in memory
+	MaxInMemory int64
+
+	// The directory the files are written to, the system's temporary
+	// directory if empty. The files are kept, as the saved history refers to
+	// them, until they are removed by hand.
+	Dir string
+
+	// Progress is told how much of the body has been received as it is,
+	// nil if nothing needs to know
+	Progress *BodyProgress
+}
+
+// BodyProgress is how much of a body has been received. It can be read from
+// other goroutines while the body is being received.
+type BodyProgress struct {
+	received int64
+	total    int64
+}
+
+// Received Returns how many bytes of the body have been received and how
+// many there are in total, -1 if the server didn't say.
+func (progress *BodyProgress) Received() (received, total int64) {
+	return atomic.LoadInt64(&progress.received), atomic.LoadInt64(&progress.total)
+}
+
+// String Returns how much has been received, and of how much if known.
+func (progress *BodyProgress) String() string {
+	received, total := progress.Received()
+	if total < 0 {
+		return formatSize(int(received))
+	}
+	return formatSize(int(received)) + " of " + formatSize(int(total))
+}
+
+// progressReader Counts the bytes read into the progress
+type progressReader struct {
+	reader   io.Reader
+	progress *BodyProgress
+}
+
+func (reader *progressReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	atomic.AddInt64(&reader.progress.received, int64(n))
+	return n, err
+}
+
+// populateBody Reads the response body, writing it to a file if it's larger
+// than the limit allows
+func (response *Response) populateBody(httpResponse *http.Response, limit BodyLimit) (err error) {
+	defer httpResponse.Body.Close()
+	var body io.Reader = httpResponse.Body
+	if limit.Progress != nil {
+		atomic.StoreInt64(&limit.Progress.received, 0)
+		atomic.StoreInt64(&limit.Progress.total, httpResponse.ContentLength)
+		body = &progressReader{body, limit.Progress}
+	}
+
+	response.Body = []byte("")
+	if limit.MaxInMemory <= 0 {
+		response.Body, err = ioutil.ReadAll(body)
+		return
+	}
+	buffered, err := ioutil.ReadAll(io.LimitReader(body, limit.MaxInMemory+1))
+	if err != nil {
+		return
+	}
+	if int64(len(buffered)) <= limit.MaxInMemory {
+		response.Body = buffered
+		return
+	}
+
+	file, err := ioutil.TempFile(limit.Dir, "call-buddy-body-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		file.Close()
+		if err != nil {
+			os.Remove(file.Name())
+		}
+	}()
+	if _, err = file.Write(buffered); err != nil {
+		return
+	}
+	copied, err := io.Copy(file, body)
+	if err != nil {
+		return
+	}
+	response.BodyFile = file.Name()
+	response.BodyFileSize = int64(len(buffered)) + copied
+	// Don't cut a character of a text body in half, which would make it look
+	// binary. The preview is copied so the rest of the buffer can be freed.
+	// With a limit below the preview size, the whole buffer but its last
+	// byte is the preview.
+	previewSize := BodyPreviewSize
+	if previewSize > len(buffered)-1 {
+		previewSize = len(buffered) - 1
+	}
+	preview := previewSize
+	for preview > 0 && preview > previewSize-utf8.UTFMax && !utf8.RuneStart(buffered[preview]) {
+		preview--
+	}
+	response.Body = append([]byte(nil), buffered[:preview]...)
+	return
+}
+
+// IsTruncated Returns whether the body was too large to keep in memory, so
+// Body only holds the start of it and the whole body is in BodyFile.
+func (response *Response) IsTruncated() bool {
+	return response.BodyFile != ""
+}
+
+// TruncatedBodyError Returns the error for things that need the whole body
+// when it was written to a file
+func (response *Response) TruncatedBodyError() error {
+	return errors.New("The body is too large to use, it was saved to " + response.BodyFile)
+}
+
+// TruncatedDescription Returns a line saying where the body was saved to when
+// it was too large to keep in memory, empty if it wasn't.
+func (response *Response) TruncatedDescription() string {
+	if !response.IsTruncated() {
+		return ""
+	}
+	return fmt.Sprintf("Body of %s saved to %s, showing the first %s\n", formatSize(int(response.BodyFileSize)), response.BodyFile, formatSize(len(response.Body)))
+}
+
+// OpenBody Returns a reader of the whole body, from the file it was saved to
+// if it was too large to keep in memory.
+func (response *Response) OpenBody() (io.ReadCloser, error) {
+	if !response.IsTruncated() {
+		return ioutil.NopCloser(bytes.NewReader(response.Body)), nil
+	}
+	return os.Open(response.BodyFile)
+}
+
+// WriteBody Writes the whole body to the writer, from the file it was saved
+// to if it was too large to keep in memory.
+func (response *Response) WriteBody(w io.Writer) error {
+	body, err := response.OpenBody()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// parseSize Parses sizes such as 512, 64KB, 10MiB or 1G, where KB and KiB
+// both mean 1024 bytes
+func parseSize(size string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(size))
+	upper = strings.TrimSuffix(strings.TrimSuffix(upper, "B"), "I")
+	multiplier := int64(1)
+	if upper != "" {
+		switch upper[len(upper)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			upper = upper[:len(upper)-1]
+		}
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	// ParseFloat takes inf and nan too, which int64 can't hold
+	total := number * float64(multiplier)
+	if err != nil || !(total >= 0 && total < math.MaxInt64) {
+		return 0, errors.New("Not a size " + size + ", use e.g. 512KB or 64MB")
+	}
+	return int64(total), nil
+}
@@ -1,34 +1,83 @@
 package telephono
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strings"
 )
 
 type RequestTemplate struct {
+	Name    string
 	Method  HttpMethod
 	Url     string
 	Headers http.Header
 	Body    string // FIXME DG: byte buffer or reader?
+
+	// Checks on the result of the call
+	Assertions []Assertion
+
+	// Values taken from the result of the call for later calls
+	Captures []Capture
+
+	// The body is a GraphQL query, sent with the JSON object in Variables
+	GraphQL   bool   `json:",omitempty"`
+	Variables string `json:",omitempty"`
+
+	// The HOST or HOST:PORT to connect to instead of the URL's host, which
+	// is still used for the Host header and TLS
+	ConnectTo string `json:",omitempty"`
+
+	// The HTTP version calls are made with instead of the profile's, see
+	// SetProtocol
+	Protocol string `json:",omitempty"`
+
+	// How calls authenticate, nil when the headers do it
+	Auth *Auth `json:",omitempty"`
 }
 
-//executeWithClientAndExpander will execute this call template with the specified client and expander, returning a response or an error
-func (r *RequestTemplate) Execute(client *http.Client, env *CallBuddyEnvironment) (HistoricalCall, error) {
+// Clone Returns a copy of this template that shares no headers with it.
+func (r *RequestTemplate) Clone() RequestTemplate {
+	clone := *r
+	clone.Headers = http.Header{}
+	for key, values := range r.Headers {
+		clone.Headers[key] = append([]string(nil), values...)
+	}
+	clone.Assertions = append([]Assertion(nil), r.Assertions...)
+	clone.Captures = append([]Capture(nil), r.Captures...)
+	if r.Auth != nil {
+		auth := *r.Auth
+		clone.Auth = &auth
+	}
+	return clone
+}
+
+// newHttpRequest Expands this template in the given environment and creates the
+// Go request for it along with the expanded body
+func (r *RequestTemplate) newHttpRequest(env *CallBuddyEnvironment) (*http.Request, string, error) {
 	expandedUrl := env.Expand(r.Url)
 
 	// Weird dance where Go wants a body reader for HTTP calls
 	method := string(r.Method)
 	expandedBody := env.OS.Expand(env.User.Expand(r.Body))
-	log.Printf("Body: %s\n", expandedBody)
+	log.Printf("Body: %s\n", env.User.MaskSecrets(expandedBody))
 
 	if expandedBody == "\n" {
 		expandedBody = ""
 	}
+	if r.GraphQL {
+		envelope, err := GraphQLEnvelope(expandedBody, env.Expand(r.Variables))
+		if err != nil {
+			return nil, "", err
+		}
+		expandedBody = envelope
+	}
 	bodyReader := strings.NewReader(expandedBody)
 	httpRequest, newCallErr := http.NewRequest(method, expandedUrl, bodyReader)
 	if newCallErr != nil {
-		return HistoricalCall{}, newCallErr
+		return nil, "", newCallErr
 	}
 
 	// Add the headers
@@ -38,23 +87,97 @@ func (r *RequestTemplate) Execute(client *http.Client, env *CallBuddyEnvironment
 			header.Add(key, env.Expand(value))
 		}
 	}
+	if r.GraphQL && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
 	httpRequest.Header = header
+	if r.Auth != nil {
+		if err := r.Auth.apply(httpRequest, expandedBody, env); err != nil {
+			return nil, "", err
+		}
+	}
+	return httpRequest, expandedBody, nil
+}
+
+// Expand Returns the request this template expands to in the given environment
+// without executing it
+func (r *RequestTemplate) Expand(env *CallBuddyEnvironment) (Request, error) {
+	request := Request{}
+	httpRequest, expandedBody, err := r.newHttpRequest(env)
+	if err != nil {
+		return request, err
+	}
+	err = request.Populate(httpRequest, expandedBody)
+	return request, err
+}
+
+//executeWithClientAndExpander will execute this call template with the specified client and expander, returning a response or an error
+func (r *RequestTemplate) Execute(client *http.Client, env *CallBuddyEnvironment) (HistoricalCall, error) {
+	return r.ExecuteContext(context.Background(), client, env)
+}
+
+// ExecuteContext Is Execute where the call is aborted once the given context
+// is cancelled or done, including while reading the response body
+func (r *RequestTemplate) ExecuteContext(ctx context.Context, client *http.Client, env *CallBuddyEnvironment) (HistoricalCall, error) {
+	return r.ExecuteLimited(ctx, client, env, BodyLimit{})
+}
+
+// ExecuteLimited Is ExecuteContext where response bodies larger than the limit
+// are written to a file instead of being kept in memory
+func (r *RequestTemplate) ExecuteLimited(ctx context.Context, client *http.Client, env *CallBuddyEnvironment, limit BodyLimit) (HistoricalCall, error) {
+	if IsGrpcUrl(env.Expand(r.Url)) {
+		return r.executeGrpc(ctx, client, env)
+	}
+	httpRequest, expandedBody, newCallErr := r.newHttpRequest(env)
+	if newCallErr != nil {
+		return HistoricalCall{}, newCallErr
+	}
+	tracedCtx, timer := newCallTimer(ctx)
+	httpRequest = httpRequest.WithContext(tracedCtx)
 
 	// This must be done before we do our call since the call consumes the body (since it's a reader)
 	// Populate our own structs with Go's http.Request
 	request := Request{}
 	request.Populate(httpRequest, expandedBody)
 
+	connectedClient, err := r.clientFor(client, env, httpRequest.URL)
+	if err != nil {
+		return HistoricalCall{}, err
+	}
+	if connectedClient != client {
+		defer connectedClient.CloseIdleConnections()
+	}
+	request.recordCookies(connectedClient.Jar, httpRequest.URL)
+
 	// Call!
-	httpResponse, doErr := client.Do(httpRequest)
+	httpResponse, doErr := connectedClient.Do(httpRequest)
 	if doErr != nil {
 		return HistoricalCall{}, doErr
 	}
+	if r.Auth != nil {
+		answer, err := r.Auth.answerDigest(httpRequest, expandedBody, httpResponse, env)
+		if err != nil {
+			httpResponse.Body.Close()
+			return HistoricalCall{}, err
+		}
+		if answer != nil {
+			// The call is made again, answering the server's challenge
+			io.Copy(ioutil.Discard, httpResponse.Body)
+			httpResponse.Body.Close()
+			request.Header = answer.Header.Clone()
+			if httpResponse, doErr = connectedClient.Do(answer); doErr != nil {
+				return HistoricalCall{}, doErr
+			}
+		}
+	}
 
 	// Populate our own structs with Go's http.Response
 	response := Response{}
-	response.Populate(httpResponse)
+	if err := response.PopulateLimited(httpResponse, limit); err != nil {
+		return HistoricalCall{}, err
+	}
 
-	call := HistoricalCall{Request: request, Response: response}
+	request.maskSecrets(env)
+	call := HistoricalCall{Request: request, Response: response, Timing: timer.finish()}
 	return call, nil
 }
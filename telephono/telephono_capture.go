@@ -0,0 +1,162 @@
+package telephono
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Capture stores a value from the response of a call in the User environment
+// so later calls can use it, written as e.g.
+//
+//	User.TOKEN = json:$.access_token
+//	NEXT = header:Location
+//	CODE = status
+//	CSRF = body:name="csrf" value="([^"]+)"
+type Capture struct {
+	// The name of the User variable the value is stored in
+	Variable string
+
+	// json, header, status or body
+	Source string
+
+	// The JSON path, header name or regular expression, empty for status and
+	// the whole body
+	Target string
+}
+
+// CaptureResult is what a capture stored, or why it couldn't
+type CaptureResult struct {
+	Capture Capture
+	Value   string
+
+	// Why nothing was captured, nil if something was
+	Err error
+}
+
+var captureVariableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseCapture Parses a capture in the form "[User.]NAME = SOURCE[:TARGET]",
+// see Capture.
+func ParseCapture(text string) (capture Capture, err error) {
+	parts := strings.SplitN(text, "=", 2)
+	if len(parts) != 2 {
+		err = errors.New("Expected 'NAME = SOURCE', e.g. 'User.TOKEN = json:$.access_token'")
+		return
+	}
+	capture.Variable = strings.TrimSpace(parts[0])
+	// Only the User environment can be written to
+	if strings.HasPrefix(capture.Variable, "User.") {
+		capture.Variable = strings.TrimPrefix(capture.Variable, "User.")
+	} else if strings.Contains(capture.Variable, ".") {
+		err = errors.New("Only User variables can be captured into, not " + capture.Variable)
+		return
+	}
+
+	source := strings.TrimSpace(parts[1])
+	capture.Source = source
+	if colon := strings.Index(source, ":"); colon != -1 {
+		capture.Source, capture.Target = source[:colon], strings.TrimSpace(source[colon+1:])
+	}
+	capture.Source = strings.ToLower(capture.Source)
+
+	err = capture.validate()
+	return
+}
+
+func (capture *Capture) validate() error {
+	if !captureVariableName.MatchString(capture.Variable) {
+		return errors.New("Not a valid variable name '" + capture.Variable + "'")
+	}
+	switch capture.Source {
+	case "json":
+		if capture.Target == "" {
+			return errors.New("Missing the JSON path to capture, e.g. json:$.access_token")
+		}
+		if _, err := parseJsonPath(capture.Target); err != nil {
+			return err
+		}
+	case "header":
+		if capture.Target == "" {
+			return errors.New("Missing the header to capture, e.g. header:Location")
+		}
+	case "status":
+		if capture.Target != "" {
+			return errors.New("The status capture takes nothing after it")
+		}
+	case "body":
+		if capture.Target != "" {
+			if _, err := regexp.Compile(capture.Target); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("No such capture source " + capture.Source + ", use json, header, status or body")
+	}
+	return nil
+}
+
+func (capture Capture) String() string {
+	source := capture.Source
+	if capture.Target != "" {
+		source += ":" + capture.Target
+	}
+	return "User." + capture.Variable + " = " + source
+}
+
+// Extract Returns the value the capture takes from the call.
+func (capture *Capture) Extract(call HistoricalCall) (string, error) {
+	if err := capture.validate(); err != nil {
+		return "", err
+	}
+	if (capture.Source == "json" || capture.Source == "body") && call.Response.IsTruncated() {
+		return "", call.Response.TruncatedBodyError()
+	}
+
+	switch capture.Source {
+	case "json":
+		return JsonPathString(call.Response.Body, capture.Target)
+	case "header":
+		values := call.Response.Header.Values(capture.Target)
+		if len(values) == 0 {
+			return "", errors.New("No " + capture.Target + " header")
+		}
+		return values[0], nil
+	case "status":
+		return strconv.Itoa(call.Response.StatusCode), nil
+	}
+
+	if capture.Target == "" {
+		return string(call.Response.Body), nil
+	}
+	// The first group if there is one, otherwise the whole match
+	match := regexp.MustCompile(capture.Target).FindSubmatch(call.Response.Body)
+	if match == nil {
+		return "", errors.New("Nothing in the body matches " + capture.Target)
+	}
+	if len(match) > 1 {
+		return string(match[1]), nil
+	}
+	return string(match[0]), nil
+}
+
+// Capture Stores the values the template's captures take from the call in the
+// User environment. Captures into secret variables are encrypted, and fail
+// while the secrets are locked. Variables whose capture fails are left as they
+// were.
+func (r *RequestTemplate) Capture(call HistoricalCall, env *CallBuddyEnvironment) (results []CaptureResult) {
+	for _, capture := range r.Captures {
+		value, err := capture.Extract(call)
+		if _, secret := env.User.Secrets[capture.Variable]; err == nil && secret {
+			if err = env.User.SetSecret(capture.Variable, value); err != nil {
+				value = ""
+				err = errors.New(env.User.Name + "." + capture.Variable + " is a secret: " + err.Error())
+			}
+		} else if err == nil {
+			env.User.Set(capture.Variable, value)
+		}
+		results = append(results, CaptureResult{Capture: capture, Value: value, Err: err})
+	}
+	return
+}
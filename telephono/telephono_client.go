@@ -0,0 +1,321 @@
+package telephono
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientConfig is how the HTTP client making calls for a profile behaves.
+// The zero value behaves like Go's default client.
+type ClientConfig struct {
+	// How long a whole call may take, 0 for no limit
+	Timeout time.Duration
+
+	// Don't follow redirects, the redirect response is the response
+	NoRedirects bool
+
+	// How many redirects are followed, 0 for Go's default of 10. Use
+	// NoRedirects not to follow any.
+	MaxRedirects int
+
+	// The HTTP proxy URL, empty to use the HTTP_PROXY and HTTPS_PROXY
+	// environment variables
+	Proxy string
+
+	// Don't verify the server's certificate
+	Insecure bool
+
+	// A PEM file of CA certificates trusted along with the system ones
+	CACert string
+
+	// PEM files of a client certificate and its key for mutual TLS
+	ClientCert string
+	ClientKey  string
+
+	// Response bodies larger than this many bytes are saved to a file, 0
+	// for DefaultMaxBodySize and -1 to keep every body in memory
+	MaxBody int64
+
+	// The directory large bodies are saved to, empty for the system's
+	// temporary directory
+	BodyDir string
+
+	// The HTTP version calls are made with, one of HTTP11, HTTP2, H2C and
+	// HTTP3, empty to use HTTP/2 when the server supports it over TLS
+	Protocol string `json:",omitempty"`
+}
+
+// clientConfigKeys The keys that can be given to Set, in the order they are
+// described in
+var clientConfigKeys = []string{"timeout", "redirects", "max-redirects", "proxy", "insecure", "cacert", "cert", "key", "max-body", "body-dir", "http"}
+
+func parseSwitch(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "yes", "1":
+		return true, nil
+	case "off", "false", "no", "0":
+		return false, nil
+	}
+	return false, errors.New("Expected on or off, got " + value)
+}
+
+func formatSwitch(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// Set Sets the setting with the given key from its string form. An empty
+// value resets the setting to its default.
+func (config *ClientConfig) Set(key, value string) (err error) {
+	key = strings.ToLower(key)
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "timeout":
+		if value == "" {
+			config.Timeout = 0
+			return
+		}
+		var timeout time.Duration
+		if timeout, err = time.ParseDuration(value); err != nil {
+			// Plain numbers are seconds
+			var seconds float64
+			if seconds, err = strconv.ParseFloat(value, 64); err != nil {
+				return errors.New("Not a timeout " + value + ", use e.g. 30s or 2m")
+			}
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+		if timeout < 0 {
+			return errors.New("The timeout can't be negative")
+		}
+		config.Timeout = timeout
+	case "redirects":
+		follow := true
+		if value != "" {
+			if follow, err = parseSwitch(value); err != nil {
+				return
+			}
+		}
+		config.NoRedirects = !follow
+	case "max-redirects":
+		if value == "" {
+			config.MaxRedirects = 0
+			return
+		}
+		var max int
+		if max, err = strconv.Atoi(value); err != nil || max < 0 {
+			return errors.New("Not a number of redirects " + value)
+		}
+		if max == 0 {
+			return errors.New("The number of redirects can't be 0, use redirects=off not to follow them")
+		}
+		config.MaxRedirects = max
+	case "proxy":
+		if value != "" {
+			if _, err = parseProxy(value); err != nil {
+				return
+			}
+		}
+		config.Proxy = value
+	case "insecure":
+		insecure := false
+		if value != "" {
+			if insecure, err = parseSwitch(value); err != nil {
+				return
+			}
+		}
+		config.Insecure = insecure
+	case "cacert":
+		config.CACert = value
+	case "cert":
+		config.ClientCert = value
+	case "key":
+		config.ClientKey = value
+	case "max-body":
+		switch strings.ToLower(value) {
+		case "":
+			config.MaxBody = 0
+		case "none", "off":
+			config.MaxBody = -1
+		default:
+			var max int64
+			if max, err = parseSize(value); err != nil {
+				return
+			}
+			if max == 0 {
+				return errors.New("The body size limit can't be 0, use none to keep every body in memory")
+			}
+			config.MaxBody = max
+		}
+	case "body-dir":
+		config.BodyDir = value
+	case "http":
+		config.Protocol, err = parseProtocol(value)
+	default:
+		return errors.New("No such setting " + key + ", use one of " + strings.Join(clientConfigKeys, ", "))
+	}
+	return
+}
+
+// Get Returns the string form of the setting with the given key.
+func (config *ClientConfig) Get(key string) (string, error) {
+	switch strings.ToLower(key) {
+	case "timeout":
+		if config.Timeout == 0 {
+			return "none", nil
+		}
+		return config.Timeout.String(), nil
+	case "redirects":
+		return formatSwitch(!config.NoRedirects), nil
+	case "max-redirects":
+		if config.MaxRedirects == 0 {
+			return "10", nil
+		}
+		return strconv.Itoa(config.MaxRedirects), nil
+	case "proxy":
+		if config.Proxy == "" {
+			return "from environment", nil
+		}
+		return config.Proxy, nil
+	case "insecure":
+		return formatSwitch(config.Insecure), nil
+	case "cacert":
+		return config.CACert, nil
+	case "cert":
+		return config.ClientCert, nil
+	case "key":
+		return config.ClientKey, nil
+	case "max-body":
+		switch config.MaxBody {
+		case -1:
+			return "none", nil
+		case 0:
+			return formatSize(DefaultMaxBodySize), nil
+		}
+		return formatSize(int(config.MaxBody)), nil
+	case "body-dir":
+		if config.BodyDir == "" {
+			return os.TempDir(), nil
+		}
+		return config.BodyDir, nil
+	case "http":
+		if config.Protocol == "" {
+			return "auto", nil
+		}
+		return config.Protocol, nil
+	}
+	return "", errors.New("No such setting " + key)
+}
+
+// String Returns every setting as KEY=VALUE lines.
+func (config ClientConfig) String() (result string) {
+	for _, key := range clientConfigKeys {
+		value, _ := config.Get(key)
+		result += fmt.Sprintf("%s=%s\n", key, value)
+	}
+	return
+}
+
+func parseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if proxyUrl.Host == "" {
+		return nil, errors.New("Not a proxy URL " + proxy)
+	}
+	return proxyUrl, nil
+}
+
+// BodyLimit Returns how response bodies are limited with this configuration,
+// reporting their progress to the given progress if it isn't nil.
+func (config *ClientConfig) BodyLimit(progress *BodyProgress) BodyLimit {
+	limit := BodyLimit{MaxInMemory: config.MaxBody, Dir: config.BodyDir, Progress: progress}
+	switch config.MaxBody {
+	case -1:
+		limit.MaxInMemory = 0
+	case 0:
+		limit.MaxInMemory = DefaultMaxBodySize
+	}
+	return limit
+}
+
+// NewClient Creates a HTTP client with this configuration.
+func (config *ClientConfig) NewClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.Proxy != "" {
+		proxyUrl, err := parseProxy(config.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.Insecure}
+	if config.CACert != "" {
+		pem, err := ioutil.ReadFile(config.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in " + config.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.ClientCert != "" || config.ClientKey != "" {
+		if config.ClientCert == "" || config.ClientKey == "" {
+			return nil, errors.New("Both a client certificate and key are needed for mutual TLS")
+		}
+		certificate, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	transport.TLSClientConfig = tlsConfig
+	transport.RegisterProtocol("unix", newUnixTransport(transport))
+
+	roundTripper, err := config.protocolTransport(transport)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: roundTripper,
+		Timeout:   config.Timeout,
+	}
+	noRedirects := config.NoRedirects
+	maxRedirects := config.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = 10
+	}
+	client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		if noRedirects {
+			return http.ErrUseLastResponse
+		}
+		// via holds every request made so far, so one per redirect
+		if len(via) > maxRedirects {
+			return fmt.Errorf("Stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+	return client, nil
+}
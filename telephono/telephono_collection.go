@@ -0,0 +1,87 @@
+package telephono
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+)
+
+// CallBuddyCollection is a named group of request templates that can be
+// saved, recalled and removed by name.
+type CallBuddyCollection struct {
+	Name string
+	// TODO AH: Should this really be pointer?
+	RequestTemplates []*RequestTemplate
+}
+
+type InvalidTemplateNameError struct {
+	s string
+}
+
+func (e InvalidTemplateNameError) Error() string {
+	return e.s
+}
+
+func NewInvalidTemplateNameError(name string) InvalidTemplateNameError {
+	return InvalidTemplateNameError{"Not a valid template name '" + name + "'. Can only contain a-z, A-Z, 0-9, '.', '-', '/' and underscores."}
+}
+
+func validTemplateName(name string) bool {
+	var isValid = regexp.MustCompile(`^[a-zA-Z0-9_./-]+$`).MatchString
+	return isValid(name)
+}
+
+// Get Returns the request template with the given name.
+func (collection *CallBuddyCollection) Get(name string) (*RequestTemplate, error) {
+	for _, template := range collection.RequestTemplates {
+		if template.Name != "" && template.Name == name {
+			return template, nil
+		}
+	}
+	return nil, errors.New("No such template " + name)
+}
+
+// Save Stores a copy of the given template in the collection under the
+// template's name, replacing any template already saved under that name.
+func (collection *CallBuddyCollection) Save(template RequestTemplate) error {
+	if !validTemplateName(template.Name) {
+		return NewInvalidTemplateNameError(template.Name)
+	}
+	saved := template.Clone()
+	for i, existing := range collection.RequestTemplates {
+		if existing.Name == template.Name {
+			collection.RequestTemplates[i] = &saved
+			return nil
+		}
+	}
+	collection.RequestTemplates = append(collection.RequestTemplates, &saved)
+	return nil
+}
+
+// Remove Removes the request template with the given name.
+func (collection *CallBuddyCollection) Remove(name string) error {
+	for i, template := range collection.RequestTemplates {
+		if template.Name != "" && template.Name == name {
+			// 3, [1,2,3,4] -> [1, 2, 4]
+			collection.RequestTemplates = append(collection.RequestTemplates[:i], collection.RequestTemplates[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("No such template " + name)
+}
+
+// List Returns the named templates in the collection sorted by name.
+func (collection *CallBuddyCollection) List() []*RequestTemplate {
+	var named []*RequestTemplate
+	for _, template := range collection.RequestTemplates {
+		// Older states stored an unnamed scratch template here, skip it
+		if template.Name == "" {
+			continue
+		}
+		named = append(named, template)
+	}
+	sort.SliceStable(named, func(i, j int) bool {
+		return named[i].Name < named[j].Name
+	})
+	return named
+}
@@ -0,0 +1,277 @@
+package telephono
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie is a cookie kept in a CookieJar
+type Cookie struct {
+	Name  string
+	Value string
+
+	// The host the cookie is sent to, and its subdomains unless HostOnly
+	Domain   string
+	HostOnly bool `json:",omitempty"`
+	Path     string
+
+	// When the cookie expires, zero for session cookies, which are kept
+	// until they are cleared
+	Expires time.Time
+
+	Secure   bool `json:",omitempty"`
+	HttpOnly bool `json:",omitempty"`
+}
+
+// String Returns the cookie like a Set-Cookie header sets it
+func (cookie Cookie) String() string {
+	text := cookie.Name + "=" + cookie.Value + "; Domain=" + cookie.Domain + "; Path=" + cookie.Path
+	if !cookie.Expires.IsZero() {
+		text += "; Expires=" + cookie.Expires.Format(http.TimeFormat)
+	}
+	if cookie.Secure {
+		text += "; Secure"
+	}
+	if cookie.HttpOnly {
+		text += "; HttpOnly"
+	}
+	if cookie.HostOnly {
+		text += " (not for subdomains)"
+	}
+	return text
+}
+
+// domainMatches Returns whether the cookie is sent to the host
+func (cookie *Cookie) domainMatches(host string) bool {
+	if cookie.HostOnly || net.ParseIP(host) != nil {
+		return host == cookie.Domain
+	}
+	return host == cookie.Domain || strings.HasSuffix(host, "."+cookie.Domain)
+}
+
+// pathMatches Returns whether the cookie is sent with calls to the path, see
+// https://tools.ietf.org/html/rfc6265#section-5.1.4
+func (cookie *Cookie) pathMatches(path string) bool {
+	if path == cookie.Path {
+		return true
+	}
+	return strings.HasPrefix(path, cookie.Path) && (strings.HasSuffix(cookie.Path, "/") || path[len(cookie.Path)] == '/')
+}
+
+// expired Returns whether the cookie has expired by the given time
+func (cookie *Cookie) expired(now time.Time) bool {
+	return !cookie.Expires.IsZero() && !cookie.Expires.After(now)
+}
+
+// CookieJar keeps the cookies servers set, so they are sent with later calls
+// like a browser would. Unlike the net/http/cookiejar one, it can be saved
+// with the profile and listed. Public suffixes aren't known, so it's up to
+// the servers called not to set cookies for e.g. co.uk.
+type CookieJar struct {
+	mutex sync.Mutex
+
+	Entries []Cookie `json:",omitempty"`
+}
+
+// MarshalJSON Returns the jar as JSON, even while calls set cookies
+func (jar *CookieJar) MarshalJSON() ([]byte, error) {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	return json.Marshal(struct {
+		Entries []Cookie `json:",omitempty"`
+	}{jar.Entries})
+}
+
+// cookieHost Returns the host a URL's cookies belong to
+func cookieHost(u *url.URL) string {
+	return strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+}
+
+// defaultCookiePath Returns the path cookies set without one get, see
+// https://tools.ietf.org/html/rfc6265#section-5.1.4
+func defaultCookiePath(u *url.URL) string {
+	path := u.EscapedPath()
+	if !strings.HasPrefix(path, "/") || strings.Count(path, "/") == 1 {
+		return "/"
+	}
+	return path[:strings.LastIndex(path, "/")]
+}
+
+// SetCookies Keeps the cookies the server of the URL set, replacing those of
+// the same name, domain and path. Cookies for other domains are ignored.
+func (jar *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	now := time.Now()
+	for _, httpCookie := range cookies {
+		jar.keep(u, httpCookie, now)
+	}
+}
+
+// keep Keeps the cookie the server of the URL set, returning false if it's
+// for a domain the server doesn't belong to
+func (jar *CookieJar) keep(u *url.URL, httpCookie *http.Cookie, now time.Time) bool {
+	host := cookieHost(u)
+	cookie := Cookie{
+		Name:     httpCookie.Name,
+		Value:    httpCookie.Value,
+		Domain:   host,
+		HostOnly: true,
+		Path:     httpCookie.Path,
+		Secure:   httpCookie.Secure,
+		HttpOnly: httpCookie.HttpOnly,
+	}
+	if domain := strings.ToLower(strings.TrimPrefix(httpCookie.Domain, ".")); domain != "" && domain != host {
+		// Only the host's own domains may be set, and only by names
+		if net.ParseIP(host) != nil || !strings.Contains(domain, ".") || !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+		cookie.Domain, cookie.HostOnly = domain, false
+	} else if domain != "" {
+		cookie.HostOnly = false
+	}
+	if !strings.HasPrefix(cookie.Path, "/") {
+		cookie.Path = defaultCookiePath(u)
+	}
+	switch {
+	case httpCookie.MaxAge < 0:
+		cookie.Expires = now
+	case httpCookie.MaxAge > 0:
+		cookie.Expires = now.Add(time.Duration(httpCookie.MaxAge) * time.Second)
+	case !httpCookie.Expires.IsZero():
+		cookie.Expires = httpCookie.Expires
+	}
+
+	// Cookies replace those with the same name, domain and path, and expired
+	// ones only remove them
+	for i, entry := range jar.Entries {
+		if entry.Name == cookie.Name && entry.Domain == cookie.Domain && entry.Path == cookie.Path {
+			if cookie.expired(now) {
+				jar.Entries = append(jar.Entries[:i], jar.Entries[i+1:]...)
+			} else {
+				jar.Entries[i] = cookie
+			}
+			return true
+		}
+	}
+	if !cookie.expired(now) {
+		jar.Entries = append(jar.Entries, cookie)
+	}
+	return true
+}
+
+// Cookies Returns the cookies to send with calls to the URL, those with
+// longer paths first
+func (jar *CookieJar) Cookies(u *url.URL) (cookies []*http.Cookie) {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	host := cookieHost(u)
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	now := time.Now()
+
+	var matching []Cookie
+	for _, cookie := range jar.Entries {
+		if cookie.expired(now) || (cookie.Secure && !secure) || !cookie.domainMatches(host) || !cookie.pathMatches(path) {
+			continue
+		}
+		matching = append(matching, cookie)
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return len(matching[i].Path) > len(matching[j].Path)
+	})
+	for _, cookie := range matching {
+		cookies = append(cookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return
+}
+
+// List Returns the cookies that haven't expired, sorted by domain, path and
+// name
+func (jar *CookieJar) List() []Cookie {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	now := time.Now()
+	var cookies []Cookie
+	for _, cookie := range jar.Entries {
+		if !cookie.expired(now) {
+			cookies = append(cookies, cookie)
+		}
+	}
+	sort.SliceStable(cookies, func(i, j int) bool {
+		if cookies[i].Domain != cookies[j].Domain {
+			return cookies[i].Domain < cookies[j].Domain
+		}
+		if cookies[i].Path != cookies[j].Path {
+			return cookies[i].Path < cookies[j].Path
+		}
+		return cookies[i].Name < cookies[j].Name
+	})
+	return cookies
+}
+
+// Set Keeps a cookie like the server of the URL set it with the given
+// Set-Cookie header, e.g. "session=abc; Path=/api"
+func (jar *CookieJar) Set(rawUrl, setCookie string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	if u.Hostname() == "" {
+		return errors.New("No host in " + rawUrl)
+	}
+	cookies := (&http.Response{Header: http.Header{"Set-Cookie": {setCookie}}}).Cookies()
+	if len(cookies) == 0 {
+		return errors.New("Expected NAME=VALUE, optionally followed by attributes like ; Path=/")
+	}
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	if !jar.keep(u, cookies[0], time.Now()) {
+		return errors.New("The cookie's domain isn't one of " + u.Hostname())
+	}
+	return nil
+}
+
+// Clear Removes the cookies sent to the domain or its subdomains, or every
+// cookie if the domain is empty, returning how many were removed
+func (jar *CookieJar) Clear(domain string) int {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	kept := jar.Entries[:0]
+	for _, cookie := range jar.Entries {
+		if domain != "" && cookie.Domain != domain && !strings.HasSuffix(cookie.Domain, "."+domain) {
+			kept = append(kept, cookie)
+		}
+	}
+	removed := len(jar.Entries) - len(kept)
+	jar.Entries = kept
+	return removed
+}
+
+// Clone Returns a jar with the same cookies that doesn't share them
+func (jar *CookieJar) Clone() *CookieJar {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	return &CookieJar{Entries: append([]Cookie(nil), jar.Entries...)}
+}
+
+// recordCookies Records the cookies the jar sends with the request
+func (request *Request) recordCookies(jar http.CookieJar, u *url.URL) {
+	if jar == nil {
+		return
+	}
+	for _, cookie := range jar.Cookies(u) {
+		request.Cookies = append(request.Cookies, cookie.Name+"="+cookie.Value)
+	}
+}
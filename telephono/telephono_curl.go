@@ -0,0 +1,510 @@
+package telephono
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shellSafe Characters that never need quoting in a POSIX shell
+const shellSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%_-+=:,./"
+
+// shellQuote Quotes the given argument for a POSIX shell if it needs it
+func shellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	if strings.Trim(arg, shellSafe) == "" {
+		return arg
+	}
+	// Single quotes can't be escaped inside single quotes, so close the
+	// quote, add an escaped quote and open it again
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// Curl Returns a shell quoted curl command line that makes this request
+func (request *Request) Curl() string {
+	args := []string{"curl"}
+	switch request.Method {
+	case Get:
+		// curl's default, unless there's data which makes it a POST
+		if len(request.Body) > 0 {
+			args = append(args, "-X", request.Method.String())
+		}
+	case Head:
+		// -X HEAD makes curl wait for a body that never comes
+		args = append(args, "--head")
+	default:
+		args = append(args, "-X", request.Method.String())
+	}
+	args = append(args, shellQuote(request.URL))
+
+	// Go randomizes map order, keep the output stable
+	var keys []string
+	for key := range request.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range request.Header[key] {
+			args = append(args, "-H", shellQuote(key+": "+value))
+		}
+	}
+	if len(request.Cookies) > 0 {
+		args = append(args, "-b", shellQuote(strings.Join(request.Cookies, "; ")))
+	}
+
+	if len(request.Body) > 0 {
+		args = append(args, "--data-raw", shellQuote(string(request.Body)))
+	}
+	return strings.Join(args, " ")
+}
+
+// Curl Returns a shell quoted curl command line that repeats this call
+func (theCall HistoricalCall) Curl() string {
+	return theCall.Request.Curl()
+}
+
+// Curl Returns a shell quoted curl command line that makes the request this
+// template expands to in the given environment
+func (r *RequestTemplate) Curl(env *CallBuddyEnvironment) (string, error) {
+	request, err := r.Expand(env)
+	if err != nil {
+		return "", err
+	}
+	return request.Curl(), nil
+}
+
+// CurlCommand is what was understood from a curl command line.
+type CurlCommand struct {
+	// The method, url, headers and body of the call
+	Template RequestTemplate
+
+	// -k or --insecure was given
+	Insecure bool
+
+	// Options that were understood but have no effect in call-buddy
+	Ignored []string
+}
+
+// curlValueOptions Options that take a value but are ignored, every other one
+// curl --help all lists with a value is handled by ParseCurl
+var curlValueOptions = map[string]bool{
+	"--abstract-unix-socket": true, "--alt-svc": true, "--aws-sigv4": true,
+	"--cacert": true, "--capath": true, "-E": true, "--cert": true,
+	"--cert-type": true, "--ciphers": true, "-K": true, "--config": true,
+	"--connect-timeout": true, "--connect-to": true, "-C": true,
+	"--continue-at": true, "-c": true, "--cookie-jar": true,
+	"--create-file-mode": true, "--crlfile": true, "--curves": true,
+	"--delegation": true, "--dns-interface": true, "--dns-ipv4-addr": true,
+	"--dns-ipv6-addr": true, "--dns-servers": true, "--doh-url": true,
+	"-D": true, "--dump-header": true, "--egd-file": true, "--engine": true,
+	"--etag-compare": true, "--etag-save": true, "--expect100-timeout": true,
+	"--ftp-account": true, "--ftp-alternative-to-user": true,
+	"--ftp-method": true, "-P": true, "--ftp-port": true,
+	"--ftp-ssl-ccc-mode": true, "--happy-eyeballs-timeout-ms": true,
+	"--hostpubmd5": true, "--hostpubsha256": true, "--hsts": true,
+	"--interface": true, "--keepalive-time": true, "--key": true,
+	"--key-type": true, "--krb": true, "--libcurl": true, "--limit-rate": true,
+	"--local-port": true, "--login-options": true, "--mail-auth": true,
+	"--mail-from": true, "--mail-rcpt": true, "--max-filesize": true,
+	"--max-redirs": true, "-m": true, "--max-time": true, "--netrc-file": true,
+	"--noproxy": true, "-o": true, "--output": true, "--output-dir": true,
+	"--parallel-max": true, "--pass": true, "--pinnedpubkey": true,
+	"--preproxy": true, "--proto": true, "--proto-default": true,
+	"--proto-redir": true, "-x": true, "--proxy": true, "--proxy-cacert": true,
+	"--proxy-capath": true, "--proxy-cert": true, "--proxy-cert-type": true,
+	"--proxy-ciphers": true, "--proxy-crlfile": true, "--proxy-header": true,
+	"--proxy-key": true, "--proxy-key-type": true, "--proxy-pass": true,
+	"--proxy-pinnedpubkey": true, "--proxy-service-name": true,
+	"--proxy-tls13-ciphers": true, "--proxy-tlsauthtype": true,
+	"--proxy-tlspassword": true, "--proxy-tlsuser": true, "-U": true,
+	"--proxy-user": true, "--pubkey": true, "-Q": true, "--quote": true,
+	"--random-file": true, "-r": true, "--range": true, "--rate": true,
+	"--request-target": true, "--resolve": true, "--retry": true,
+	"--retry-delay": true, "--retry-max-time": true, "--sasl-authzid": true,
+	"--service-name": true, "--socks4": true, "--socks4a": true,
+	"--socks5": true, "--socks5-gssapi-service": true,
+	"--socks5-hostname": true, "-Y": true, "--speed-limit": true, "-y": true,
+	"--speed-time": true, "--stderr": true, "-t": true,
+	"--telnet-option": true, "--tftp-blksize": true, "-z": true,
+	"--time-cond": true, "--tls-max": true, "--tls13-ciphers": true,
+	"--tlsauthtype": true, "--tlspassword": true, "--tlsuser": true,
+	"--trace": true, "--trace-ascii": true, "--unix-socket": true, "-T": true,
+	"--upload-file": true, "--url-query": true, "-w": true,
+	"--write-out": true,
+}
+
+// curlShortValueOptions Short options that take a value, the value can
+// directly follow the option e.g. -XPOST
+const curlShortValueOptions = "ACDEFHKPQTUXYbcdemortuwxyz"
+
+// isCurlShortFlag Returns whether the byte can be a short option, curl's are
+// ASCII letters and the digits of e.g. -4
+func isCurlShortFlag(flag byte) bool {
+	return flag >= 'a' && flag <= 'z' || flag >= 'A' && flag <= 'Z' || flag >= '0' && flag <= '9'
+}
+
+// ParseCurl Parses a curl command line, such as one copied from a browser's
+// developer tools, into a request template. Data given as @FILE is read
+// from the file.
+func ParseCurl(commandLine string) (parsed CurlCommand, err error) {
+	args, err := splitShellWords(commandLine)
+	if err != nil {
+		return
+	}
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+
+	template := &parsed.Template
+	template.Headers = http.Header{}
+	var method, rawUrl string
+	var data []string
+	var getData bool
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		option, value, hasValue := arg, "", false
+
+		if strings.HasPrefix(arg, "--") {
+			if equals := strings.Index(arg, "="); equals > 0 {
+				option, value, hasValue = arg[:equals], arg[equals+1:], true
+			}
+		} else if strings.HasPrefix(arg, "-") && len(arg) > 2 {
+			if strings.ContainsRune(curlShortValueOptions, rune(arg[1])) {
+				// -XPOST
+				option, value, hasValue = arg[:2], arg[2:], true
+			} else {
+				// -sSLk or -sXPOST, expand into separate options
+				var expanded []string
+				for j := 1; j < len(arg); j++ {
+					flag := arg[j]
+					if !isCurlShortFlag(flag) {
+						err = errors.New("Invalid curl option " + arg)
+						return
+					}
+					if strings.IndexByte(curlShortValueOptions, flag) != -1 {
+						expanded = append(expanded, "-"+arg[j:])
+						break
+					}
+					expanded = append(expanded, "-"+string(flag))
+				}
+				args = append(args[:i], append(expanded, args[i+1:]...)...)
+				i--
+				continue
+			}
+		}
+
+		// Grabs the value of options that need one
+		needValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", errors.New("Missing value for curl option " + option)
+			}
+			i++
+			return args[i], nil
+		}
+
+		switch option {
+		case "-X", "--request":
+			if method, err = needValue(); err != nil {
+				return
+			}
+		case "-H", "--header":
+			var header string
+			if header, err = needValue(); err != nil {
+				return
+			}
+			parts := strings.SplitN(header, ":", 2)
+			if len(parts) != 2 {
+				err = errors.New("Invalid curl header " + header)
+				return
+			}
+			template.Headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode", "--json":
+			var datum string
+			if datum, err = needValue(); err != nil {
+				return
+			}
+			if option == "--data-urlencode" {
+				datum = curlUrlencode(datum)
+			} else if option != "--data-raw" && strings.HasPrefix(datum, "@") {
+				if datum, err = readCurlDataFile(datum[1:], option == "--data-binary" || option == "--json"); err != nil {
+					return
+				}
+			}
+			if option == "--json" {
+				if template.Headers.Get("Content-Type") == "" {
+					template.Headers.Set("Content-Type", "application/json")
+				}
+				if template.Headers.Get("Accept") == "" {
+					template.Headers.Set("Accept", "application/json")
+				}
+			}
+			data = append(data, datum)
+		case "-u", "--user":
+			var user string
+			if user, err = needValue(); err != nil {
+				return
+			}
+			if !strings.Contains(user, ":") {
+				user += ":"
+			}
+			template.Headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user)))
+		case "--oauth2-bearer":
+			var token string
+			if token, err = needValue(); err != nil {
+				return
+			}
+			template.Headers.Set("Authorization", "Bearer "+token)
+		case "-A", "--user-agent":
+			var agent string
+			if agent, err = needValue(); err != nil {
+				return
+			}
+			template.Headers.Set("User-Agent", agent)
+		case "-e", "--referer":
+			var referer string
+			if referer, err = needValue(); err != nil {
+				return
+			}
+			template.Headers.Set("Referer", referer)
+		case "-b", "--cookie":
+			var cookie string
+			if cookie, err = needValue(); err != nil {
+				return
+			}
+			if !strings.Contains(cookie, "=") {
+				err = errors.New("Reading cookies from a file is not supported")
+				return
+			}
+			template.Headers.Add("Cookie", cookie)
+		case "--url":
+			if rawUrl, err = needValue(); err != nil {
+				return
+			}
+		case "-I", "--head":
+			method = Head
+		case "-G", "--get":
+			getData = true
+		case "-k", "--insecure":
+			parsed.Insecure = true
+		case "--compressed":
+			// Go already asks for and decompresses gzip responses
+			parsed.Ignored = append(parsed.Ignored, option)
+		case "-F", "--form", "--form-string":
+			err = errors.New("Multipart forms (" + option + ") are not supported")
+			return
+		default:
+			if curlValueOptions[option] {
+				if _, err = needValue(); err != nil {
+					return
+				}
+				parsed.Ignored = append(parsed.Ignored, option)
+			} else if strings.HasPrefix(option, "-") {
+				parsed.Ignored = append(parsed.Ignored, option)
+			} else if rawUrl == "" {
+				rawUrl = arg
+			} else {
+				err = errors.New("Only one URL is supported, got " + rawUrl + " and " + arg)
+				return
+			}
+		}
+	}
+
+	if rawUrl == "" {
+		err = errors.New("No URL in curl command")
+		return
+	}
+	if !strings.Contains(rawUrl, "://") {
+		// curl's default
+		rawUrl = "http://" + rawUrl
+	}
+
+	body := strings.Join(data, "&")
+	if getData && body != "" {
+		separator := "?"
+		if strings.Contains(rawUrl, "?") {
+			separator = "&"
+		}
+		rawUrl += separator + body
+		body = ""
+	}
+	if method == "" {
+		method = Get
+		if body != "" {
+			method = string(Post)
+		}
+	}
+	if body != "" && template.Headers.Get("Content-Type") == "" {
+		template.Headers.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if template.Method, err = toHttpMethod(method); err != nil {
+		return
+	}
+	template.Url = rawUrl
+	template.Body = body
+	return
+}
+
+// readCurlDataFile Reads data given as @FILE, curl strips newlines unless the
+// data is binary
+func readCurlDataFile(filepath string, binary bool) (string, error) {
+	if filepath == "-" {
+		return "", errors.New("Reading data from stdin is not supported")
+	}
+	content, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return "", err
+	}
+	if binary {
+		return string(content), nil
+	}
+	return strings.NewReplacer("\r", "", "\n", "").Replace(string(content)), nil
+}
+
+// curlUrlencode Encodes --data-urlencode content which is either CONTENT,
+// =CONTENT or NAME=CONTENT
+func curlUrlencode(datum string) string {
+	parts := strings.SplitN(datum, "=", 2)
+	if len(parts) == 1 {
+		return url.QueryEscape(datum)
+	}
+	if parts[0] == "" {
+		return url.QueryEscape(parts[1])
+	}
+	return parts[0] + "=" + url.QueryEscape(parts[1])
+}
+
+// splitShellWords Splits a command line into words the way a POSIX shell
+// would, handling quotes, backslashes and line continuations. Browsers quote
+// bodies with quotes or newlines as $'...', which bash supports too.
+func splitShellWords(commandLine string) (words []string, err error) {
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(commandLine)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '$':
+			if r == '\'' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) {
+				i = writeAnsiCEscape(&word, runes, i+1)
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+				i++
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+				}
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+			quote = '$'
+			inWord = true
+			i++
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				// A line continuation isn't part of any word
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+					inWord = true
+				}
+			}
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("Unterminated quote in command line")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return
+}
+
+// ansiCEscapes The characters of $'...' escapes that stand for one character
+var ansiCEscapes = map[rune]rune{
+	'a': '\a', 'b': '\b', 'e': 0x1b, 'E': 0x1b, 'f': '\f', 'n': '\n', 'r': '\r',
+	't': '\t', 'v': '\v', '\\': '\\', '\'': '\'', '"': '"', '?': '?',
+}
+
+// writeAnsiCEscape Writes what the $'...' escape starting at runes[i], after
+// its backslash, stands for, returning the index of its last rune
+func writeAnsiCEscape(word *strings.Builder, runes []rune, i int) int {
+	if r, ok := ansiCEscapes[runes[i]]; ok {
+		word.WriteRune(r)
+		return i
+	}
+	// Octal \nnn, hexadecimal \xHH and Unicode \uHHHH and \UHHHHHHHH
+	base, digits, start := 16, 0, i+1
+	switch runes[i] {
+	case 'x':
+		digits = 2
+	case 'u':
+		digits = 4
+	case 'U':
+		digits = 8
+	default:
+		if runes[i] >= '0' && runes[i] <= '7' {
+			base, digits, start = 8, 3, i
+		}
+	}
+	valid := "0123456789abcdefABCDEF"
+	if base == 8 {
+		valid = "01234567"
+	}
+	end := start
+	for end < len(runes) && end-start < digits && strings.ContainsRune(valid, runes[end]) {
+		end++
+	}
+	if end == start {
+		// Not an escape, the backslash is kept
+		word.WriteRune('\\')
+		word.WriteRune(runes[i])
+		return i
+	}
+	value, _ := strconv.ParseUint(string(runes[start:end]), base, 32)
+	if runes[i] == 'x' || base == 8 {
+		// Bytes, as in UTF-8 sequences like \xc3\xa9
+		word.WriteByte(byte(value))
+	} else {
+		word.WriteRune(rune(value))
+	}
+	return end - 1
+}
@@ -0,0 +1,130 @@
+package telephono
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IsUnixUrl Returns whether the URL is a call over a Unix domain socket, e.g.
+// unix:///var/run/docker.sock:/containers/json
+func IsUnixUrl(url string) bool {
+	return strings.HasPrefix(url, "unix://")
+}
+
+// ParseUnixUrl Returns the socket of a unix:// URL and the path of the call
+// made over it, which is / when the URL doesn't have one.
+func ParseUnixUrl(unixUrl string) (socket, path string, err error) {
+	if !IsUnixUrl(unixUrl) {
+		return "", "", errors.New("Not a unix:// URL " + unixUrl)
+	}
+	socket, path = strings.TrimPrefix(unixUrl, "unix://"), "/"
+	if colon := strings.Index(socket, ":"); colon >= 0 {
+		socket, path = socket[:colon], socket[colon+1:]
+	}
+	if socket == "" {
+		return "", "", errors.New("No socket in " + unixUrl + ", use e.g. unix:///var/run/docker.sock:/info")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return socket, path, nil
+}
+
+// unixTransport Makes calls to unix:// URLs as plain HTTP over the socket
+type unixTransport struct {
+	transport *http.Transport
+}
+
+// newUnixTransport Returns a transport for unix:// URLs that behaves like the
+// given one apart from where it connects to
+func newUnixTransport(transport *http.Transport) *unixTransport {
+	unix := transport.Clone()
+	unix.Proxy = nil
+	unix.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		// The host is the socket, hex encoded so connections to different
+		// sockets aren't shared
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		socket, err := hex.DecodeString(host)
+		if err != nil {
+			return nil, err
+		}
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", string(socket))
+	}
+	return &unixTransport{transport: unix}
+}
+
+func (transport *unixTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	socket, path, err := ParseUnixUrl(request.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	overSocket, err := url.Parse("http://" + hex.EncodeToString([]byte(socket)) + path)
+	if err != nil {
+		return nil, err
+	}
+	unixRequest := request.Clone(request.Context())
+	unixRequest.URL = overSocket
+	// Like curl, servers such as Docker need a Host header
+	unixRequest.Host = "localhost"
+	return transport.transport.RoundTrip(unixRequest)
+}
+
+// hostPort Returns the host and port the URL connects to, with the scheme's
+// default port when it has none
+func hostPort(requestUrl *url.URL) string {
+	if port := requestUrl.Port(); port != "" {
+		return net.JoinHostPort(requestUrl.Hostname(), port)
+	}
+	if requestUrl.Scheme == "https" || requestUrl.Scheme == "wss" {
+		return net.JoinHostPort(requestUrl.Hostname(), "443")
+	}
+	return net.JoinHostPort(requestUrl.Hostname(), "80")
+}
+
+// connectAddress Returns the address a call to the URL connects to instead
+// of its host, given as HOST or HOST:PORT, the port is the URL's by default
+func connectAddress(connectTo string, requestUrl *url.URL) string {
+	if _, _, err := net.SplitHostPort(connectTo); err == nil {
+		return connectTo
+	}
+	_, port, _ := net.SplitHostPort(hostPort(requestUrl))
+	return net.JoinHostPort(strings.Trim(connectTo, "[]"), port)
+}
+
+// connectDial Returns a dial function that connects to the address instead of
+// from, and to every other address as the given dial function does
+func connectDial(dial func(ctx context.Context, network, addr string) (net.Conn, error), from, to string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == from {
+			addr = to
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// clientFor Returns the client to make the call to the URL with, connecting
+// to the template's ConnectTo address and using its HTTP version when it has
+// them
+func (r *RequestTemplate) clientFor(client *http.Client, env *CallBuddyEnvironment, requestUrl *url.URL) (*http.Client, error) {
+	connectTo := strings.TrimSpace(env.Expand(r.ConnectTo))
+	if connectTo == "" && (r.Protocol == "" || r.Protocol == clientProtocol(client)) {
+		return client, nil
+	}
+	address := ""
+	if connectTo != "" {
+		address = connectAddress(connectTo, requestUrl)
+	}
+	return protocolClient(client, requestUrl, address, r.Protocol)
+}
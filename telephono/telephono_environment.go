@@ -11,6 +11,12 @@ import (
 type Environment struct {
 	Name    string
 	Mapping map[string]string
+
+	// Variables encrypted with a SecretKey, only decrypted when expanded
+	Secrets map[string]string `json:",omitempty"`
+
+	// The key the secrets are decrypted with, nil while they are locked
+	key *SecretKey
 }
 
 // Expands the environment variables in the given string and returns the result.
@@ -25,7 +31,7 @@ func (env *Environment) Expand(content string) (rendered string) {
 		return
 	}
 	contexts := make(map[string]interface{})
-	contexts[env.Name] = env.Mapping
+	contexts[env.Name] = env.values()
 	if rendered, err = compiled.Render(contexts); err != nil {
 		// FIXME DG: Same here
 		return
@@ -33,16 +39,38 @@ func (env *Environment) Expand(content string) (rendered string) {
 	return
 }
 
+// Clone Returns a copy of the environment that shares no variables with it
+func (env *Environment) Clone() Environment {
+	clone := Environment{Name: env.Name, Mapping: make(map[string]string, len(env.Mapping)), key: env.key}
+	for key, value := range env.Mapping {
+		clone.Mapping[key] = value
+	}
+	if env.Secrets != nil {
+		clone.Secrets = make(map[string]string, len(env.Secrets))
+		for key, value := range env.Secrets {
+			clone.Secrets[key] = value
+		}
+	}
+	return clone
+}
+
 // Set Sets the key=value pair in the given environment
 func (env *Environment) Set(key, value string) {
+	if env.Mapping == nil {
+		env.Mapping = map[string]string{}
+	}
 	env.Mapping[key] = value
+	delete(env.Secrets, key)
 }
 
 // PopulateFromEnviron Pulls in key=value pairs from the OS environment and
-// populates the given environment
+// populates the given environment, except the passphrase of secret variables
 func (env *Environment) PopulateFromEnviron() {
 	for _, kv := range os.Environ() {
 		parts := strings.SplitN(kv, "=", 2)
+		if parts[0] == PassphraseVariable {
+			continue
+		}
 		env.Set(parts[0], parts[1])
 	}
 }
@@ -0,0 +1,949 @@
+package telephono
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A jq-like filter language for picking apart JSON bodies, so no jq is needed
+// on the host. It supports:
+//
+//	.  .a.b  ."a key"  .["a key"]  .[0]  .[-1]  .[2:4]  .[]  ..  ?
+//	|  ,  ( )  [ ]  {a: .x, b}
+//	==  !=  <  <=  >  >=  and  or
+//	"strings"  numbers  true  false  null
+//	length  keys  map(f)  select(f)  has(k)  first  last  type  not
+//	tostring  empty
+//
+// Object keys are iterated in sorted order.
+
+// filterFunc Returns the outputs of a filter for an input
+type filterFunc func(input interface{}) ([]interface{}, error)
+
+type filterToken struct {
+	// ident, field, string, number, punct or eof
+	kind string
+	text string
+}
+
+// lexFilter Splits the filter expression into tokens
+func lexFilter(expression string) (tokens []filterToken, err error) {
+	isIdentStart := func(c byte) bool {
+		return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	}
+	isIdent := func(c byte) bool {
+		return isIdentStart(c) || (c >= '0' && c <= '9')
+	}
+	isDigit := func(c byte) bool {
+		return c >= '0' && c <= '9'
+	}
+
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '.' && i+1 < len(expression) && expression[i+1] == '.':
+			tokens = append(tokens, filterToken{"punct", ".."})
+			i += 2
+		case c == '.' && i+1 < len(expression) && isIdentStart(expression[i+1]):
+			end := i + 1
+			for end < len(expression) && isIdent(expression[end]) {
+				end++
+			}
+			tokens = append(tokens, filterToken{"field", expression[i+1 : end]})
+			i = end
+		case isIdentStart(c):
+			end := i
+			for end < len(expression) && isIdent(expression[end]) {
+				end++
+			}
+			tokens = append(tokens, filterToken{"ident", expression[i:end]})
+			i = end
+		case isDigit(c) || (c == '-' && i+1 < len(expression) && isDigit(expression[i+1])):
+			end := i + 1
+			for end < len(expression) && (isDigit(expression[end]) || strings.IndexByte(".eE+-", expression[end]) != -1) {
+				end++
+			}
+			number := expression[i:end]
+			if _, err := strconv.ParseFloat(number, 64); err != nil {
+				return nil, errors.New("Not a number " + number)
+			}
+			tokens = append(tokens, filterToken{"number", number})
+			i = end
+		case c == '"':
+			end := i + 1
+			for end < len(expression) && expression[end] != '"' {
+				if expression[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expression) {
+				return nil, errors.New("Unterminated string in filter")
+			}
+			var str string
+			if err := json.Unmarshal([]byte(expression[i:end+1]), &str); err != nil {
+				return nil, errors.New("Invalid string " + expression[i:end+1])
+			}
+			tokens = append(tokens, filterToken{"string", str})
+			i = end + 1
+		default:
+			two := ""
+			if i+1 < len(expression) {
+				two = expression[i : i+2]
+			}
+			if two == "==" || two == "!=" || two == "<=" || two == ">=" {
+				tokens = append(tokens, filterToken{"punct", two})
+				i += 2
+			} else if strings.IndexByte(".|,()[]{}:?<>;", c) != -1 {
+				tokens = append(tokens, filterToken{"punct", string(c)})
+				i++
+			} else {
+				return nil, fmt.Errorf("Unexpected %c in filter", c)
+			}
+		}
+	}
+	return append(tokens, filterToken{kind: "eof"}), nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (parser *filterParser) peek() filterToken {
+	return parser.tokens[parser.pos]
+}
+
+// accept Moves past the next token if it's the given punctuation or keyword
+func (parser *filterParser) accept(text string) bool {
+	token := parser.peek()
+	if (token.kind == "punct" || token.kind == "ident") && token.text == text {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func (parser *filterParser) expect(text string) error {
+	if !parser.accept(text) {
+		return errors.New("Expected " + text + " in filter, got " + parser.describe())
+	}
+	return nil
+}
+
+func (parser *filterParser) describe() string {
+	token := parser.peek()
+	switch token.kind {
+	case "eof":
+		return "the end"
+	case "field":
+		return "." + token.text
+	case "string":
+		return strconv.Quote(token.text)
+	}
+	return token.text
+}
+
+// parsePipe Parses "a | b", where b is given every output of a
+func (parser *filterParser) parsePipe() (filterFunc, error) {
+	left, err := parser.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("|") {
+		right, err := parser.parseComma()
+		if err != nil {
+			return nil, err
+		}
+		left = pipeFilters(left, right)
+	}
+	return left, nil
+}
+
+func pipeFilters(left, right filterFunc) filterFunc {
+	return func(input interface{}) (outputs []interface{}, err error) {
+		values, err := left(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			results, err := right(value)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, results...)
+		}
+		return
+	}
+}
+
+// parseComma Parses "a, b", the outputs of a followed by those of b
+func (parser *filterParser) parseComma() (filterFunc, error) {
+	left, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept(",") {
+		right, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		first := left
+		left = func(input interface{}) ([]interface{}, error) {
+			outputs, err := first(input)
+			if err != nil {
+				return nil, err
+			}
+			more, err := right(input)
+			return append(outputs, more...), err
+		}
+	}
+	return left, nil
+}
+
+func (parser *filterParser) parseOr() (filterFunc, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("or") {
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = combineFilters(left, right, func(a, b interface{}) (interface{}, error) {
+			return isTruthy(a) || isTruthy(b), nil
+		})
+	}
+	return left, nil
+}
+
+func (parser *filterParser) parseAnd() (filterFunc, error) {
+	left, err := parser.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("and") {
+		right, err := parser.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = combineFilters(left, right, func(a, b interface{}) (interface{}, error) {
+			return isTruthy(a) && isTruthy(b), nil
+		})
+	}
+	return left, nil
+}
+
+func (parser *filterParser) parseCompare() (filterFunc, error) {
+	left, err := parser.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !parser.accept(operator) {
+			continue
+		}
+		right, err := parser.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		operator := operator
+		return combineFilters(left, right, func(a, b interface{}) (interface{}, error) {
+			return compareJson(a, b, operator)
+		}), nil
+	}
+	return left, nil
+}
+
+// combineFilters Combines every output of left with every output of right
+func combineFilters(left, right filterFunc, combine func(a, b interface{}) (interface{}, error)) filterFunc {
+	return func(input interface{}) (outputs []interface{}, err error) {
+		lefts, err := left(input)
+		if err != nil {
+			return nil, err
+		}
+		rights, err := right(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range lefts {
+			for _, b := range rights {
+				combined, err := combine(a, b)
+				if err != nil {
+					return nil, err
+				}
+				outputs = append(outputs, combined)
+			}
+		}
+		return
+	}
+}
+
+// parsePostfix Parses a term followed by fields, subscripts and ?
+func (parser *filterParser) parsePostfix() (filterFunc, error) {
+	term, err := parser.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := parser.peek()
+		switch {
+		case token.kind == "field":
+			parser.pos++
+			term = pipeFilters(term, indexFilter(constantFilter(token.text)))
+		case token.kind == "punct" && token.text == "." && parser.tokens[parser.pos+1].kind == "string":
+			parser.pos++
+			key := parser.peek().text
+			parser.pos++
+			term = pipeFilters(term, indexFilter(constantFilter(key)))
+		case token.kind == "punct" && token.text == "." && parser.tokens[parser.pos+1].text == "[":
+			// .a.[0] is the same as .a[0]
+			parser.pos++
+		case token.kind == "punct" && token.text == "[":
+			parser.pos++
+			subscript, err := parser.parseSubscript()
+			if err != nil {
+				return nil, err
+			}
+			term = pipeThrough(term, subscript)
+		case token.kind == "punct" && token.text == "?":
+			parser.pos++
+			term = optionalFilter(term)
+		default:
+			return term, nil
+		}
+	}
+}
+
+// pipeThrough Pipes every output of term into the subscript, which is also
+// given the input of term for evaluating its index
+func pipeThrough(term filterFunc, subscript func(value, input interface{}) ([]interface{}, error)) filterFunc {
+	return func(input interface{}) (outputs []interface{}, err error) {
+		values, err := term(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			results, err := subscript(value, input)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, results...)
+		}
+		return
+	}
+}
+
+// parseSubscript Parses what's between [ and ]: nothing to iterate, a slice
+// or an index
+func (parser *filterParser) parseSubscript() (func(value, input interface{}) ([]interface{}, error), error) {
+	if parser.accept("]") {
+		return func(value, input interface{}) ([]interface{}, error) {
+			return iterateJson(value)
+		}, nil
+	}
+
+	// Slices only take numbers
+	start, end := parser.pos, parser.pos
+	if parser.tokens[end].kind == "number" {
+		end++
+	}
+	if parser.tokens[end].text == ":" {
+		var from, to *int
+		if end > start {
+			n, err := strconv.Atoi(parser.tokens[start].text)
+			if err != nil {
+				return nil, errors.New("Not a slice index " + parser.tokens[start].text)
+			}
+			from = &n
+		}
+		parser.pos = end + 1
+		if parser.peek().kind == "number" {
+			n, err := strconv.Atoi(parser.peek().text)
+			if err != nil {
+				return nil, errors.New("Not a slice index " + parser.peek().text)
+			}
+			to = &n
+			parser.pos++
+		}
+		if err := parser.expect("]"); err != nil {
+			return nil, err
+		}
+		return func(value, input interface{}) ([]interface{}, error) {
+			sliced, err := sliceJson(value, from, to)
+			return []interface{}{sliced}, err
+		}, nil
+	}
+
+	index, err := parser.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.expect("]"); err != nil {
+		return nil, err
+	}
+	return func(value, input interface{}) (outputs []interface{}, err error) {
+		keys, err := index(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			result, err := indexJson(value, key)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, result)
+		}
+		return
+	}, nil
+}
+
+func (parser *filterParser) parseTerm() (filterFunc, error) {
+	token := parser.peek()
+	parser.pos++
+	switch token.kind {
+	case "field":
+		return indexFilter(constantFilter(token.text)), nil
+	case "string":
+		return constantFilter(token.text), nil
+	case "number":
+		return constantFilter(json.Number(token.text)), nil
+	case "ident":
+		return parser.parseFunction(token.text)
+	case "eof":
+		parser.pos--
+		return nil, errors.New("Unexpected end of filter")
+	}
+
+	switch token.text {
+	case ".":
+		if parser.peek().kind == "string" {
+			key := parser.peek().text
+			parser.pos++
+			return indexFilter(constantFilter(key)), nil
+		}
+		return func(input interface{}) ([]interface{}, error) {
+			return []interface{}{input}, nil
+		}, nil
+	case "..":
+		return func(input interface{}) ([]interface{}, error) {
+			return recurseJson(input, nil), nil
+		}, nil
+	case "(":
+		inner, err := parser.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return inner, parser.expect(")")
+	case "[":
+		if parser.accept("]") {
+			return constantFilter([]interface{}{}), nil
+		}
+		inner, err := parser.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect("]"); err != nil {
+			return nil, err
+		}
+		return func(input interface{}) ([]interface{}, error) {
+			outputs, err := inner(input)
+			if outputs == nil {
+				outputs = []interface{}{}
+			}
+			return []interface{}{outputs}, err
+		}, nil
+	case "{":
+		return parser.parseObject()
+	}
+	parser.pos--
+	return nil, errors.New("Unexpected " + parser.describe() + " in filter")
+}
+
+// parseObject Parses {a: .x, "b c": .y, d}, where d is short for d: .d
+func (parser *filterParser) parseObject() (filterFunc, error) {
+	type entry struct {
+		key   string
+		value filterFunc
+	}
+	var entries []entry
+	for !parser.accept("}") {
+		if len(entries) > 0 {
+			if err := parser.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		token := parser.peek()
+		if token.kind != "ident" && token.kind != "string" {
+			return nil, errors.New("Expected an object key in filter, got " + parser.describe())
+		}
+		parser.pos++
+		value := indexFilter(constantFilter(token.text))
+		if parser.accept(":") {
+			var err error
+			if value, err = parser.parseOr(); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry{token.text, value})
+	}
+
+	return func(input interface{}) ([]interface{}, error) {
+		// An object for every combination of the values' outputs
+		objects := []map[string]interface{}{{}}
+		for _, entry := range entries {
+			values, err := entry.value(input)
+			if err != nil {
+				return nil, err
+			}
+			var next []map[string]interface{}
+			for _, object := range objects {
+				for _, value := range values {
+					copied := make(map[string]interface{}, len(object)+1)
+					for key, existing := range object {
+						copied[key] = existing
+					}
+					copied[entry.key] = value
+					next = append(next, copied)
+				}
+			}
+			objects = next
+		}
+		outputs := make([]interface{}, len(objects))
+		for i, object := range objects {
+			outputs[i] = object
+		}
+		return outputs, nil
+	}, nil
+}
+
+func (parser *filterParser) parseFunction(name string) (filterFunc, error) {
+	switch name {
+	case "true":
+		return constantFilter(true), nil
+	case "false":
+		return constantFilter(false), nil
+	case "null":
+		return constantFilter(nil), nil
+	case "empty":
+		return func(input interface{}) ([]interface{}, error) {
+			return nil, nil
+		}, nil
+	case "length", "keys", "first", "last", "type", "not", "tostring":
+		return func(input interface{}) ([]interface{}, error) {
+			result, err := callJsonFunction(name, input)
+			return []interface{}{result}, err
+		}, nil
+	case "map", "select", "has":
+		if err := parser.expect("("); err != nil {
+			return nil, err
+		}
+		argument, err := parser.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect(")"); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "map":
+			return func(input interface{}) ([]interface{}, error) {
+				values, err := iterateJson(input)
+				if err != nil {
+					return nil, err
+				}
+				mapped := []interface{}{}
+				for _, value := range values {
+					outputs, err := argument(value)
+					if err != nil {
+						return nil, err
+					}
+					mapped = append(mapped, outputs...)
+				}
+				return []interface{}{mapped}, nil
+			}, nil
+		case "select":
+			return func(input interface{}) (outputs []interface{}, err error) {
+				conditions, err := argument(input)
+				if err != nil {
+					return nil, err
+				}
+				for _, condition := range conditions {
+					if isTruthy(condition) {
+						outputs = append(outputs, input)
+					}
+				}
+				return
+			}, nil
+		}
+		return func(input interface{}) (outputs []interface{}, err error) {
+			keys, err := argument(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				has, err := hasJson(input, key)
+				if err != nil {
+					return nil, err
+				}
+				outputs = append(outputs, has)
+			}
+			return
+		}, nil
+	}
+	parser.pos--
+	return nil, errors.New("No such filter function " + name)
+}
+
+func constantFilter(value interface{}) filterFunc {
+	return func(interface{}) ([]interface{}, error) {
+		return []interface{}{value}, nil
+	}
+}
+
+// indexFilter Indexes the input by every output of key
+func indexFilter(key filterFunc) filterFunc {
+	return func(input interface{}) (outputs []interface{}, err error) {
+		keys, err := key(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			value, err := indexJson(input, key)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, value)
+		}
+		return
+	}
+}
+
+// optionalFilter Turns errors into no outputs
+func optionalFilter(filter filterFunc) filterFunc {
+	return func(input interface{}) ([]interface{}, error) {
+		outputs, err := filter(input)
+		if err != nil {
+			return nil, nil
+		}
+		return outputs, nil
+	}
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func jsonFloat(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case json.Number:
+		float, err := typed.Float64()
+		return float, err == nil
+	case float64:
+		return typed, true
+	}
+	return 0, false
+}
+
+func indexJson(value, key interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		if str, ok := key.(string); ok {
+			return typed[str], nil
+		}
+	case []interface{}:
+		if float, ok := jsonFloat(key); ok {
+			index := int(float)
+			// Negative indices count from the end
+			if index < 0 {
+				index += len(typed)
+			}
+			if index < 0 || index >= len(typed) {
+				return nil, nil
+			}
+			return typed[index], nil
+		}
+	}
+	return nil, fmt.Errorf("Cannot index %s with %s", jsonTypeName(value), jsonValueString(key))
+}
+
+func iterateJson(value interface{}) ([]interface{}, error) {
+	switch typed := value.(type) {
+	case []interface{}:
+		return typed, nil
+	case map[string]interface{}:
+		values := make([]interface{}, 0, len(typed))
+		for _, key := range sortedKeys(typed) {
+			values = append(values, typed[key])
+		}
+		return values, nil
+	}
+	return nil, errors.New("Cannot iterate over " + jsonTypeName(value))
+}
+
+func sliceJson(value interface{}, from, to *int) (interface{}, error) {
+	length := 0
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		length = len(typed)
+	case string:
+		length = len(typed)
+	default:
+		return nil, errors.New("Cannot slice " + jsonTypeName(value))
+	}
+	bound := func(index *int, otherwise int) int {
+		if index == nil {
+			return otherwise
+		}
+		n := *index
+		if n < 0 {
+			n += length
+		}
+		if n < 0 {
+			return 0
+		}
+		if n > length {
+			return length
+		}
+		return n
+	}
+	start, end := bound(from, 0), bound(to, length)
+	if end < start {
+		end = start
+	}
+	if str, ok := value.(string); ok {
+		return str[start:end], nil
+	}
+	return value.([]interface{})[start:end], nil
+}
+
+func recurseJson(value interface{}, outputs []interface{}) []interface{} {
+	outputs = append(outputs, value)
+	if children, err := iterateJson(value); err == nil {
+		for _, child := range children {
+			outputs = recurseJson(child, outputs)
+		}
+	}
+	return outputs
+}
+
+func hasJson(value, key interface{}) (bool, error) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if str, ok := key.(string); ok {
+			_, found := typed[str]
+			return found, nil
+		}
+	case []interface{}:
+		if float, ok := jsonFloat(key); ok {
+			return float >= 0 && int(float) < len(typed), nil
+		}
+	}
+	return false, fmt.Errorf("Cannot check whether %s has %s", jsonTypeName(value), jsonValueString(key))
+}
+
+func isTruthy(value interface{}) bool {
+	return value != nil && value != false
+}
+
+func callJsonFunction(name string, input interface{}) (interface{}, error) {
+	switch name {
+	case "type":
+		return jsonTypeName(input), nil
+	case "not":
+		return !isTruthy(input), nil
+	case "tostring":
+		return jsonValueString(input), nil
+	case "length":
+		switch typed := input.(type) {
+		case nil:
+			return json.Number("0"), nil
+		case string:
+			return json.Number(strconv.Itoa(utf8.RuneCountInString(typed))), nil
+		case []interface{}:
+			return json.Number(strconv.Itoa(len(typed))), nil
+		case map[string]interface{}:
+			return json.Number(strconv.Itoa(len(typed))), nil
+		}
+	case "keys":
+		switch typed := input.(type) {
+		case map[string]interface{}:
+			keys := []interface{}{}
+			for _, key := range sortedKeys(typed) {
+				keys = append(keys, key)
+			}
+			return keys, nil
+		case []interface{}:
+			keys := []interface{}{}
+			for i := range typed {
+				keys = append(keys, json.Number(strconv.Itoa(i)))
+			}
+			return keys, nil
+		}
+	case "first", "last":
+		if array, ok := input.([]interface{}); ok {
+			if len(array) == 0 {
+				return nil, nil
+			}
+			if name == "first" {
+				return array[0], nil
+			}
+			return array[len(array)-1], nil
+		}
+	}
+	return nil, errors.New(jsonTypeName(input) + " has no " + name)
+}
+
+// jsonTypeOrder The order values of different types are sorted in, like jq
+var jsonTypeOrder = map[string]int{"null": 0, "boolean": 1, "number": 2, "string": 3, "array": 4, "object": 5}
+
+func equalJson(a, b interface{}) bool {
+	if aFloat, ok := jsonFloat(a); ok {
+		bFloat, ok := jsonFloat(b)
+		return ok && aFloat == bFloat
+	}
+	switch typed := a.(type) {
+	case []interface{}:
+		other, ok := b.([]interface{})
+		if !ok || len(typed) != len(other) {
+			return false
+		}
+		for i := range typed {
+			if !equalJson(typed[i], other[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		other, ok := b.(map[string]interface{})
+		if !ok || len(typed) != len(other) {
+			return false
+		}
+		for key, value := range typed {
+			otherValue, found := other[key]
+			if !found || !equalJson(value, otherValue) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func compareJson(a, b interface{}, operator string) (bool, error) {
+	switch operator {
+	case "==":
+		return equalJson(a, b), nil
+	case "!=":
+		return !equalJson(a, b), nil
+	}
+
+	// -1, 0 or 1 as a is less than, equal to or greater than b
+	order := 0
+	aType, bType := jsonTypeName(a), jsonTypeName(b)
+	switch {
+	case aType != bType:
+		order = jsonTypeOrder[aType] - jsonTypeOrder[bType]
+	case aType == "number":
+		aFloat, _ := jsonFloat(a)
+		bFloat, _ := jsonFloat(b)
+		if aFloat < bFloat {
+			order = -1
+		} else if aFloat > bFloat {
+			order = 1
+		}
+	case aType == "string":
+		order = strings.Compare(a.(string), b.(string))
+	case aType == "boolean":
+		if a != b {
+			order = 1
+			if a == false {
+				order = -1
+			}
+		}
+	case aType == "null":
+	default:
+		return false, errors.New("Cannot compare " + aType + "s")
+	}
+
+	switch operator {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	}
+	return order >= 0, nil
+}
+
+// Filter Applies the jq-like filter expression to the JSON document and
+// returns its outputs. Expressions starting with $ are JSON paths instead,
+// see JsonPath.
+func Filter(document []byte, expression string) ([]interface{}, error) {
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "$") {
+		return JsonPath(document, expression)
+	}
+
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	parser := filterParser{tokens: tokens}
+	filter, err := parser.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if parser.peek().kind != "eof" {
+		return nil, errors.New("Unexpected " + parser.describe() + " in filter")
+	}
+
+	decoded, err := decodeJson(document)
+	if err != nil {
+		return nil, errors.New("Not JSON: " + err.Error())
+	}
+	return filter(decoded)
+}
+
+// FilterOutput Returns the filter's outputs one per line, as JSON indented
+// like FormatBody does or, when raw is set, with strings as they are.
+func FilterOutput(outputs []interface{}, raw, colored bool) (string, error) {
+	var result strings.Builder
+	for _, output := range outputs {
+		if str, ok := output.(string); ok && raw {
+			result.WriteString(str + "\n")
+			continue
+		}
+		encoded := jsonQuoteValue(output)
+		formatted, err := FormatBody(JsonBody, encoded, colored)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(formatted)
+	}
+	return result.String(), nil
+}
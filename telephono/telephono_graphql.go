@@ -0,0 +1,281 @@
+package telephono
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// GraphQLEnvelope Returns the JSON body of a GraphQL request for the query
+// and its variables, which must be a JSON object or empty, see
+// https://graphql.org/learn/serving-over-http/#post-request
+func GraphQLEnvelope(query, variables string) (string, error) {
+	envelope := struct {
+		Query     string          `json:"query"`
+		Variables json.RawMessage `json:"variables,omitempty"`
+	}{Query: strings.TrimSpace(query)}
+
+	if strings.TrimSpace(variables) != "" {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(variables), &parsed); err != nil {
+			return "", errors.New("The GraphQL variables must be a JSON object: " + err.Error())
+		}
+		envelope.Variables = json.RawMessage(variables)
+	}
+	encoded, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// GraphQLError is an error in a GraphQL response
+type GraphQLError struct {
+	Message   string        `json:"message"`
+	Path      []interface{} `json:"path"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations"`
+}
+
+// String Returns the error with where it happened, e.g.
+// "Cannot query field "nope" on type "Query" (line 1:3)"
+func (graphQLError GraphQLError) String() string {
+	result := graphQLError.Message
+	var where []string
+	if len(graphQLError.Path) > 0 {
+		path := []string{}
+		for _, part := range graphQLError.Path {
+			path = append(path, fmt.Sprint(part))
+		}
+		where = append(where, "at "+strings.Join(path, "."))
+	}
+	for _, location := range graphQLError.Locations {
+		where = append(where, fmt.Sprintf("line %d:%d", location.Line, location.Column))
+	}
+	if len(where) > 0 {
+		result += " (" + strings.Join(where, ", ") + ")"
+	}
+	return result
+}
+
+// GraphQLErrors Returns the errors in the body of a GraphQL response, nil if
+// there are none or the body isn't one.
+func GraphQLErrors(body []byte) []GraphQLError {
+	var response struct {
+		Errors []GraphQLError `json:"errors"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return nil
+	}
+	return response.Errors
+}
+
+// graphQLIntrospectionQuery Asks for every type with its fields, see
+// https://spec.graphql.org/June2018/#sec-Introspection
+const graphQLIntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind
+      name
+      description
+      fields(includeDeprecated: true) {
+        name
+        description
+        args { name type { ...TypeRef } defaultValue }
+        type { ...TypeRef }
+      }
+      inputFields { name type { ...TypeRef } defaultValue }
+      enumValues(includeDeprecated: true) { name }
+      possibleTypes { name }
+    }
+  }
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } }
+}`
+
+// GraphQLTypeRef is a reference to a type, wrapped in lists and non-nulls
+type GraphQLTypeRef struct {
+	Kind   string          `json:"kind"`
+	Name   string          `json:"name"`
+	OfType *GraphQLTypeRef `json:"ofType"`
+}
+
+// String Returns the type as written in GraphQL, e.g. "[User!]!"
+func (ref *GraphQLTypeRef) String() string {
+	if ref == nil {
+		return ""
+	}
+	switch ref.Kind {
+	case "NON_NULL":
+		return ref.OfType.String() + "!"
+	case "LIST":
+		return "[" + ref.OfType.String() + "]"
+	}
+	return ref.Name
+}
+
+// GraphQLField is a field of a type, or an argument or input field
+type GraphQLField struct {
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	Args         []GraphQLField `json:"args"`
+	Type         GraphQLTypeRef `json:"type"`
+	DefaultValue *string        `json:"defaultValue"`
+}
+
+// GraphQLType is a type of a schema
+type GraphQLType struct {
+	Kind          string         `json:"kind"`
+	Name          string         `json:"name"`
+	Description   string         `json:"description"`
+	Fields        []GraphQLField `json:"fields"`
+	InputFields   []GraphQLField `json:"inputFields"`
+	EnumValues    []struct{ Name string }
+	PossibleTypes []struct{ Name string }
+}
+
+// GraphQLSchema is what a server's introspection says about its schema
+type GraphQLSchema struct {
+	QueryType        *struct{ Name string } `json:"queryType"`
+	MutationType     *struct{ Name string } `json:"mutationType"`
+	SubscriptionType *struct{ Name string } `json:"subscriptionType"`
+	Types            []GraphQLType          `json:"types"`
+}
+
+// Type Returns the type with the given name, nil if there is none
+func (schema *GraphQLSchema) Type(name string) *GraphQLType {
+	for i := range schema.Types {
+		if schema.Types[i].Name == name {
+			return &schema.Types[i]
+		}
+	}
+	return nil
+}
+
+// IntrospectGraphQL Asks the GraphQL server at the template's URL for its
+// schema, using the template's headers.
+func (r *RequestTemplate) IntrospectGraphQL(ctx context.Context, client *http.Client, env *CallBuddyEnvironment) (*GraphQLSchema, error) {
+	introspection := r.Clone()
+	introspection.Method = Post
+	introspection.GraphQL = true
+	introspection.Body = graphQLIntrospectionQuery
+	introspection.Variables = ""
+	call, err := introspection.ExecuteContext(ctx, client, env)
+	if err != nil {
+		return nil, err
+	}
+	if errs := GraphQLErrors(call.Response.Body); len(errs) > 0 {
+		return nil, errors.New("Introspection failed: " + errs[0].String())
+	}
+	var response struct {
+		Data struct {
+			Schema *GraphQLSchema `json:"__schema"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(call.Response.Body, &response); err != nil || response.Data.Schema == nil {
+		return nil, errors.New("Not a GraphQL response: " + call.Response.Status)
+	}
+	return response.Data.Schema, nil
+}
+
+// formatFields Returns the fields one per line as in a GraphQL schema
+func formatFields(fields []GraphQLField) (result string) {
+	for _, field := range fields {
+		line := "  " + field.Name
+		if len(field.Args) > 0 {
+			args := []string{}
+			for _, arg := range field.Args {
+				formatted := arg.Name + ": " + arg.Type.String()
+				if arg.DefaultValue != nil {
+					formatted += " = " + *arg.DefaultValue
+				}
+				args = append(args, formatted)
+			}
+			line += "(" + strings.Join(args, ", ") + ")"
+		}
+		line += ": " + field.Type.String()
+		if field.DefaultValue != nil {
+			line += " = " + *field.DefaultValue
+		}
+		if field.Description != "" {
+			line += "  # " + strings.SplitN(field.Description, "\n", 2)[0]
+		}
+		result += line + "\n"
+	}
+	return
+}
+
+// Describe Returns the named type as in a GraphQL schema. Without a name, the
+// root types are described followed by a list of the other types.
+func (schema *GraphQLSchema) Describe(name string) (string, error) {
+	if name != "" {
+		described := schema.Type(name)
+		if described == nil {
+			return "", errors.New("No such type " + name)
+		}
+		return describeGraphQLType(described), nil
+	}
+
+	var result strings.Builder
+	roots := map[string]bool{}
+	for _, root := range []*struct{ Name string }{schema.QueryType, schema.MutationType, schema.SubscriptionType} {
+		if root != nil && schema.Type(root.Name) != nil {
+			roots[root.Name] = true
+			result.WriteString(describeGraphQLType(schema.Type(root.Name)) + "\n")
+		}
+	}
+
+	others := []string{}
+	for _, other := range schema.Types {
+		// The introspection types are the same for every schema
+		if !roots[other.Name] && !strings.HasPrefix(other.Name, "__") {
+			others = append(others, fmt.Sprintf("%-12s %s", strings.ToLower(other.Kind), other.Name))
+		}
+	}
+	sort.Strings(others)
+	result.WriteString("Other types:\n  " + strings.Join(others, "\n  ") + "\n")
+	return result.String(), nil
+}
+
+func describeGraphQLType(described *GraphQLType) string {
+	result := ""
+	if described.Description != "" {
+		result += "# " + strings.Replace(described.Description, "\n", "\n# ", -1) + "\n"
+	}
+	switch described.Kind {
+	case "OBJECT", "INTERFACE":
+		keyword := "type"
+		if described.Kind == "INTERFACE" {
+			keyword = "interface"
+		}
+		return result + keyword + " " + described.Name + " {\n" + formatFields(described.Fields) + "}\n"
+	case "INPUT_OBJECT":
+		return result + "input " + described.Name + " {\n" + formatFields(described.InputFields) + "}\n"
+	case "ENUM":
+		values := []string{}
+		for _, value := range described.EnumValues {
+			values = append(values, "  "+value.Name+"\n")
+		}
+		return result + "enum " + described.Name + " {\n" + strings.Join(values, "") + "}\n"
+	case "UNION":
+		members := []string{}
+		for _, member := range described.PossibleTypes {
+			members = append(members, member.Name)
+		}
+		return result + "union " + described.Name + " = " + strings.Join(members, " | ") + "\n"
+	}
+	return result + "scalar " + described.Name + "\n"
+}
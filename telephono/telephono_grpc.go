@@ -0,0 +1,477 @@
+package telephono
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcHttpStatus The HTTP status of each gRPC status code, see
+// https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
+var grpcHttpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// GrpcTarget is where a gRPC call goes, parsed from a URL such as
+// grpc://localhost:50051/package.Service/Method. grpcs:// uses TLS.
+type GrpcTarget struct {
+	Address string
+	TLS     bool
+
+	// The fully qualified service and the method, empty when only the
+	// server is given
+	Service string
+	Method  string
+}
+
+// IsGrpcUrl Returns whether the URL is a gRPC one
+func IsGrpcUrl(url string) bool {
+	return strings.HasPrefix(url, "grpc://") || strings.HasPrefix(url, "grpcs://")
+}
+
+// ParseGrpcUrl Parses a grpc:// or grpcs:// URL. The service and method can
+// also be separated by a dot, as in package.Service.Method.
+func ParseGrpcUrl(url string) (target GrpcTarget, err error) {
+	rest := url
+	if strings.HasPrefix(url, "grpcs://") {
+		target.TLS, rest = true, strings.TrimPrefix(url, "grpcs://")
+	} else if strings.HasPrefix(url, "grpc://") {
+		rest = strings.TrimPrefix(url, "grpc://")
+	} else {
+		return target, errors.New("Not a gRPC URL " + url + ", use e.g. grpc://localhost:50051/package.Service/Method")
+	}
+
+	path := ""
+	if slash := strings.IndexByte(rest, '/'); slash >= 0 {
+		rest, path = rest[:slash], strings.Trim(rest[slash+1:], "/")
+	}
+	if rest == "" {
+		return target, errors.New("No server in " + url)
+	}
+	target.Address = rest
+	if !strings.Contains(rest, ":") {
+		if target.TLS {
+			target.Address += ":443"
+		} else {
+			target.Address += ":80"
+		}
+	}
+	if path == "" {
+		return target, nil
+	}
+
+	if slash := strings.LastIndexByte(path, '/'); slash >= 0 {
+		target.Service, target.Method = path[:slash], path[slash+1:]
+	} else if dot := strings.LastIndexByte(path, '.'); dot >= 0 {
+		target.Service, target.Method = path[:dot], path[dot+1:]
+	} else {
+		target.Service = path
+	}
+	return target, nil
+}
+
+// dialGrpc Connects to the target with the TLS settings of the client
+func dialGrpc(ctx context.Context, target GrpcTarget, client *http.Client) (*grpc.ClientConn, error) {
+	transportCredentials := insecure.NewCredentials()
+	if target.TLS {
+		tlsConfig := &tls.Config{}
+		if transport := httpTransport(client); transport != nil && transport.TLSClientConfig != nil {
+			tlsConfig = transport.TLSClientConfig.Clone()
+		}
+		// gRPC always uses HTTP/2, whatever the client negotiates
+		tlsConfig.NextProtos = nil
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+	return grpc.DialContext(ctx, target.Address, grpc.WithTransportCredentials(transportCredentials))
+}
+
+// grpcReflection Looks up services and their messages using server
+// reflection, see https://github.com/grpc/grpc/blob/master/doc/server-reflection.md
+type grpcReflection struct {
+	stream reflectionpb.ServerReflection_ServerReflectionInfoClient
+	files  map[string]*descriptorpb.FileDescriptorProto
+}
+
+func newGrpcReflection(ctx context.Context, conn *grpc.ClientConn) (*grpcReflection, error) {
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcReflection{stream: stream, files: map[string]*descriptorpb.FileDescriptorProto{}}, nil
+}
+
+func (reflection *grpcReflection) ask(request *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	if err := reflection.stream.Send(request); err != nil {
+		return nil, reflectionError(err)
+	}
+	response, err := reflection.stream.Recv()
+	if err != nil {
+		return nil, reflectionError(err)
+	}
+	if problem := response.GetErrorResponse(); problem != nil {
+		return nil, errors.New(problem.ErrorMessage)
+	}
+	return response, nil
+}
+
+// reflectionError Explains that servers without reflection can't be called
+func reflectionError(err error) error {
+	if status.Code(err) == codes.Unimplemented {
+		return errors.New("The server doesn't support gRPC reflection, which is needed to call it")
+	}
+	return err
+}
+
+// services Returns the names of the services of the server, sorted
+func (reflection *grpcReflection) services() ([]string, error) {
+	response, err := reflection.ask(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, service := range response.GetListServicesResponse().GetService() {
+		names = append(names, service.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// addFiles Adds the files in the response, the server sends each file only
+// once per stream
+func (reflection *grpcReflection) addFiles(response *reflectionpb.ServerReflectionResponse) error {
+	for _, encoded := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(encoded, file); err != nil {
+			return err
+		}
+		reflection.files[file.GetName()] = file
+	}
+	return nil
+}
+
+// service Returns the descriptor of the service with the given name
+func (reflection *grpcReflection) service(name string) (protoreflect.ServiceDescriptor, error) {
+	response, err := reflection.ask(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: name},
+	})
+	if err != nil {
+		return nil, errors.New("No such service " + name + ": " + err.Error())
+	}
+	if err := reflection.addFiles(response); err != nil {
+		return nil, err
+	}
+
+	// Servers should send the dependencies along, ask for any they didn't
+	for missing := reflection.missingDependency(); missing != ""; missing = reflection.missingDependency() {
+		if known, err := protoregistry.GlobalFiles.FindFileByPath(missing); err == nil {
+			reflection.files[missing] = protodesc.ToFileDescriptorProto(known)
+			continue
+		}
+		response, err := reflection.ask(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: missing},
+		})
+		if err != nil {
+			return nil, errors.New("Can't get " + missing + ": " + err.Error())
+		}
+		if err := reflection.addFiles(response); err != nil {
+			return nil, err
+		}
+		if reflection.files[missing] == nil {
+			return nil, errors.New("The server didn't send " + missing)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range reflection.files {
+		set.File = append(set.File, file)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, errors.New("No such service " + name)
+	}
+	service, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errors.New(name + " isn't a service")
+	}
+	return service, nil
+}
+
+// missingDependency Returns a file the files depend on but that isn't known,
+// empty if there is none
+func (reflection *grpcReflection) missingDependency() string {
+	for _, file := range reflection.files {
+		for _, dependency := range file.Dependency {
+			if reflection.files[dependency] == nil {
+				return dependency
+			}
+		}
+	}
+	return ""
+}
+
+// describeMethod Returns the method as in a .proto file, e.g.
+// "Check(grpc.health.v1.HealthCheckRequest) returns (grpc.health.v1.HealthCheckResponse)"
+func describeMethod(method protoreflect.MethodDescriptor) string {
+	input, output := string(method.Input().FullName()), string(method.Output().FullName())
+	if method.IsStreamingClient() {
+		input = "stream " + input
+	}
+	if method.IsStreamingServer() {
+		output = "stream " + output
+	}
+	return fmt.Sprintf("%s(%s) returns (%s)", method.Name(), input, output)
+}
+
+// describeMessage Returns the fields of the message, one per line
+func describeMessage(message protoreflect.MessageDescriptor) string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "message %s {\n", message.FullName())
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		kind := field.Kind().String()
+		switch {
+		case field.IsMap():
+			kind = fmt.Sprintf("map<%s, %s>", fieldType(field.MapKey()), fieldType(field.MapValue()))
+		case field.IsList():
+			kind = "repeated " + fieldType(field)
+		default:
+			kind = fieldType(field)
+		}
+		fmt.Fprintf(&result, "  %s %s = %d; // JSON: %s\n", kind, field.Name(), field.Number(), field.JSONName())
+	}
+	result.WriteString("}\n")
+	return result.String()
+}
+
+func fieldType(field protoreflect.FieldDescriptor) string {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(field.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(field.Enum().FullName())
+	}
+	return field.Kind().String()
+}
+
+// DescribeGrpc Returns the services and methods of the server at the gRPC
+// URL, found using server reflection. When the URL names a service, only its
+// methods are described, and when it names a method, its request and response
+// messages are described too.
+func DescribeGrpc(ctx context.Context, client *http.Client, url string) (string, error) {
+	target, err := ParseGrpcUrl(url)
+	if err != nil {
+		return "", err
+	}
+	conn, err := dialGrpc(ctx, target, client)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	reflection, err := newGrpcReflection(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+
+	names := []string{target.Service}
+	if target.Service == "" {
+		if names, err = reflection.services(); err != nil {
+			return "", err
+		}
+	}
+	var result strings.Builder
+	for _, name := range names {
+		if name == "grpc.reflection.v1alpha.ServerReflection" || name == "grpc.reflection.v1.ServerReflection" {
+			continue
+		}
+		service, err := reflection.service(name)
+		if err != nil {
+			return "", err
+		}
+		if target.Method != "" {
+			method := service.Methods().ByName(protoreflect.Name(target.Method))
+			if method == nil {
+				return "", errors.New("No such method " + target.Method + " in " + name)
+			}
+			fmt.Fprintf(&result, "%s/%s\n\n", name, describeMethod(method))
+			result.WriteString(describeMessage(method.Input()) + "\n" + describeMessage(method.Output()))
+			return result.String(), nil
+		}
+		fmt.Fprintf(&result, "%s\n", name)
+		methods := service.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			fmt.Fprintf(&result, "  %s\n", describeMethod(methods.Get(i)))
+		}
+	}
+	return result.String(), nil
+}
+
+// grpcAuthorization Returns the authorization metadata gRPC calls send, like
+// the Authorization header apply sets. Digest and AWS authentication sign HTTP
+// requests, so they can't be used.
+func (auth *Auth) grpcAuthorization(env *CallBuddyEnvironment) (string, error) {
+	if auth.Type == DigestAuth || auth.Type == AWSAuth {
+		return "", errors.New(auth.Type + " authentication can't be used for gRPC calls, use basic, bearer or oauth2")
+	}
+	httpRequest := &http.Request{Header: http.Header{}}
+	if err := auth.apply(httpRequest, "", env); err != nil {
+		return "", err
+	}
+	return httpRequest.Header.Get("Authorization"), nil
+}
+
+// executeGrpc Makes the template's call as a unary gRPC call. The body is the
+// JSON form of the request message and the headers are sent as metadata. The
+// response's body is the JSON form of the response message, or of the status
+// when the call failed, and its headers are the response metadata and
+// trailers.
+func (r *RequestTemplate) executeGrpc(ctx context.Context, client *http.Client, env *CallBuddyEnvironment) (HistoricalCall, error) {
+	started := time.Now()
+	expandedUrl := env.Expand(r.Url)
+	target, err := ParseGrpcUrl(expandedUrl)
+	if err != nil {
+		return HistoricalCall{}, err
+	}
+	if target.Method == "" {
+		return HistoricalCall{}, errors.New("No method in " + expandedUrl + ", use e.g. grpc://localhost:50051/package.Service/Method")
+	}
+	expandedBody := env.OS.Expand(env.User.Expand(r.Body))
+	header := http.Header{}
+	outgoing := metadata.MD{}
+	for key, values := range r.Headers {
+		for _, value := range values {
+			header.Add(key, env.Expand(value))
+			outgoing.Append(key, env.Expand(value))
+		}
+	}
+	if r.Auth != nil {
+		authorization, err := r.Auth.grpcAuthorization(env)
+		if err != nil {
+			return HistoricalCall{}, err
+		}
+		header.Set("Authorization", authorization)
+		outgoing.Set("authorization", authorization)
+	}
+	request := Request{Method: r.Method, URL: expandedUrl, Header: header, Body: []byte(expandedBody)}
+
+	conn, err := dialGrpc(ctx, target, client)
+	if err != nil {
+		return HistoricalCall{}, err
+	}
+	defer conn.Close()
+	if client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.Timeout)
+		defer cancel()
+	}
+	reflection, err := newGrpcReflection(ctx, conn)
+	if err != nil {
+		return HistoricalCall{}, err
+	}
+	service, err := reflection.service(target.Service)
+	if err != nil {
+		return HistoricalCall{}, err
+	}
+	method := service.Methods().ByName(protoreflect.Name(target.Method))
+	if method == nil {
+		return HistoricalCall{}, errors.New("No such method " + target.Method + " in " + target.Service)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return HistoricalCall{}, errors.New("Only unary methods can be called, " + describeMethod(method) + " streams")
+	}
+
+	input := dynamicpb.NewMessage(method.Input())
+	if strings.TrimSpace(expandedBody) != "" {
+		if err := protojson.Unmarshal([]byte(expandedBody), input); err != nil {
+			return HistoricalCall{}, errors.New("The body isn't a " + string(method.Input().FullName()) + ": " + err.Error())
+		}
+	}
+	output := dynamicpb.NewMessage(method.Output())
+	var responseHeader, responseTrailer metadata.MD
+	fullMethod := "/" + target.Service + "/" + target.Method
+	callErr := conn.Invoke(metadata.NewOutgoingContext(ctx, outgoing), fullMethod, input, output, grpc.Header(&responseHeader), grpc.Trailer(&responseTrailer))
+	callStatus := status.Convert(callErr)
+	if callErr != nil && ctx.Err() != nil {
+		return HistoricalCall{}, ctx.Err()
+	}
+	if callStatus.Code() == codes.Unavailable && len(responseHeader) == 0 {
+		// The server couldn't be reached, rather than answering with an error
+		return HistoricalCall{}, errors.New(callStatus.Message())
+	}
+
+	response := Response{Proto: "HTTP/2.0", Header: http.Header{}}
+	for _, md := range []metadata.MD{responseHeader, responseTrailer} {
+		for key, values := range md {
+			for _, value := range values {
+				response.Header.Add(key, value)
+			}
+		}
+	}
+	// The body is JSON, not the protobuf the server sent
+	response.Header.Set("Content-Type", "application/json")
+	response.Header.Set("Grpc-Status", strconv.Itoa(int(callStatus.Code())))
+	response.StatusCode = grpcHttpStatus[callStatus.Code()]
+	response.Status = fmt.Sprintf("%d %s", response.StatusCode, callStatus.Code())
+	if callErr == nil {
+		response.Body, err = protojson.Marshal(output)
+	} else {
+		response.Header.Set("Grpc-Message", callStatus.Message())
+		statusMessage := callStatus.Proto()
+		if response.Body, err = protojson.Marshal(statusMessage); err != nil {
+			// Details of types the server didn't describe can't be shown
+			statusMessage.Details = nil
+			response.Body, err = protojson.Marshal(statusMessage)
+		}
+	}
+	if err != nil {
+		return HistoricalCall{}, err
+	}
+
+	request.maskSecrets(env)
+	return HistoricalCall{Request: request, Response: response, Timing: CallTiming{Total: time.Since(started)}}, nil
+}
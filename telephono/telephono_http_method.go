@@ -4,16 +4,21 @@ import (
 	"encoding/json"
 	"errors"
 	"strings"
+	"unicode"
 )
 
 type HttpMethod string
 
 const (
-	Post   HttpMethod = "POST"
-	Get               = "GET"
-	Put               = "PUT"
-	Delete            = "DELETE"
-	Head              = "HEAD"
+	Post    HttpMethod = "POST"
+	Get                = "GET"
+	Put                = "PUT"
+	Delete             = "DELETE"
+	Head               = "HEAD"
+	Patch              = "PATCH"
+	Options            = "OPTIONS"
+	Trace              = "TRACE"
+	Connect            = "CONNECT"
 )
 
 // FIXME DG? Is this necessary?
@@ -32,7 +37,7 @@ func (m HttpMethod) MarshalJSON() ([]byte, error) {
 }
 
 func AllHttpMethods() []HttpMethod {
-	return []HttpMethod{Post, Get, Put, Delete, Head}
+	return []HttpMethod{Post, Get, Put, Delete, Head, Patch, Options, Trace, Connect}
 }
 
 func (m HttpMethod) String() string {
@@ -52,6 +57,45 @@ func toHttpMethod(method string) (HttpMethod, error) {
 		return Delete, nil
 	case "HEAD":
 		return Head, nil
+	case "PATCH":
+		return Patch, nil
+	case "OPTIONS":
+		return Options, nil
+	case "TRACE":
+		return Trace, nil
+	case "CONNECT":
+		return Connect, nil
 	}
-	return "", errors.New("No such HTTP method " + method)
+
+	// Anything else is a custom method e.g. WebDAV's PROPFIND, as long as
+	// it's a valid HTTP token. Methods are case-sensitive (RFC 9110 section
+	// 9.1), so only the standard ones are upper-cased.
+	if method == "" || strings.IndexFunc(method, notTokenChar) != -1 {
+		return "", errors.New("No such HTTP method " + method)
+	}
+	return HttpMethod(method), nil
+}
+
+// ToHttpMethod Returns the method with the given name, which is either one of
+// AllHttpMethods or a custom method
+func ToHttpMethod(method string) (HttpMethod, error) {
+	return toHttpMethod(method)
+}
+
+// IsCustom Returns whether the method is not one of AllHttpMethods
+func (m HttpMethod) IsCustom() bool {
+	for _, method := range AllHttpMethods() {
+		if m == method {
+			return false
+		}
+	}
+	return true
+}
+
+// notTokenChar Returns whether the rune can't be in a HTTP token (RFC 7230)
+func notTokenChar(r rune) bool {
+	if r > unicode.MaxASCII || r <= ' ' || r == 0x7f {
+		return true
+	}
+	return strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
 }
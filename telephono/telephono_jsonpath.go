@@ -0,0 +1,170 @@
+package telephono
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is one step of a JSON path, either a key, an index or a
+// wildcard matching every element
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJsonPath Parses JSON paths such as $.items[0].name, $['a key'] or
+// $.items[*].id. The leading $ is optional.
+func parseJsonPath(path string) (steps []jsonPathStep, err error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end == -1 {
+				end = len(path)
+			}
+			key := path[:end]
+			if key == "" {
+				return nil, errors.New("Empty key in JSON path")
+			}
+			if key == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{key: key})
+			}
+			path = path[end:]
+		case '[':
+			end := strings.Index(path, "]")
+			if end == -1 {
+				return nil, errors.New("Missing ] in JSON path")
+			}
+			inside := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+
+			if inside == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else if len(inside) >= 2 && (inside[0] == '\'' || inside[0] == '"') && inside[len(inside)-1] == inside[0] {
+				steps = append(steps, jsonPathStep{key: inside[1 : len(inside)-1]})
+			} else if index, err := strconv.Atoi(inside); err == nil {
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			} else {
+				return nil, errors.New("Invalid JSON path subscript [" + inside + "]")
+			}
+		default:
+			// Allow "a.b" as well as ".a.b"
+			if len(steps) == 0 {
+				path = "." + path
+				continue
+			}
+			return nil, errors.New("Unexpected " + string(path[0]) + " in JSON path")
+		}
+	}
+	return
+}
+
+// applyJsonPath Returns every value in the decoded JSON document the steps
+// lead to. Missing keys or indices lead nowhere rather than being errors.
+func applyJsonPath(document interface{}, steps []jsonPathStep) []interface{} {
+	values := []interface{}{document}
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range values {
+			switch typed := value.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					for _, key := range sortedKeys(typed) {
+						next = append(next, typed[key])
+					}
+				} else if !step.isIndex {
+					if child, found := typed[step.key]; found {
+						next = append(next, child)
+					}
+				}
+			case []interface{}:
+				if step.wildcard {
+					next = append(next, typed...)
+				} else if step.isIndex {
+					index := step.index
+					// Negative indices count from the end
+					if index < 0 {
+						index += len(typed)
+					}
+					if index >= 0 && index < len(typed) {
+						next = append(next, typed[index])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// JsonPath Returns the values the JSON path leads to in the JSON document.
+func JsonPath(document []byte, path string) ([]interface{}, error) {
+	steps, err := parseJsonPath(path)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeJson(document)
+	if err != nil {
+		return nil, errors.New("Not JSON: " + err.Error())
+	}
+	return applyJsonPath(decoded, steps), nil
+}
+
+// decodeJson Decodes the JSON document keeping numbers as they were written
+// so large integers such as IDs don't lose precision
+func decodeJson(document []byte) (decoded interface{}, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	if err = decoder.Decode(&decoded); err != nil {
+		return
+	}
+	if decoder.More() {
+		err = errors.New("Trailing data after the JSON document")
+	}
+	return
+}
+
+// JsonPathString Returns the single value the JSON path leads to as a string.
+// Strings are returned as is, anything else as JSON.
+func JsonPathString(document []byte, path string) (string, error) {
+	values, err := JsonPath(document, path)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", errors.New("Nothing at JSON path " + path)
+	}
+	if len(values) > 1 {
+		return "", errors.New("More than one value at JSON path " + path)
+	}
+	return jsonValueString(values[0]), nil
+}
+
+func jsonValueString(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
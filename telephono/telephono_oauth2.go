@@ -0,0 +1,330 @@
+package telephono
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The grants OAuth2 access tokens can be requested with, see
+// https://tools.ietf.org/html/rfc6749#section-4
+const (
+	ClientCredentialsGrant = "client_credentials"
+	PasswordGrant          = "password"
+	RefreshTokenGrant      = "refresh_token"
+)
+
+// The variables of the User environment OAuth2 tokens are cached in, which
+// templates using OAuth2Auth send
+const (
+	OAuth2AccessToken  = "OAUTH2_ACCESS_TOKEN"
+	OAuth2RefreshToken = "OAUTH2_REFRESH_TOKEN"
+	OAuth2Expires      = "OAUTH2_EXPIRES"
+)
+
+// OAuth2Variables The variables OAuth2 tokens are cached in
+var OAuth2Variables = []string{OAuth2AccessToken, OAuth2RefreshToken, OAuth2Expires}
+
+// oauth2Token Returns the cached OAuth2 variable, decrypted when it's a secret
+func oauth2Token(env *CallBuddyEnvironment, name string) string {
+	if value, ok := env.User.Mapping[name]; ok {
+		return value
+	}
+	if ciphertext, ok := env.User.Secrets[name]; ok && env.User.key != nil {
+		value, _ := env.User.key.Decrypt(ciphertext)
+		return value
+	}
+	return ""
+}
+
+// setOAuth2Token Caches the token in the User environment, encrypted like a
+// secret variable when the environment is unlocked. Tokens that can't be
+// encrypted aren't saved with the profile, see withoutPlainOAuth2Tokens.
+func setOAuth2Token(env *CallBuddyEnvironment, name, token string) error {
+	if env.User.key != nil {
+		return env.User.SetSecret(name, token)
+	}
+	env.User.Set(name, token)
+	return nil
+}
+
+// ForgetOAuth2Tokens Removes the cached OAuth2 tokens from the environment
+func ForgetOAuth2Tokens(env *CallBuddyEnvironment) {
+	for _, variable := range OAuth2Variables {
+		delete(env.User.Mapping, variable)
+		delete(env.User.Secrets, variable)
+	}
+}
+
+// withoutPlainOAuth2Tokens Returns a copy of the User environment without the
+// OAuth2 tokens that weren't encrypted, so they are only kept for the session
+// rather than saved in plaintext
+func withoutPlainOAuth2Tokens(user *Environment) Environment {
+	if _, ok := user.Mapping[OAuth2AccessToken]; !ok {
+		if _, ok := user.Mapping[OAuth2RefreshToken]; !ok {
+			return *user
+		}
+	}
+	saved := user.Clone()
+	if _, ok := saved.Mapping[OAuth2AccessToken]; ok {
+		// The expiry is of no use without the token
+		delete(saved.Mapping, OAuth2AccessToken)
+		delete(saved.Mapping, OAuth2Expires)
+	}
+	delete(saved.Mapping, OAuth2RefreshToken)
+	return saved
+}
+
+// oauth2ExpiryMargin Tokens expiring this soon are renewed before a call, so
+// they don't expire while it's made
+const oauth2ExpiryMargin = 30 * time.Second
+
+// OAuth2Config is how a profile gets OAuth2 access tokens for the templates
+// that authenticate with OAuth2Auth. Every field but Grant is expanded like
+// headers are, so secrets can be kept in variables.
+type OAuth2Config struct {
+	// One of ClientCredentialsGrant, PasswordGrant and RefreshTokenGrant
+	Grant string
+
+	// The token endpoint of the identity provider
+	TokenUrl string
+
+	// The client, the secret is empty for public clients
+	ClientID     string
+	ClientSecret string `json:",omitempty"`
+
+	// The space separated scopes asked for, empty for the default ones
+	Scope string `json:",omitempty"`
+
+	// The resource owner of PasswordGrant
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+
+	// The refresh token RefreshTokenGrant starts with
+	RefreshToken string `json:",omitempty"`
+}
+
+// oauth2Grants The grants as given to the oauth2 command
+var oauth2Grants = map[string]string{
+	"client-credentials": ClientCredentialsGrant,
+	"password":           PasswordGrant,
+	"refresh-token":      RefreshTokenGrant,
+}
+
+// ParseOAuth2 Parses the configuration from the arguments of the oauth2
+// command, e.g. "client-credentials TOKEN-URL CLIENT-ID CLIENT-SECRET
+// [SCOPE]". A CLIENT-SECRET of - is no secret.
+func ParseOAuth2(args []string) (OAuth2Config, error) {
+	usage := errors.New("Expected client-credentials, password or refresh-token followed by TOKEN-URL CLIENT-ID CLIENT-SECRET")
+	if len(args) < 4 {
+		return OAuth2Config{}, usage
+	}
+	config := OAuth2Config{Grant: oauth2Grants[strings.ToLower(args[0])], TokenUrl: args[1], ClientID: args[2], ClientSecret: args[3]}
+	if config.ClientSecret == "-" {
+		config.ClientSecret = ""
+	}
+	args = args[4:]
+	switch config.Grant {
+	case ClientCredentialsGrant:
+	case PasswordGrant:
+		if len(args) < 2 {
+			return OAuth2Config{}, errors.New("Expected password TOKEN-URL CLIENT-ID CLIENT-SECRET USER PASSWORD [SCOPE]")
+		}
+		config.Username, config.Password, args = args[0], args[1], args[2:]
+	case RefreshTokenGrant:
+		if len(args) < 1 {
+			return OAuth2Config{}, errors.New("Expected refresh-token TOKEN-URL CLIENT-ID CLIENT-SECRET REFRESH-TOKEN [SCOPE]")
+		}
+		config.RefreshToken, args = args[0], args[1:]
+	default:
+		return OAuth2Config{}, usage
+	}
+	config.Scope = strings.Join(args, " ")
+	return config, nil
+}
+
+// String Returns the configuration like it's given to the oauth2 command,
+// with secrets that aren't in variables hidden
+func (config OAuth2Config) String() string {
+	grant := config.Grant
+	for name, value := range oauth2Grants {
+		if value == config.Grant {
+			grant = name
+		}
+	}
+	secret := "-"
+	if config.ClientSecret != "" {
+		secret = maskSecret(config.ClientSecret)
+	}
+	parts := []string{grant, config.TokenUrl, config.ClientID, secret}
+	switch config.Grant {
+	case PasswordGrant:
+		parts = append(parts, config.Username, maskSecret(config.Password))
+	case RefreshTokenGrant:
+		parts = append(parts, maskSecret(config.RefreshToken))
+	}
+	if config.Scope != "" {
+		parts = append(parts, config.Scope)
+	}
+	return strings.Join(parts, " ")
+}
+
+// oauth2TokenResponse is what token endpoints answer with, see
+// https://tools.ietf.org/html/rfc6749#section-5
+type oauth2TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// requestToken Asks the token endpoint for an access token with the given
+// grant and stores it in the User environment
+func (config *OAuth2Config) requestToken(ctx context.Context, client *http.Client, env *CallBuddyEnvironment, grant string) error {
+	form := url.Values{"grant_type": {grant}}
+	if scope := env.Expand(config.Scope); scope != "" {
+		form.Set("scope", scope)
+	}
+	switch grant {
+	case PasswordGrant:
+		form.Set("username", env.Expand(config.Username))
+		form.Set("password", env.Expand(config.Password))
+	case RefreshTokenGrant:
+		refreshToken := oauth2Token(env, OAuth2RefreshToken)
+		if refreshToken == "" {
+			refreshToken = env.Expand(config.RefreshToken)
+		}
+		form.Set("refresh_token", refreshToken)
+	}
+	clientID, clientSecret := env.Expand(config.ClientID), env.Expand(config.ClientSecret)
+	if clientSecret == "" {
+		// Public clients only say who they are
+		form.Set("client_id", clientID)
+	}
+
+	httpRequest, err := http.NewRequest("POST", env.Expand(config.TokenUrl), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpRequest.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		httpRequest.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+	httpResponse, err := client.Do(httpRequest.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	body, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+
+	var token oauth2TokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return errors.New("The token endpoint didn't answer with a token: " + httpResponse.Status)
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		message := "The token request failed: " + httpResponse.Status
+		if token.Error != "" {
+			message += ", " + token.Error
+		}
+		if token.ErrorDescription != "" {
+			message += ": " + token.ErrorDescription
+		}
+		return errors.New(message)
+	}
+
+	if err := setOAuth2Token(env, OAuth2AccessToken, token.AccessToken); err != nil {
+		return err
+	}
+	if token.RefreshToken != "" {
+		if err := setOAuth2Token(env, OAuth2RefreshToken, token.RefreshToken); err != nil {
+			return err
+		}
+	}
+	delete(env.User.Mapping, OAuth2Expires)
+	if token.ExpiresIn > 0 {
+		env.User.Set(OAuth2Expires, time.Now().Add(time.Duration(token.ExpiresIn)*time.Second).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// TokenExpired Returns whether there is no access token in the environment or
+// it expires within a few seconds. Tokens without an expiry never expire.
+func (config *OAuth2Config) TokenExpired(env *CallBuddyEnvironment) bool {
+	if oauth2Token(env, OAuth2AccessToken) == "" {
+		return true
+	}
+	expires, err := time.Parse(time.RFC3339, env.User.Mapping[OAuth2Expires])
+	return err == nil && time.Until(expires) < oauth2ExpiryMargin
+}
+
+// RenewToken Gets a new access token and stores it in the User environment
+// along with its refresh token and expiry, encrypted when the environment is
+// unlocked. The cached refresh token is used
+// when there is one, falling back to the configured grant if it's refused.
+func (config *OAuth2Config) RenewToken(ctx context.Context, client *http.Client, env *CallBuddyEnvironment) error {
+	if oauth2Token(env, OAuth2RefreshToken) != "" && config.Grant != RefreshTokenGrant {
+		if err := config.requestToken(ctx, client, env, RefreshTokenGrant); err == nil || ctx.Err() != nil {
+			return err
+		}
+		delete(env.User.Mapping, OAuth2RefreshToken)
+		delete(env.User.Secrets, OAuth2RefreshToken)
+	}
+	return config.requestToken(ctx, client, env, config.Grant)
+}
+
+// TokenStatus Returns whether there is an access token in the environment and
+// when it expires
+func (config *OAuth2Config) TokenStatus(env *CallBuddyEnvironment) string {
+	if oauth2Token(env, OAuth2AccessToken) == "" {
+		return "No access token yet, one is requested before the first call."
+	}
+	expires, err := time.Parse(time.RFC3339, env.User.Mapping[OAuth2Expires])
+	if err != nil {
+		return "The access token in User." + OAuth2AccessToken + " doesn't expire."
+	}
+	if left := time.Until(expires); left > 0 {
+		return fmt.Sprintf("The access token in User.%s expires in %s.", OAuth2AccessToken, left.Round(time.Second))
+	}
+	return "The access token in User." + OAuth2AccessToken + " has expired, a new one is requested before the next call."
+}
+
+// ExecuteOAuth2 Is ExecuteLimited where templates authenticating with
+// OAuth2Auth get an access token first if there is none in the environment
+// or it has expired, and once more if the server answers 401 Unauthorized.
+// The tokens are stored in the User environment.
+func (r *RequestTemplate) ExecuteOAuth2(ctx context.Context, client *http.Client, env *CallBuddyEnvironment, config *OAuth2Config, limit BodyLimit) (HistoricalCall, error) {
+	if r.Auth == nil || r.Auth.Type != OAuth2Auth {
+		return r.ExecuteLimited(ctx, client, env, limit)
+	}
+	if config == nil {
+		return HistoricalCall{}, errors.New("The template authenticates with OAuth2 but the profile has no oauth2 configuration")
+	}
+	renewed := false
+	if config.TokenExpired(env) {
+		if err := config.RenewToken(ctx, client, env); err != nil {
+			return HistoricalCall{}, err
+		}
+		renewed = true
+	}
+	call, err := r.ExecuteLimited(ctx, client, env, limit)
+	if err != nil || renewed || call.Response.StatusCode != http.StatusUnauthorized {
+		return call, err
+	}
+	// The token may have been revoked before it expired
+	if err := config.RenewToken(ctx, client, env); err != nil {
+		return call, nil
+	}
+	return r.ExecuteLimited(ctx, client, env, limit)
+}
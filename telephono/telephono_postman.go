@@ -0,0 +1,279 @@
+package telephono
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PostmanImport is what was converted from a Postman collection or
+// environment file.
+type PostmanImport struct {
+	// The requests of a collection with folders flattened into the
+	// template names, e.g. "My_API/users/Get_user"
+	Collection CallBuddyCollection
+
+	// Collection variables or environment values, meant for the User
+	// environment
+	Variables map[string]string
+
+	// Requests that could not be converted
+	Skipped []error
+}
+
+type (
+	// postmanFile is either a v2.1 collection or an environment, both are
+	// decoded at once and told apart by which fields are present
+	postmanFile struct {
+		Info     postmanInfo       `json:"info"`
+		Item     []postmanItem     `json:"item"`
+		Variable []postmanVariable `json:"variable"`
+
+		// Only in environment files
+		Name   string            `json:"name"`
+		Values []postmanVariable `json:"values"`
+	}
+
+	postmanInfo struct {
+		Name   string `json:"name"`
+		Schema string `json:"schema"`
+	}
+
+	// postmanItem is a folder when Item is set, otherwise a request
+	postmanItem struct {
+		Name    string          `json:"name"`
+		Item    []postmanItem   `json:"item"`
+		Request json.RawMessage `json:"request"`
+	}
+
+	postmanRequest struct {
+		Method string          `json:"method"`
+		Header []postmanHeader `json:"header"`
+		Body   *postmanBody    `json:"body"`
+		Url    json.RawMessage `json:"url"`
+	}
+
+	postmanHeader struct {
+		Key      string `json:"key"`
+		Value    string `json:"value"`
+		Disabled bool   `json:"disabled"`
+	}
+
+	postmanBody struct {
+		Mode       string          `json:"mode"`
+		Raw        string          `json:"raw"`
+		Urlencoded []postmanHeader `json:"urlencoded"`
+		Options    struct {
+			Raw struct {
+				Language string `json:"language"`
+			} `json:"raw"`
+		} `json:"options"`
+	}
+
+	postmanVariable struct {
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Enabled *bool  `json:"enabled"`
+	}
+)
+
+// postmanVariablePattern Matches {{name}} placeholders, skipping Postman's
+// dynamic {{$name}} variables which have no equivalent here
+var postmanVariablePattern = regexp.MustCompile(`{{\s*([^{}$\s][^{}]*?)\s*}}`)
+
+// postmanPlaceholderPattern Matches every placeholder, dynamic ones included
+var postmanPlaceholderPattern = regexp.MustCompile(`{{[^{}]*}}`)
+
+var invalidTemplateNameChars = regexp.MustCompile(`[^a-zA-Z0-9_./-]+`)
+
+// invalidVariableNameChars Are the characters of Postman variable names that
+// can't be in the name of an expanded variable, e.g. the dot of {{api.key}}
+// would look the key up in an api object
+var invalidVariableNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// postmanVariableName Returns the name the Postman variable is imported as,
+// e.g. base_url for "base url"
+func postmanVariableName(name string) string {
+	return invalidVariableNameChars.ReplaceAllString(strings.TrimSpace(name), "_")
+}
+
+// ImportPostman Converts a Postman v2.1 collection or a Postman environment
+// file. Postman {{var}} placeholders are rewritten as {{User.var}} so
+// they're expanded from the User environment. Characters variable names
+// can't have, like spaces, dots and dashes, are replaced by _ both in the
+// placeholders and in the imported variables.
+func ImportPostman(r io.Reader) (imported PostmanImport, err error) {
+	var file postmanFile
+	if err = json.NewDecoder(r).Decode(&file); err != nil {
+		return
+	}
+	imported.Variables = map[string]string{}
+
+	if file.Values != nil && file.Item == nil {
+		// An environment file
+		for _, value := range file.Values {
+			if value.Enabled != nil && !*value.Enabled {
+				continue
+			}
+			imported.Variables[postmanVariableName(value.Key)] = value.Value
+		}
+		return
+	}
+
+	if file.Item == nil {
+		err = errors.New("Not a Postman collection or environment")
+		return
+	}
+	if file.Info.Schema != "" && !strings.Contains(file.Info.Schema, "v2.1") {
+		err = errors.New("Only Postman v2.1 collections are supported, got " + file.Info.Schema)
+		return
+	}
+
+	for _, variable := range file.Variable {
+		imported.Variables[postmanVariableName(variable.Key)] = variable.Value
+	}
+	imported.Collection.Name = file.Info.Name
+	imported.importItems(file.Item, []string{file.Info.Name})
+	return
+}
+
+func (imported *PostmanImport) importItems(items []postmanItem, path []string) {
+	for _, item := range items {
+		itemPath := append(append([]string(nil), path...), item.Name)
+		if item.Item != nil {
+			imported.importItems(item.Item, itemPath)
+			continue
+		}
+
+		template, err := convertPostmanRequest(item.Request)
+		if err != nil {
+			imported.Skipped = append(imported.Skipped, fmt.Errorf("%s: %s", strings.Join(itemPath, "/"), err))
+			continue
+		}
+		template.Name = imported.uniqueTemplateName(itemPath)
+		saved := template.Clone()
+		imported.Collection.RequestTemplates = append(imported.Collection.RequestTemplates, &saved)
+	}
+}
+
+// uniqueTemplateName Makes a valid template name out of the folder path that
+// isn't already taken by another imported request
+func (imported *PostmanImport) uniqueTemplateName(path []string) string {
+	var parts []string
+	for _, part := range path {
+		part = strings.Trim(invalidTemplateNameChars.ReplaceAllString(part, "_"), "_")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	name := strings.Join(parts, "/")
+	if name == "" {
+		name = "request"
+	}
+
+	unique := name
+	for i := 2; ; i++ {
+		if _, err := imported.Collection.Get(unique); err != nil {
+			return unique
+		}
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+}
+
+func convertPostmanRequest(raw json.RawMessage) (template RequestTemplate, err error) {
+	var request postmanRequest
+	// A request can also just be the URL
+	var rawUrl string
+	if json.Unmarshal(raw, &rawUrl) == nil {
+		request.Method = "GET"
+		request.Url, _ = json.Marshal(rawUrl)
+	} else if err = json.Unmarshal(raw, &request); err != nil {
+		return
+	}
+	if request.Method == "" {
+		request.Method = "GET"
+	}
+
+	if template.Method, err = toHttpMethod(request.Method); err != nil {
+		return
+	}
+	if template.Url, err = convertPostmanUrl(request.Url); err != nil {
+		return
+	}
+
+	template.Headers = http.Header{}
+	for _, header := range request.Header {
+		if header.Disabled {
+			continue
+		}
+		template.Headers.Add(header.Key, convertPostmanVariables(header.Value))
+	}
+
+	if request.Body != nil {
+		switch request.Body.Mode {
+		case "raw":
+			template.Body = convertPostmanVariables(request.Body.Raw)
+			if request.Body.Options.Raw.Language == "json" && template.Headers.Get("Content-Type") == "" {
+				template.Headers.Set("Content-Type", "application/json")
+			}
+		case "urlencoded":
+			var pairs []string
+			for _, pair := range request.Body.Urlencoded {
+				if pair.Disabled {
+					continue
+				}
+				pairs = append(pairs, escapePostmanForm(pair.Key)+"="+escapePostmanForm(pair.Value))
+			}
+			template.Body = strings.Join(pairs, "&")
+			if template.Headers.Get("Content-Type") == "" {
+				template.Headers.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+		case "":
+		default:
+			err = errors.New("Unsupported body mode " + request.Body.Mode)
+			return
+		}
+	}
+	return
+}
+
+func convertPostmanUrl(raw json.RawMessage) (string, error) {
+	var rawUrl string
+	if err := json.Unmarshal(raw, &rawUrl); err != nil {
+		var structured struct {
+			Raw string `json:"raw"`
+		}
+		if err := json.Unmarshal(raw, &structured); err != nil {
+			return "", err
+		}
+		rawUrl = structured.Raw
+	}
+	return convertPostmanVariables(rawUrl), nil
+}
+
+// escapePostmanForm Escapes the form key or value with its placeholders
+// converted rather than escaped, which would mangle them
+func escapePostmanForm(text string) string {
+	var escaped strings.Builder
+	last := 0
+	for _, match := range postmanPlaceholderPattern.FindAllStringIndex(text, -1) {
+		escaped.WriteString(url.QueryEscape(text[last:match[0]]))
+		escaped.WriteString(convertPostmanVariables(text[match[0]:match[1]]))
+		last = match[1]
+	}
+	escaped.WriteString(url.QueryEscape(text[last:]))
+	return escaped.String()
+}
+
+// convertPostmanVariables Rewrites Postman's {{name}} as {{User.name}}
+func convertPostmanVariables(content string) string {
+	return postmanVariablePattern.ReplaceAllStringFunc(content, func(placeholder string) string {
+		name := postmanVariablePattern.FindStringSubmatch(placeholder)[1]
+		return "{{User." + postmanVariableName(name) + "}}"
+	})
+}
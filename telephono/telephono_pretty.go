@@ -0,0 +1,409 @@
+package telephono
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BodyFormat is the format of a body, as far as formatting it for reading
+// goes
+type BodyFormat string
+
+const (
+	PlainBody BodyFormat = "plain"
+	JsonBody  BodyFormat = "json"
+	XmlBody   BodyFormat = "xml"
+	HtmlBody  BodyFormat = "html"
+	YamlBody  BodyFormat = "yaml"
+)
+
+// The ANSI escape codes used to color formatted bodies, only the eight basic
+// colors are used so any terminal can show them
+const (
+	ansiReset    = "\x1b[0m"
+	keyColor     = "\x1b[34m"
+	stringColor  = "\x1b[32m"
+	numberColor  = "\x1b[36m"
+	otherColor   = "\x1b[35m"
+	commentColor = "\x1b[33m"
+)
+
+// DetectBodyFormat Returns the format of the body from its Content-Type, or
+// from what the body looks like when the Content-Type doesn't say.
+func DetectBodyFormat(contentType string, body []byte) BodyFormat {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	switch {
+	case mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json"):
+		return JsonBody
+	case mediaType == "text/html":
+		return HtmlBody
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return XmlBody
+	case strings.HasSuffix(mediaType, "yaml"):
+		// application/yaml, text/yaml, application/x-yaml and so on
+		return YamlBody
+	case mediaType != "" && mediaType != "text/plain" && mediaType != "application/octet-stream":
+		return PlainBody
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	lowered := strings.ToLower(string(trimmed[:minInt(len(trimmed), 64)]))
+	switch {
+	case len(trimmed) == 0:
+		return PlainBody
+	case (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed):
+		return JsonBody
+	case strings.HasPrefix(lowered, "<!doctype html") || strings.HasPrefix(lowered, "<html"):
+		return HtmlBody
+	case strings.HasPrefix(lowered, "<?xml"):
+		return XmlBody
+	}
+	return PlainBody
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// BodyFormat Returns the format of the response's body.
+func (response *Response) BodyFormat() BodyFormat {
+	return DetectBodyFormat(response.Header.Get("Content-Type"), response.Body)
+}
+
+// FormatBody Returns the body indented for reading and colored using ANSI
+// escape codes if colored is set. YAML is only colored, since its indentation
+// already means something. The body is returned as is when it isn't in the
+// given format, with an error saying why.
+func FormatBody(format BodyFormat, body []byte, colored bool) (string, error) {
+	printer := bodyPrinter{colored: colored}
+	var err error
+	switch format {
+	case JsonBody:
+		err = printer.json(body)
+	case XmlBody:
+		err = printer.markup(body, false)
+	case HtmlBody:
+		err = printer.markup(body, true)
+	case YamlBody:
+		printer.yaml(body)
+	default:
+		return string(body), nil
+	}
+	if err != nil {
+		return string(body), err
+	}
+	return printer.out.String(), nil
+}
+
+// bodyPrinter Writes formatted bodies
+type bodyPrinter struct {
+	out     strings.Builder
+	colored bool
+}
+
+func (printer *bodyPrinter) write(color, text string) {
+	if printer.colored && color != "" && text != "" {
+		printer.out.WriteString(color + text + ansiReset)
+		return
+	}
+	printer.out.WriteString(text)
+}
+
+func (printer *bodyPrinter) indent(depth int) {
+	printer.out.WriteString(strings.Repeat("  ", depth))
+}
+
+func (printer *bodyPrinter) json(body []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := printer.jsonValue(decoder, 0); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("Trailing data after the JSON document")
+	}
+	printer.out.WriteString("\n")
+	return nil
+}
+
+// jsonValue Writes the next value, keeping the order of object keys and
+// numbers as they were written
+func (printer *bodyPrinter) jsonValue(decoder *json.Decoder, depth int) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch typed := token.(type) {
+	case json.Delim:
+		closing := "]"
+		if typed == '{' {
+			closing = "}"
+		}
+		printer.write("", typed.String())
+		if decoder.More() {
+			printer.write("", "\n")
+			for first := true; decoder.More(); first = false {
+				if !first {
+					printer.write("", ",\n")
+				}
+				printer.indent(depth + 1)
+				if typed == '{' {
+					key, err := decoder.Token()
+					if err != nil {
+						return err
+					}
+					printer.write(keyColor, jsonQuote(key.(string)))
+					printer.write("", ": ")
+				}
+				if err := printer.jsonValue(decoder, depth+1); err != nil {
+					return err
+				}
+			}
+			printer.write("", "\n")
+			printer.indent(depth)
+		}
+		// The closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		printer.write("", closing)
+	case string:
+		printer.write(stringColor, jsonQuote(typed))
+	case json.Number:
+		printer.write(numberColor, typed.String())
+	case bool:
+		printer.write(otherColor, strconv.FormatBool(typed))
+	case nil:
+		printer.write(otherColor, "null")
+	}
+	return nil
+}
+
+// jsonQuote Quotes the string as JSON without escaping <, > and & like
+// json.Marshal does
+func jsonQuote(str string) string {
+	return strings.TrimSuffix(string(jsonQuoteValue(str)), "\n")
+}
+
+// jsonQuoteValue Encodes the value as JSON without escaping <, > and &
+func jsonQuoteValue(value interface{}) []byte {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return encoded.Bytes()
+}
+
+// htmlVoidElements The HTML elements that have no end tag
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// markup Writes XML, or HTML when html is set, with one element per line.
+// Elements that only contain a line of text are kept on one line.
+func (printer *bodyPrinter) markup(body []byte, html bool) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	next := decoder.RawToken
+	if html {
+		decoder.Strict = false
+		decoder.AutoClose = xml.HTMLAutoClose
+		decoder.Entity = xml.HTMLEntity
+		// Only Token closes the elements HTML doesn't
+		next = decoder.Token
+	}
+	var tokens []xml.Token
+	// RawToken doesn't check the elements are closed in order
+	var open []xml.Name
+	for {
+		token, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			open = append(open, element.Name)
+		case xml.EndElement:
+			if len(open) == 0 || open[len(open)-1] != element.Name {
+				return errors.New("Unexpected </" + markupName(element.Name) + ">")
+			}
+			open = open[:len(open)-1]
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+	if len(open) > 0 {
+		return errors.New("Unclosed <" + markupName(open[len(open)-1]) + ">")
+	}
+
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		switch token := tokens[i].(type) {
+		case xml.StartElement:
+			printer.indent(depth)
+			// Elements with nothing or a line of text in them go on one line
+			text := ""
+			end := i + 1
+			if end < len(tokens) {
+				if charData, ok := tokens[end].(xml.CharData); ok {
+					text = strings.TrimSpace(string(charData))
+					end++
+				}
+			}
+			if end < len(tokens) && !strings.Contains(text, "\n") {
+				if endElement, ok := tokens[end].(xml.EndElement); ok {
+					switch {
+					case text == "" && html && htmlVoidElements[strings.ToLower(token.Name.Local)]:
+						printer.startTag(token, ">")
+					case text == "" && !html:
+						printer.startTag(token, "/>")
+					default:
+						printer.startTag(token, ">")
+						printer.write("", escapeMarkup(text, false))
+						printer.endTag(endElement)
+					}
+					printer.out.WriteString("\n")
+					i = end
+					continue
+				}
+			}
+			printer.startTag(token, ">")
+			printer.out.WriteString("\n")
+			depth++
+		case xml.EndElement:
+			depth--
+			printer.indent(depth)
+			printer.endTag(token)
+			printer.out.WriteString("\n")
+		case xml.CharData:
+			for _, line := range strings.Split(strings.TrimSpace(string(token)), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					printer.indent(depth)
+					printer.write("", escapeMarkup(line, false))
+					printer.out.WriteString("\n")
+				}
+			}
+		case xml.Comment:
+			printer.indent(depth)
+			printer.write(commentColor, "<!--"+string(token)+"-->")
+			printer.out.WriteString("\n")
+		case xml.ProcInst:
+			printer.indent(depth)
+			printer.write(otherColor, "<?"+token.Target+" "+string(token.Inst)+"?>")
+			printer.out.WriteString("\n")
+		case xml.Directive:
+			printer.indent(depth)
+			printer.write(otherColor, "<!"+string(token)+">")
+			printer.out.WriteString("\n")
+		}
+	}
+	return nil
+}
+
+func markupName(name xml.Name) string {
+	// Namespace URLs are left out, only prefixes are kept
+	if name.Space != "" && !strings.Contains(name.Space, "/") {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+func (printer *bodyPrinter) startTag(element xml.StartElement, closing string) {
+	printer.write(keyColor, "<"+markupName(element.Name))
+	for _, attr := range element.Attr {
+		printer.write("", " ")
+		printer.write(numberColor, markupName(attr.Name))
+		printer.write("", "=")
+		printer.write(stringColor, `"`+escapeMarkup(attr.Value, true)+`"`)
+	}
+	printer.write(keyColor, closing)
+}
+
+func (printer *bodyPrinter) endTag(element xml.EndElement) {
+	printer.write(keyColor, "</"+markupName(element.Name)+">")
+}
+
+// escapeMarkup Escapes the text, or the attribute value when attr is set,
+// leaving alone the characters that don't need escaping
+func escapeMarkup(text string, attr bool) string {
+	text = strings.Replace(text, "&", "&amp;", -1)
+	text = strings.Replace(text, "<", "&lt;", -1)
+	text = strings.Replace(text, ">", "&gt;", -1)
+	if attr {
+		text = strings.Replace(text, `"`, "&quot;", -1)
+	}
+	return text
+}
+
+var (
+	yamlKey     = regexp.MustCompile(`^(\s*(?:- +)*)([^\s#'"{\[-][^:#]*?|"[^"]*"|'[^']*')(:)(\s|$)`)
+	yamlComment = regexp.MustCompile(`(^|\s)#.*$`)
+)
+
+// yaml Colors the keys and comments of YAML, leaving everything else as is
+func (printer *bodyPrinter) yaml(body []byte) {
+	lines := strings.Split(strings.TrimRight(string(body), "\n"), "\n")
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "---" || trimmed == "..." || strings.HasPrefix(trimmed, "#") {
+			color := otherColor
+			if strings.HasPrefix(trimmed, "#") {
+				color = commentColor
+			}
+			printer.write(color, line)
+			printer.out.WriteString("\n")
+			continue
+		}
+
+		// Comments after values, unless quotes make it unclear
+		comment := ""
+		if !strings.ContainsAny(line, `'"`) {
+			if location := yamlComment.FindStringIndex(line); location != nil {
+				line, comment = line[:location[0]], line[location[0]:]
+			}
+		}
+		if match := yamlKey.FindStringSubmatchIndex(line); match != nil {
+			printer.write("", line[:match[4]])
+			printer.write(keyColor, line[match[4]:match[5]])
+			printer.write("", line[match[6]:])
+		} else {
+			printer.write("", line)
+		}
+		printer.write(commentColor, comment)
+		printer.out.WriteString("\n")
+	}
+}
+
+// FormatHeaders Returns the headers sorted by name, one "Name: value" line
+// each, with the names colored if colored is set.
+func FormatHeaders(header http.Header, colored bool) string {
+	printer := bodyPrinter{colored: colored}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		printer.write(keyColor, key)
+		printer.write("", ": "+strings.Join(header[key], ", ")+"\n")
+	}
+	return printer.out.String()
+}
@@ -3,7 +3,6 @@ package telephono
 import (
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -141,16 +140,6 @@ func (profiles *CallBuddyProfiles) New(dir, name string) (newProfile Profile, er
 		State: &newState,
 	}
 
-	// FIXME DG: Collections is dead code. Sorry but not sorry it should be removed.
-	newState.Collections = append(newState.Collections, CallBuddyCollection{
-		Name: "Terminal Call-Buddy",
-		RequestTemplates: []*RequestTemplate{
-			{
-				Method:  Get,
-				Url:     "https://{vars.Host}",
-				Headers: http.Header{},
-				Body:    "Hello World"}},
-	})
 	*profiles = append(*profiles, &newProfile)
 	profiles.Use(name)
 	profiles.Save(dir)
@@ -0,0 +1,259 @@
+package telephono
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+)
+
+// The HTTP versions calls can be forced to use
+const (
+	// HTTP11 Only HTTP/1.1, even when the server supports HTTP/2
+	HTTP11 = "1.1"
+
+	// HTTP2 Only HTTP/2 over TLS, servers that don't agree to it fail
+	HTTP2 = "2"
+
+	// H2C HTTP/2 without TLS for http:// URLs, assuming the server supports
+	// it (prior knowledge), and HTTP2 for https:// ones
+	H2C = "h2c"
+
+	// HTTP3 HTTP/3 over QUIC for https:// URLs, servers that don't support it
+	// fail. http:// URLs still use HTTP/1.1.
+	HTTP3 = "3"
+)
+
+// parseProtocol Returns the HTTP version for its string form, empty for auto
+func parseProtocol(value string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(strings.ToLower(value), "http/")) {
+	case "", "auto":
+		return "", nil
+	case "1.1", "1":
+		return HTTP11, nil
+	case "2", "h2":
+		return HTTP2, nil
+	case "h2c":
+		return H2C, nil
+	case "3", "h3":
+		return HTTP3, nil
+	}
+	return "", errors.New("No such HTTP version " + value + ", use auto, 1.1, 2, h2c or 3")
+}
+
+// SetProtocol Makes calls with this template use the HTTP version instead of
+// the profile's, empty, auto or off to use the profile's again
+func (r *RequestTemplate) SetProtocol(value string) (err error) {
+	if strings.ToLower(value) == "off" {
+		value = ""
+	}
+	r.Protocol, err = parseProtocol(value)
+	return
+}
+
+// h2cTransport Makes calls to http:// URLs using HTTP/2 without TLS and
+// others using the transport it embeds
+type h2cTransport struct {
+	*http.Transport
+	h2c *http2.Transport
+}
+
+func (transport *h2cTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.URL.Scheme == "http" {
+		return transport.h2c.RoundTrip(request)
+	}
+	return transport.Transport.RoundTrip(request)
+}
+
+// h3Transport Makes calls to https:// URLs using HTTP/3 and others using the
+// transport it embeds
+type h3Transport struct {
+	*http.Transport
+	h3 *http3.RoundTripper
+
+	// The address connections to from are made to instead, see ConnectTo
+	from, to string
+}
+
+func (transport *h3Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.URL.Scheme == "https" {
+		return transport.h3.RoundTrip(request)
+	}
+	return transport.Transport.RoundTrip(request)
+}
+
+// CloseIdleConnections Closes the QUIC connections along with the idle ones of
+// the embedded transport
+func (transport *h3Transport) CloseIdleConnections() {
+	transport.Transport.CloseIdleConnections()
+	transport.h3.Close()
+}
+
+// newH3Transport Returns a transport using HTTP/3 for https:// URLs, with the
+// TLS settings of the given transport
+func newH3Transport(transport *http.Transport) *h3Transport {
+	tlsConfig := transport.TLSClientConfig.Clone()
+	// HTTP/3 sets its own
+	tlsConfig.NextProtos = nil
+	h3 := &h3Transport{Transport: transport}
+	h3.h3 = &http3.RoundTripper{
+		TLSClientConfig: tlsConfig,
+		Dial: func(ctx context.Context, addr string, tlsConfig *tls.Config, config *quic.Config) (quic.EarlyConnection, error) {
+			if addr == h3.from {
+				addr = h3.to
+			}
+			return quic.DialAddrEarly(ctx, addr, tlsConfig, config)
+		},
+	}
+	return h3
+}
+
+// httpTransport Returns the transport the client makes HTTP/1.1 and TLS
+// connections with, nil if it isn't one of ours
+func httpTransport(client *http.Client) *http.Transport {
+	switch transport := client.Transport.(type) {
+	case *http.Transport:
+		return transport
+	case *h2cTransport:
+		return transport.Transport
+	case *h3Transport:
+		return transport.Transport
+	}
+	return nil
+}
+
+// clientProtocol Returns the HTTP version the client was forced to use, empty
+// if it wasn't
+func clientProtocol(client *http.Client) string {
+	switch transport := client.Transport.(type) {
+	case *h2cTransport:
+		return H2C
+	case *h3Transport:
+		return HTTP3
+	case *http.Transport:
+		if transport.DialTLSContext != nil {
+			return HTTP2
+		}
+		if transport.TLSNextProto != nil && len(transport.TLSNextProto) == 0 {
+			return HTTP11
+		}
+	}
+	return ""
+}
+
+// dialHTTP2 Makes TLS connections like the transport would, failing when the
+// server doesn't agree to HTTP/2
+func dialHTTP2(transport *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := transport.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		config := transport.TLSClientConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if protocol := tlsConn.ConnectionState().NegotiatedProtocol; protocol != http2.NextProtoTLS {
+			conn.Close()
+			return nil, errors.New("The server at " + addr + " doesn't support HTTP/2")
+		}
+		return tlsConn, nil
+	}
+}
+
+// newH2CTransport Returns a transport using HTTP/2 without TLS for http://
+// URLs, connecting like the given transport does
+func newH2CTransport(transport *http.Transport) *h2cTransport {
+	return &h2cTransport{
+		Transport: transport,
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				// Plain TCP, without TLS
+				return transport.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// protocolTransport Returns the transport forced to use the configured HTTP
+// version, the transport is changed to do so
+func (config *ClientConfig) protocolTransport(transport *http.Transport) (http.RoundTripper, error) {
+	if config.Proxy != "" && (config.Protocol == H2C || config.Protocol == HTTP3) {
+		return nil, errors.New("HTTP version " + config.Protocol + " can't be used through a proxy")
+	}
+	return forceProtocol(transport, config.Protocol), nil
+}
+
+// forceProtocol Returns the transport forced to use the HTTP version, the
+// transport is changed to do so
+func forceProtocol(transport *http.Transport, protocol string) http.RoundTripper {
+	switch protocol {
+	case HTTP11:
+		transport.ForceAttemptHTTP2 = false
+		// A non-nil empty map turns HTTP/2 off
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	case HTTP2, H2C:
+		transport.ForceAttemptHTTP2 = true
+		transport.TLSClientConfig.NextProtos = []string{http2.NextProtoTLS}
+		// Calls through a proxy don't use this, the TLS is done by the
+		// transport after connecting through the proxy
+		transport.DialTLSContext = dialHTTP2(transport)
+	}
+	switch protocol {
+	case H2C:
+		return newH2CTransport(transport)
+	case HTTP3:
+		return newH3Transport(transport)
+	}
+	return transport
+}
+
+// protocolClient Returns a client like the given one, connecting to the
+// address instead of the URL's host when it isn't empty, using the HTTP
+// version when it isn't empty. The client has connections of its own, so they
+// aren't shared with other calls, and should be closed after the call.
+func protocolClient(client *http.Client, requestUrl *url.URL, address, protocol string) (*http.Client, error) {
+	transport := httpTransport(client)
+	if transport == nil {
+		return nil, errors.New("The client can't be changed for this call")
+	}
+	changed := transport.Clone()
+	if changed.TLSClientConfig == nil {
+		changed.TLSClientConfig = &tls.Config{}
+	}
+	if protocol == "" {
+		protocol = clientProtocol(client)
+	}
+	// Undo what forceProtocol did, the clone uses HTTP/2 when it can again
+	changed.ForceAttemptHTTP2 = true
+	changed.TLSNextProto = nil
+	changed.TLSClientConfig.NextProtos = nil
+	changed.DialTLSContext = nil
+	if address != "" {
+		changed.DialContext = connectDial(transport.DialContext, hostPort(requestUrl), address)
+	}
+	// Clones don't keep the registered protocols
+	changed.RegisterProtocol("unix", newUnixTransport(changed))
+
+	roundTripper := forceProtocol(changed, protocol)
+	if h3, ok := roundTripper.(*h3Transport); ok && address != "" {
+		h3.from, h3.to = hostPort(requestUrl), address
+	}
+	connected := *client
+	connected.Transport = roundTripper
+	return &connected, nil
+}
@@ -0,0 +1,186 @@
+package telephono
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Redacted Replaces the values redaction hides
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedHeaders The headers redacted unless the rules are changed
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Redaction is what is hidden when calls are saved with the history, shown in
+// it or exported from it. The values of secret variables are always replaced
+// by the variables, see MaskSecrets.
+type Redaction struct {
+	// The request and response headers whose values are hidden
+	Headers []string `json:",omitempty"`
+
+	// Regular expressions hidden in URLs, header values and bodies. When one
+	// has a group, only what the group matched is hidden.
+	Patterns []string `json:",omitempty"`
+}
+
+// DefaultRedaction Returns the rules used unless they are changed
+func DefaultRedaction() Redaction {
+	return Redaction{Headers: append([]string(nil), DefaultRedactedHeaders...)}
+}
+
+// AddHeader Hides the values of the header
+func (redaction *Redaction) AddHeader(name string) {
+	name = http.CanonicalHeaderKey(name)
+	for _, header := range redaction.Headers {
+		if header == name {
+			return
+		}
+	}
+	redaction.Headers = append(redaction.Headers, name)
+}
+
+// AddPattern Hides what the regular expression matches
+func (redaction *Redaction) AddPattern(pattern string) error {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return err
+	}
+	for _, existing := range redaction.Patterns {
+		if existing == pattern {
+			return nil
+		}
+	}
+	redaction.Patterns = append(redaction.Patterns, pattern)
+	return nil
+}
+
+// Remove Removes the header or pattern, returning whether there was one
+func (redaction *Redaction) Remove(rule string) (removed bool) {
+	headers := redaction.Headers[:0]
+	for _, header := range redaction.Headers {
+		if strings.EqualFold(header, rule) {
+			removed = true
+		} else {
+			headers = append(headers, header)
+		}
+	}
+	redaction.Headers = headers
+	patterns := redaction.Patterns[:0]
+	for _, pattern := range redaction.Patterns {
+		if pattern == rule {
+			removed = true
+		} else {
+			patterns = append(patterns, pattern)
+		}
+	}
+	redaction.Patterns = patterns
+	return
+}
+
+// String Returns a line per rule
+func (redaction Redaction) String() string {
+	var lines []string
+	for _, header := range redaction.Headers {
+		lines = append(lines, "header "+header)
+	}
+	for _, pattern := range redaction.Patterns {
+		lines = append(lines, "pattern "+pattern)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redactText Returns the text with what the patterns match hidden
+func redactText(text string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		var redacted strings.Builder
+		last := 0
+		for _, match := range pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := match[0], match[1]
+			if len(match) >= 4 && match[2] >= 0 {
+				start, end = match[2], match[3]
+			}
+			redacted.WriteString(text[last:start])
+			redacted.WriteString(Redacted)
+			last = end
+		}
+		redacted.WriteString(text[last:])
+		text = redacted.String()
+	}
+	return text
+}
+
+// redactHeader Returns a copy of the header with the values of the rules'
+// headers and what the patterns match hidden
+func (redaction *Redaction) redactHeader(header http.Header, patterns []*regexp.Regexp) http.Header {
+	if header == nil {
+		return nil
+	}
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		hidden := false
+		for _, name := range redaction.Headers {
+			hidden = hidden || strings.EqualFold(name, key)
+		}
+		for _, value := range values {
+			if hidden {
+				value = Redacted
+			} else {
+				value = redactText(value, patterns)
+			}
+			redacted[key] = append(redacted[key], value)
+		}
+	}
+	return redacted
+}
+
+// Call Returns a copy of the call with what the rules hide redacted, sharing
+// nothing that was redacted with the call
+func (redaction *Redaction) Call(call HistoricalCall) HistoricalCall {
+	var patterns []*regexp.Regexp
+	for _, pattern := range redaction.Patterns {
+		// Patterns are checked when they are added
+		if compiled, err := regexp.Compile(pattern); err == nil {
+			patterns = append(patterns, compiled)
+		}
+	}
+
+	call.Request.URL = redactText(call.Request.URL, patterns)
+	call.Request.Header = redaction.redactHeader(call.Request.Header, patterns)
+	call.Response.Header = redaction.redactHeader(call.Response.Header, patterns)
+	if len(patterns) > 0 {
+		if len(call.Request.Body) > 0 {
+			call.Request.Body = []byte(redactText(string(call.Request.Body), patterns))
+		}
+		if len(call.Response.Body) > 0 && !call.Response.IsBinary() {
+			call.Response.Body = []byte(redactText(string(call.Response.Body), patterns))
+		}
+	}
+
+	// The cookie jar's cookies are sent in the Cookie header
+	cookieHidden := false
+	for _, name := range redaction.Headers {
+		cookieHidden = cookieHidden || strings.EqualFold(name, "Cookie")
+	}
+	cookies := make([]string, 0, len(call.Request.Cookies))
+	for _, cookie := range call.Request.Cookies {
+		if cookieHidden {
+			cookie = strings.SplitN(cookie, "=", 2)[0] + "=" + Redacted
+		} else {
+			cookie = redactText(cookie, patterns)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if call.Request.Cookies != nil {
+		call.Request.Cookies = cookies
+	}
+	return call
+}
+
+// History Returns a copy of the history with every call redacted
+func (redaction *Redaction) History(history CallBuddyHistory) CallBuddyHistory {
+	redacted := CallBuddyHistory{}
+	for _, call := range history.CallsFromCurrentSession {
+		redacted.CallsFromCurrentSession = append(redacted.CallsFromCurrentSession, redaction.Call(call))
+	}
+	return redacted
+}
@@ -0,0 +1,173 @@
+package telephono
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RunResult is the outcome of calling one template during a run
+type RunResult struct {
+	Template *RequestTemplate
+	Call     HistoricalCall
+
+	// The results of the template's assertions and captures, empty if the
+	// call failed
+	Assertions []AssertionResult
+	Captures   []CaptureResult
+
+	// Why the call couldn't be made, nil if it was
+	Err error
+}
+
+// Passed Returns whether the call was made, every assertion passed and every
+// capture captured something.
+func (result *RunResult) Passed() bool {
+	return len(result.Failures()) == 0
+}
+
+// Failures Returns why the result didn't pass, one line per reason.
+func (result *RunResult) Failures() (failures []string) {
+	if result.Err != nil {
+		return []string{result.Err.Error()}
+	}
+	for _, assertion := range result.Assertions {
+		if assertion.Err != nil {
+			failures = append(failures, assertion.Assertion.String()+": "+assertion.Err.Error())
+		}
+	}
+	for _, capture := range result.Captures {
+		if capture.Err != nil {
+			failures = append(failures, capture.Capture.String()+": "+capture.Err.Error())
+		}
+	}
+	return
+}
+
+// Select Returns the templates that belong to the given name in the order
+// they were saved. A template belongs to a name when it has that name or is
+// in a folder with that name, e.g. "api/users/get" belongs to "api" and
+// "api/users". Every named template belongs to the empty name.
+func (collection *CallBuddyCollection) Select(name string) (selected []*RequestTemplate) {
+	name = strings.TrimSuffix(name, "/")
+	for _, template := range collection.RequestTemplates {
+		if template.Name == "" {
+			continue
+		}
+		if name == "" || template.Name == name || strings.HasPrefix(template.Name, name+"/") {
+			selected = append(selected, template)
+		}
+	}
+	return
+}
+
+// Run Calls the templates one after another and checks their assertions.
+// What each template captures is stored in env, so later templates can use
+// it. Every template is called even if an earlier one failed, unless the
+// context is cancelled. Response bodies larger than the limit are saved to
+// files. Templates authenticating with OAuth2 get their tokens with the given
+// configuration, which may be nil if none do.
+func Run(ctx context.Context, client *http.Client, env *CallBuddyEnvironment, templates []*RequestTemplate, oauth2 *OAuth2Config, limit BodyLimit) (results []RunResult) {
+	for _, template := range templates {
+		result := RunResult{Template: template}
+		if err := ctx.Err(); err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		result.Call, result.Err = template.ExecuteOAuth2(ctx, client, env, oauth2, limit)
+		if result.Err == nil {
+			result.Assertions, _ = template.Check(result.Call)
+			result.Captures = template.Capture(result.Call, env)
+		}
+		results = append(results, result)
+	}
+	return
+}
+
+// WriteTAP Writes the results in the Test Anything Protocol, see
+// https://testanything.org/tap-version-13-specification.html
+func WriteTAP(w io.Writer, results []RunResult) error {
+	var out strings.Builder
+	out.WriteString("TAP version 13\n")
+	fmt.Fprintf(&out, "1..%d\n", len(results))
+	for i, result := range results {
+		status := "ok"
+		if !result.Passed() {
+			status = "not ok"
+		}
+		fmt.Fprintf(&out, "%s %d - %s\n", status, i+1, result.Template.Name)
+		for _, failure := range result.Failures() {
+			fmt.Fprintf(&out, "# %s\n", strings.Replace(failure, "\n", "\n# ", -1))
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Details string `xml:",chardata"`
+}
+
+// WriteJUnit Writes the results as a JUnit XML test suite with the given name,
+// which most CI systems can show. Calls that couldn't be made are errors and
+// failed assertions are failures.
+func WriteJUnit(w io.Writer, name string, results []RunResult) error {
+	suite := junitTestSuite{Name: name, Tests: len(results)}
+	var total time.Duration
+	for _, result := range results {
+		testCase := junitTestCase{
+			Name:      result.Template.Name,
+			ClassName: name,
+			Time:      junitSeconds(result.Call.Timing.Total),
+		}
+		total += result.Call.Timing.Total
+
+		if failures := result.Failures(); len(failures) > 0 {
+			problem := &junitProblem{Message: failures[0], Details: strings.Join(failures, "\n")}
+			if result.Err != nil {
+				testCase.Error = problem
+				suite.Errors++
+			} else {
+				testCase.Failure = problem
+				suite.Failures++
+			}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Time = junitSeconds(total)
+
+	encoded, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(encoded)+"\n")
+	return err
+}
+
+func junitSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
@@ -0,0 +1,252 @@
+package telephono
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+)
+
+// The OS environment variables a SecretKey is read from by
+// SecretKeyFromEnviron
+const (
+	PassphraseVariable = "CALL_BUDDY_PASSPHRASE"
+	AgeKeyVariable     = "CALL_BUDDY_AGE_KEY"
+)
+
+// SecretKey encrypts and decrypts the secret variables of an environment. It's
+// only ever kept in memory, along with the values it decrypted.
+type SecretKey struct {
+	recipient age.Recipient
+	identity  age.Identity
+
+	// Decrypting with a passphrase is slow on purpose, so values are only
+	// decrypted once
+	mutex     sync.Mutex
+	decrypted map[string]string
+}
+
+// PassphraseKey Returns the key that encrypts secrets with the passphrase
+func PassphraseKey(passphrase string) (*SecretKey, error) {
+	if passphrase == "" {
+		return nil, errors.New("The passphrase is empty")
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretKey{recipient: recipient, identity: identity, decrypted: map[string]string{}}, nil
+}
+
+// AgeKey Returns the key that encrypts secrets for the first X25519 identity
+// in the age key file, like one made by age-keygen
+func AgeKey(keyFile string) (*SecretKey, error) {
+	content, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			return &SecretKey{recipient: x25519.Recipient(), identity: x25519, decrypted: map[string]string{}}, nil
+		}
+	}
+	return nil, errors.New("No X25519 identity in " + keyFile)
+}
+
+// SecretKeyFromEnviron Returns the key given by the CALL_BUDDY_AGE_KEY or
+// CALL_BUDDY_PASSPHRASE variables of the OS environment, nil if neither is
+// set
+func SecretKeyFromEnviron() (*SecretKey, error) {
+	if keyFile := os.Getenv(AgeKeyVariable); keyFile != "" {
+		return AgeKey(keyFile)
+	}
+	if passphrase := os.Getenv(PassphraseVariable); passphrase != "" {
+		return PassphraseKey(passphrase)
+	}
+	return nil, nil
+}
+
+// Encrypt Returns the value encrypted, as base64
+func (key *SecretKey) Encrypt(value string) (string, error) {
+	var encrypted bytes.Buffer
+	writer, err := age.Encrypt(&encrypted, key.recipient)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write([]byte(value)); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	ciphertext := base64.StdEncoding.EncodeToString(encrypted.Bytes())
+
+	key.mutex.Lock()
+	key.decrypted[ciphertext] = value
+	key.mutex.Unlock()
+	return ciphertext, nil
+}
+
+// Decrypt Returns the value Encrypt encrypted
+func (key *SecretKey) Decrypt(ciphertext string) (string, error) {
+	key.mutex.Lock()
+	defer key.mutex.Unlock()
+	if value, ok := key.decrypted[ciphertext]; ok {
+		return value, nil
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	reader, err := age.Decrypt(bytes.NewReader(encrypted), key.identity)
+	if err != nil {
+		return "", err
+	}
+	value, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	key.decrypted[ciphertext] = string(value)
+	return string(value), nil
+}
+
+// Unlock Makes the environment decrypt its secret variables with the key when
+// expanding them, failing if the key can't decrypt them
+func (env *Environment) Unlock(key *SecretKey) error {
+	for name, ciphertext := range env.Secrets {
+		if _, err := key.Decrypt(ciphertext); err != nil {
+			return errors.New("The key can't decrypt " + env.Name + "." + name + ": " + err.Error())
+		}
+		// One is enough, secrets are all encrypted with the same key
+		break
+	}
+	env.key = key
+	return nil
+}
+
+// Lock Forgets the key, so the secret variables expand to nothing
+func (env *Environment) Lock() {
+	env.key = nil
+}
+
+// Locked Returns whether the environment has secret variables but no key to
+// decrypt them, so they expand to nothing
+func (env *Environment) Locked() bool {
+	return len(env.Secrets) > 0 && env.key == nil
+}
+
+// SetSecret Sets the key to the value, encrypted so it's only decrypted in
+// memory when it's expanded
+func (env *Environment) SetSecret(name, value string) error {
+	if env.key == nil {
+		return errors.New("No key to encrypt secrets with, unlock them with a passphrase or an age key first")
+	}
+	ciphertext, err := env.key.Encrypt(value)
+	if err != nil {
+		return err
+	}
+	if env.Secrets == nil {
+		env.Secrets = map[string]string{}
+	}
+	env.Secrets[name] = ciphertext
+	delete(env.Mapping, name)
+	return nil
+}
+
+// SecretNames Returns the names of the secret variables, sorted
+func (env *Environment) SecretNames() (names []string) {
+	for name := range env.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// values Returns the variables to expand, with the secrets decrypted if the
+// environment is unlocked
+func (env *Environment) values() map[string]string {
+	if len(env.Secrets) == 0 || env.key == nil {
+		return env.Mapping
+	}
+	values := make(map[string]string, len(env.Mapping)+len(env.Secrets))
+	for name, value := range env.Mapping {
+		values[name] = value
+	}
+	for name, ciphertext := range env.Secrets {
+		if value, err := env.key.Decrypt(ciphertext); err == nil {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// MaskSecrets Returns the text with the values of the secret variables
+// replaced by the variables, e.g. {{User.API_KEY}}, so they aren't kept
+func (env *Environment) MaskSecrets(text string) string {
+	if len(env.Secrets) == 0 || env.key == nil {
+		return text
+	}
+	var secrets []string
+	variables := map[string]string{}
+	for name, ciphertext := range env.Secrets {
+		if value, err := env.key.Decrypt(ciphertext); err == nil && value != "" {
+			secrets = append(secrets, value)
+			variables[value] = "{{" + env.Name + "." + name + "}}"
+		}
+	}
+	// Secrets containing others are masked first
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	for _, secret := range secrets {
+		text = strings.Replace(text, secret, variables[secret], -1)
+	}
+	return text
+}
+
+// maskSecrets Replaces the values of the secret variables in the request by the
+// variables, so they aren't kept in the history
+func (request *Request) maskSecrets(env *CallBuddyEnvironment) {
+	if len(env.User.Secrets) == 0 {
+		return
+	}
+	request.URL = env.User.MaskSecrets(request.URL)
+	header := make(map[string][]string, len(request.Header))
+	for key, values := range request.Header {
+		for _, value := range values {
+			header[key] = append(header[key], env.User.MaskSecrets(value))
+		}
+	}
+	// Basic authentication encodes the password
+	for i, value := range header["Authorization"] {
+		if !strings.HasPrefix(value, "Basic ") {
+			continue
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(value[len("Basic "):]); err == nil {
+			if masked := env.User.MaskSecrets(string(decoded)); masked != string(decoded) {
+				header["Authorization"][i] = "Basic " + masked
+			}
+		}
+	}
+	request.Header = header
+	if len(request.Body) > 0 {
+		request.Body = []byte(env.User.MaskSecrets(string(request.Body)))
+	}
+	for i, cookie := range request.Cookies {
+		request.Cookies[i] = env.User.MaskSecrets(cookie)
+	}
+}
@@ -1,7 +1,6 @@
 package telephono
 
 import (
-	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -23,9 +22,29 @@ type CallBuddyState struct {
 
 	// The history of calls made (just during this session?)
 	History CallBuddyHistory
+
+	// The request template currently loaded into the views
+	Current RequestTemplate
+
+	// How calls are made
+	ClientConfig ClientConfig
+
+	// How templates authenticating with OAuth2 get their access tokens
+	OAuth2 *OAuth2Config `json:",omitempty"`
+
+	// The cookies servers set, sent with later calls
+	Cookies *CookieJar `json:",omitempty"`
+
+	// What is hidden in the history, DefaultRedaction when nil
+	Redaction *Redaction `json:",omitempty"`
+
+	// The client made from ClientConfig, remade when the config changes
+	client       *http.Client
+	clientConfig ClientConfig
 }
 
-// Save Saves the given call buddy state as JSON to the specififed file.
+// Save Saves the given call buddy state as JSON to the specififed file, with
+// the history redacted.
 func (state *CallBuddyState) Save(filepath string) error {
 	stateFile, err := os.OpenFile(filepath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
@@ -36,8 +55,11 @@ func (state *CallBuddyState) Save(filepath string) error {
 
 	log.Printf("Encoding state...")
 	enc := json.NewEncoder(stateFile)
-	if err := enc.Encode(&state); err != nil {
-		log.Println("Failed to encode state: %s\n", err)
+	saved := *state
+	saved.History = state.RedactionRules().History(state.History)
+	saved.Environment.User = withoutPlainOAuth2Tokens(&state.Environment.User)
+	if err := enc.Encode(&saved); err != nil {
+		log.Printf("Failed to encode state: %s\n", err)
 		return err
 	}
 	return nil
@@ -57,28 +79,79 @@ func (state *CallBuddyState) Load(filepath string) error {
 		log.Printf("Failed to decode state: %s\n", err)
 		return err
 	}
+
+	// States saved before templates were named have no current template
+	if state.Current.Method == "" {
+		state.Current = newCurrentTemplate()
+	}
 	return nil
 }
 
 //InitNewState creates a correctly initialized CallBuddyState with some defaults
 func InitNewState() CallBuddyState {
 	state := CallBuddyState{
-		Collections: []CallBuddyCollection{},
+		Collections: []CallBuddyCollection{{Name: "Terminal Call-Buddy"}},
 		Environment: CallBuddyEnvironment{
-			OS:   Environment{"Var", map[string]string{}},
-			User: Environment{"User", map[string]string{}},
-			Home: Environment{"Home", map[string]string{}},
+			OS:   Environment{Name: "Var", Mapping: map[string]string{}},
+			User: Environment{Name: "User", Mapping: map[string]string{}},
+			Home: Environment{Name: "Home", Mapping: map[string]string{}},
 		},
 		History: CallBuddyHistory{},
+		Current: newCurrentTemplate(),
 	}
 	state.Environment.OS.PopulateFromEnviron()
 	return state
 }
 
-type CallBuddyCollection struct {
-	Name string
-	// TODO AH: Should this really be pointer?
-	RequestTemplates []*RequestTemplate
+func newCurrentTemplate() RequestTemplate {
+	return RequestTemplate{
+		Method:  Get,
+		Url:     "http://",
+		Headers: http.Header{},
+	}
+}
+
+// HttpClient Returns the HTTP client to make calls with, made from the
+// state's client configuration.
+func (state *CallBuddyState) HttpClient() (*http.Client, error) {
+	if state.client != nil && state.clientConfig == state.ClientConfig {
+		return state.client, nil
+	}
+	client, err := state.ClientConfig.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	client.Jar = state.CookieJar()
+	state.client, state.clientConfig = client, state.ClientConfig
+	return client, nil
+}
+
+// RedactionRules Returns what is hidden in the history, creating the default
+// rules if the state doesn't have any yet.
+func (state *CallBuddyState) RedactionRules() *Redaction {
+	if state.Redaction == nil {
+		redaction := DefaultRedaction()
+		state.Redaction = &redaction
+	}
+	return state.Redaction
+}
+
+// CookieJar Returns the jar that keeps the cookies of the state's calls,
+// creating it if the state doesn't have one yet.
+func (state *CallBuddyState) CookieJar() *CookieJar {
+	if state.Cookies == nil {
+		state.Cookies = &CookieJar{}
+	}
+	return state.Cookies
+}
+
+// Templates Returns the collection that named request templates are saved to
+// and loaded from, creating it if the state doesn't have one yet.
+func (state *CallBuddyState) Templates() *CallBuddyCollection {
+	if len(state.Collections) == 0 {
+		state.Collections = append(state.Collections, CallBuddyCollection{Name: "Terminal Call-Buddy"})
+	}
+	return &state.Collections[0]
 }
 
 type CallBuddyEnvironment struct {
@@ -102,32 +175,17 @@ func (env *CallBuddyEnvironment) MarshalJSON() ([]byte, error) {
 	return json.Marshal(env.User)
 }
 
+// Clone Returns a copy of the environments that shares no variables with them,
+// e.g. to expand templates in while the original keeps changing
+func (env *CallBuddyEnvironment) Clone() CallBuddyEnvironment {
+	return CallBuddyEnvironment{
+		OS:   env.OS.Clone(),
+		User: env.User.Clone(),
+		Home: env.Home.Clone(),
+	}
+}
+
 // Expands the string in all the environments
 func (env *CallBuddyEnvironment) Expand(content string) string {
 	return env.OS.Expand(env.User.Expand(content))
 }
-
-type CallBuddyInternalState struct {
-	client      *http.Client
-	callContext context.Context
-
-	freeFunc context.CancelFunc
-}
-
-var globalState CallBuddyInternalState
-
-func init() {
-	// TODO AH: Make this timeout longer and configurable. Maybe have a check for number of received bytes on each call
-	//timeoutContext, cancelFunc := context.@WithTimeout(context.Background(), time.Minute*3)
-	// goddamn I love garbage collection
-	globalState.callContext = context.Background()
-	globalState.freeFunc = func() {}
-
-	// create the client
-	globalState.client = &http.Client{
-		Transport:     http.DefaultTransport,
-		CheckRedirect: nil,
-		Jar:           nil,
-		Timeout:       0,
-	}
-}
@@ -2,7 +2,6 @@ package telephono
 
 import (
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
 )
@@ -15,6 +14,10 @@ type (
 		URL    string
 		Header http.Header
 		Body   []byte
+
+		// The cookies the cookie jar sent along with the headers, as
+		// NAME=VALUE
+		Cookies []string `json:",omitempty"`
 	}
 
 	// Override Go's http.Response with permanent body and only
@@ -24,6 +27,14 @@ type (
 		StatusCode int
 		Header     http.Header
 		Body       []byte
+
+		// The HTTP version the server answered with, e.g. HTTP/2.0
+		Proto string `json:",omitempty"`
+
+		// The file the whole body was saved to when it was too large to
+		// keep in memory, then Body only holds the start of it
+		BodyFile     string `json:",omitempty"`
+		BodyFileSize int64  `json:",omitempty"`
 	}
 )
 
@@ -34,25 +45,34 @@ func (request *Request) Populate(httpRequest *http.Request, body string) error {
 	}
 	request.Method = method
 	request.URL = httpRequest.URL.String()
-	request.Header = httpRequest.Header
+	// The client adds the cookie jar's cookies to the request's headers
+	request.Header = httpRequest.Header.Clone()
 
 	request.Body = []byte(body)
 	return nil
 }
 
 func (response *Response) Populate(httpResponse *http.Response) error {
+	return response.PopulateLimited(httpResponse, BodyLimit{})
+}
+
+// PopulateLimited Is Populate where bodies larger than the limit are written
+// to a file instead of being kept in memory
+func (response *Response) PopulateLimited(httpResponse *http.Response, limit BodyLimit) error {
 	response.Status = httpResponse.Status
 	response.StatusCode = httpResponse.StatusCode
+	response.Proto = httpResponse.Proto
 	response.Header = httpResponse.Header
+	return response.populateBody(httpResponse, limit)
+}
 
-	response.Body = []byte("")
-	bodyBuffer, err := ioutil.ReadAll(httpResponse.Body)
-	if err != nil {
-		return err
+// Size Returns the size of the whole body, even when only the start of it is
+// in memory
+func (response *Response) Size() int64 {
+	if response.IsTruncated() {
+		return response.BodyFileSize
 	}
-	httpResponse.Body.Close()
-	response.Body = bodyBuffer
-	return nil
+	return int64(len(response.Body))
 }
 
 func (response *Response) String() (result string) {
@@ -62,6 +82,6 @@ func (response *Response) String() (result string) {
 		}
 		result += "\n"
 	}
-	result += string(response.Body)
+	result += response.TruncatedDescription() + response.BodyText()
 	return
 }
@@ -13,6 +13,7 @@ type (
 	HistoricalCall struct {
 		Response Response
 		Request  Request
+		Timing   CallTiming
 	}
 
 	CallBuddyHistory struct {
@@ -26,8 +27,8 @@ func (wholeHistory *CallBuddyHistory) AddFinishedCall(call HistoricalCall) {
 
 // GetSimpleReport generates simple string report that gives info about the request/response
 func (theCall HistoricalCall) GetSimpleReport() string {
-	// {method} {request URL}: {response code} [content length]
-	return fmt.Sprintf("%8s %-50s: [%3d] [%5d] bytes", theCall.Request.Method, theCall.Request.URL, theCall.Response.StatusCode, len(theCall.Response.Body))
+	// {method} {request URL}: {response code} [protocol] [content length] [total time]
+	return fmt.Sprintf("%8s %-50s: [%3d] [%-8s] [%5d] bytes [%8s]", theCall.Request.Method, theCall.Request.URL, theCall.Response.StatusCode, theCall.Response.Proto, theCall.Response.Size(), formatDuration(theCall.Timing.Total))
 }
 
 // TODO AH: May not be this method's concern, but this is hacky and will get big quickly
@@ -0,0 +1,191 @@
+package telephono
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StreamBodyLimit How much of a stream is kept as the body of its call
+const StreamBodyLimit = 1 << 20
+
+// maxStreamLine The longest line of a stream that is read
+const maxStreamLine = 1 << 20
+
+// StreamEvent is a Server-Sent Event, or a line of any other stream such as
+// NDJSON or a Kubernetes watch
+type StreamEvent struct {
+	// When the event was received
+	Received time.Time
+
+	// The event's type and id, empty when the server didn't give them and
+	// for lines of streams that aren't Server-Sent Events
+	Event string
+	ID    string
+
+	// The event's data lines joined by newlines, or the line
+	Data string
+}
+
+// Format Returns the event with the time it was received and how long after
+// the given start that was, e.g. "[15:04:05.000 +1.50s] event=ping\n{}\n"
+func (event *StreamEvent) Format(started time.Time) string {
+	result := fmt.Sprintf("[%s +%s]", event.Received.Format("15:04:05.000"), formatDuration(event.Received.Sub(started)))
+	if event.Event != "" {
+		result += " event=" + event.Event
+	}
+	if event.ID != "" {
+		result += " id=" + event.ID
+	}
+	if event.Event != "" || event.ID != "" || strings.Contains(event.Data, "\n") {
+		return result + "\n" + event.Data + "\n"
+	}
+	return result + " " + event.Data + "\n"
+}
+
+// IsEventStream Returns whether the response is a stream of Server-Sent
+// Events
+func (response *Response) IsEventStream() bool {
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// limitedBuffer Keeps the first limit bytes written to it and drops the rest
+type limitedBuffer struct {
+	bytes []byte
+	limit int
+}
+
+func (buffer *limitedBuffer) Write(p []byte) (int, error) {
+	if room := buffer.limit - len(buffer.bytes); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		buffer.bytes = append(buffer.bytes, p[:room]...)
+	}
+	return len(p), nil
+}
+
+// Stream Makes the call and passes each event of the response to onEvent as
+// it arrives, until the server ends the response or the context is cancelled.
+// Cancelling is how streams that never end are stopped, so it isn't an error
+// once the response has started. onResponse is given the status and headers
+// before any event. The call returned holds the first StreamBodyLimit bytes
+// of the stream as its body.
+func (r *RequestTemplate) Stream(ctx context.Context, client *http.Client, env *CallBuddyEnvironment, onResponse func(Response), onEvent func(StreamEvent)) (HistoricalCall, error) {
+	httpRequest, expandedBody, newCallErr := r.newHttpRequest(env)
+	if newCallErr != nil {
+		return HistoricalCall{}, newCallErr
+	}
+	tracedCtx, timer := newCallTimer(ctx)
+	httpRequest = httpRequest.WithContext(tracedCtx)
+
+	request := Request{}
+	request.Populate(httpRequest, expandedBody)
+
+	connectedClient, err := r.clientFor(client, env, httpRequest.URL)
+	if err != nil {
+		return HistoricalCall{}, err
+	}
+	if connectedClient != client {
+		defer connectedClient.CloseIdleConnections()
+	}
+	request.recordCookies(connectedClient.Jar, httpRequest.URL)
+
+	httpResponse, doErr := connectedClient.Do(httpRequest)
+	if doErr != nil {
+		return HistoricalCall{}, doErr
+	}
+	defer httpResponse.Body.Close()
+	response := Response{
+		Status:     httpResponse.Status,
+		StatusCode: httpResponse.StatusCode,
+		Proto:      httpResponse.Proto,
+		Header:     httpResponse.Header,
+	}
+	if onResponse != nil {
+		onResponse(response)
+	}
+
+	recorded := &limitedBuffer{limit: StreamBodyLimit}
+	body := io.TeeReader(httpResponse.Body, recorded)
+	if response.IsEventStream() {
+		err = readEvents(body, onEvent)
+	} else {
+		err = readLines(body, onEvent)
+	}
+	response.Body = recorded.bytes
+	if response.Body == nil {
+		response.Body = []byte("")
+	}
+
+	request.maskSecrets(env)
+	call := HistoricalCall{Request: request, Response: response, Timing: timer.finish()}
+	if ctx.Err() != nil {
+		return call, nil
+	}
+	return call, err
+}
+
+// newStreamScanner Returns a scanner of the lines of the stream
+func newStreamScanner(stream io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 4096), maxStreamLine)
+	return scanner
+}
+
+// readEvents Reads Server-Sent Events, see
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+func readEvents(stream io.Reader, onEvent func(StreamEvent)) error {
+	scanner := newStreamScanner(stream)
+	event := StreamEvent{}
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line ends the event, events without data are dropped
+			if data != nil {
+				event.Data = strings.Join(data, "\n")
+				event.Received = time.Now()
+				onEvent(event)
+			}
+			event, data = StreamEvent{}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// A comment, usually sent to keep the connection open
+			continue
+		}
+
+		field, value := line, ""
+		if colon := strings.IndexByte(line, ':'); colon >= 0 {
+			field, value = line[:colon], strings.TrimPrefix(line[colon+1:], " ")
+		}
+		switch field {
+		case "event":
+			event.Event = value
+		case "id":
+			event.ID = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	// An event the stream ended in the middle of is dropped too
+	return scanner.Err()
+}
+
+// readLines Reads the lines of a stream as events, skipping blank ones
+func readLines(stream io.Reader, onEvent func(StreamEvent)) error {
+	scanner := newStreamScanner(stream)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.TrimSpace(line) != "" {
+			onEvent(StreamEvent{Received: time.Now(), Data: line})
+		}
+	}
+	return scanner.Err()
+}
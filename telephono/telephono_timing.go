@@ -0,0 +1,138 @@
+package telephono
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CallTiming is where the time of a call went. When redirects are followed,
+// the lookups, connections and handshakes of every hop are added up.
+type CallTiming struct {
+	// Resolving the host name
+	DNSLookup time.Duration
+
+	// Opening the TCP connection
+	Connect time.Duration
+
+	// The TLS handshake, 0 for plain HTTP
+	TLSHandshake time.Duration
+
+	// From the start of the call until the first byte of the response
+	FirstByte time.Duration
+
+	// From the start of the call until the whole response body was read
+	Total time.Duration
+
+	// An already open connection was used, so there was no lookup,
+	// connection or handshake
+	ReusedConnection bool
+}
+
+// String Returns the timing in one line, e.g.
+// "dns=1ms connect=2ms tls=30ms first-byte=100ms total=120ms"
+func (timing CallTiming) String() string {
+	parts := []string{}
+	if timing.ReusedConnection && timing.DNSLookup == 0 && timing.Connect == 0 {
+		parts = append(parts, "reused-connection")
+	} else {
+		parts = append(parts, "dns="+formatDuration(timing.DNSLookup), "connect="+formatDuration(timing.Connect))
+		if timing.TLSHandshake > 0 {
+			parts = append(parts, "tls="+formatDuration(timing.TLSHandshake))
+		}
+	}
+	parts = append(parts, "first-byte="+formatDuration(timing.FirstByte), "total="+formatDuration(timing.Total))
+	return strings.Join(parts, " ")
+}
+
+// formatDuration Rounds durations so they're readable but still useful for
+// fast local calls
+func formatDuration(duration time.Duration) string {
+	switch {
+	case duration >= time.Second:
+		return fmt.Sprintf("%.2fs", duration.Seconds())
+	case duration >= 10*time.Millisecond:
+		return duration.Round(time.Millisecond).String()
+	}
+	return duration.Round(10 * time.Microsecond).String()
+}
+
+// callTimer Measures a call using httptrace. The hooks can be called from
+// different goroutines, e.g. when dialing IPv4 and IPv6 at once.
+type callTimer struct {
+	sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart map[string]time.Time
+	tlsStart     time.Time
+	timing       CallTiming
+}
+
+// newCallTimer Starts timing and returns the context to make the call with
+func newCallTimer(ctx context.Context) (context.Context, *callTimer) {
+	timer := &callTimer{
+		start:        time.Now(),
+		connectStart: map[string]time.Time{},
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			timer.Lock()
+			defer timer.Unlock()
+			timer.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			timer.Lock()
+			defer timer.Unlock()
+			timer.timing.DNSLookup += time.Since(timer.dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			timer.Lock()
+			defer timer.Unlock()
+			timer.connectStart[network+addr] = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			timer.Lock()
+			defer timer.Unlock()
+			// Only count the dial that won
+			if err == nil {
+				timer.timing.Connect += time.Since(timer.connectStart[network+addr])
+			}
+		},
+		TLSHandshakeStart: func() {
+			timer.Lock()
+			defer timer.Unlock()
+			timer.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			timer.Lock()
+			defer timer.Unlock()
+			timer.timing.TLSHandshake += time.Since(timer.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			timer.Lock()
+			defer timer.Unlock()
+			if info.Reused {
+				timer.timing.ReusedConnection = true
+			}
+		},
+		GotFirstResponseByte: func() {
+			timer.Lock()
+			defer timer.Unlock()
+			// The last hop's response is the one that matters
+			timer.timing.FirstByte = time.Since(timer.start)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), timer
+}
+
+// finish Stops timing and returns the timing of the call
+func (timer *callTimer) finish() CallTiming {
+	timer.Lock()
+	defer timer.Unlock()
+	timer.timing.Total = time.Since(timer.start)
+	return timer.timing
+}
@@ -0,0 +1,221 @@
+package telephono
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// webSocketHeaders Headers the WebSocket handshake sets itself, which are left
+// out of the template's headers
+var webSocketHeaders = []string{"Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions"}
+
+// WebSocketFrame is a message sent or received over a WebSocket
+type WebSocketFrame struct {
+	// When the frame was sent or received
+	Time time.Time
+
+	// The frame was sent rather than received
+	Sent bool
+
+	// The frame is binary rather than text
+	Binary bool
+
+	Data []byte
+}
+
+// Format Returns the frame with when it was sent or received and how long
+// after the given start that was, ">" for sent and "<" for received frames,
+// e.g. "[15:04:05.000 +1.50s] > hello\n". Binary frames are hex dumped.
+func (frame *WebSocketFrame) Format(started time.Time) string {
+	direction := "<"
+	if frame.Sent {
+		direction = ">"
+	}
+	result := fmt.Sprintf("[%s +%s] %s ", frame.Time.Format("15:04:05.000"), formatDuration(frame.Time.Sub(started)), direction)
+	if frame.Binary {
+		return result + "binary frame of " + formatSize(len(frame.Data)) + "\n" + hex.Dump(frame.Data)
+	}
+	return result + strings.TrimRight(string(frame.Data), "\n") + "\n"
+}
+
+// WebSocketSession is an open WebSocket connection and the frames sent and
+// received over it. Frames can be sent while another goroutine receives.
+type WebSocketSession struct {
+	// When the connection was opened
+	Started time.Time
+
+	// The handshake, the response has no body
+	Request  Request
+	Response Response
+
+	conn   *websocket.Conn
+	sendMu sync.Mutex
+
+	// The User environment of the handshake, whose secrets are masked in
+	// the frames sent
+	user Environment
+
+	framesMu sync.Mutex
+	frames   []WebSocketFrame
+}
+
+// webSocketUrl Returns the URL with its http or https scheme replaced by ws
+// or wss
+func webSocketUrl(url string) string {
+	if strings.HasPrefix(url, "http://") {
+		return "ws://" + strings.TrimPrefix(url, "http://")
+	} else if strings.HasPrefix(url, "https://") {
+		return "wss://" + strings.TrimPrefix(url, "https://")
+	}
+	return url
+}
+
+// DialWebSocket Opens a WebSocket connection to the template's URL, which may
+// start with ws://, wss://, http:// or https://, with the template's headers
+// expanded in the given environment. The proxy, TLS settings and cookies of
+// the client are used, and its timeout limits the handshake.
+func (r *RequestTemplate) DialWebSocket(ctx context.Context, client *http.Client, env *CallBuddyEnvironment) (*WebSocketSession, error) {
+	httpRequest, expandedBody, newCallErr := r.newHttpRequest(env)
+	if newCallErr != nil {
+		return nil, newCallErr
+	}
+	header := httpRequest.Header.Clone()
+	for _, key := range webSocketHeaders {
+		header.Del(key)
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: client.Timeout,
+		Jar:              client.Jar,
+	}
+	if transport := httpTransport(client); transport != nil {
+		dialer.Proxy = transport.Proxy
+		dialer.NetDialContext = transport.DialContext
+		if connectTo := strings.TrimSpace(env.Expand(r.ConnectTo)); connectTo != "" {
+			dialer.NetDialContext = connectDial(transport.DialContext, hostPort(httpRequest.URL), connectAddress(connectTo, httpRequest.URL))
+		}
+		if transport.TLSClientConfig != nil {
+			// The handshake is HTTP/1.1, whatever version calls are forced to
+			dialer.TLSClientConfig = transport.TLSClientConfig.Clone()
+			dialer.TLSClientConfig.NextProtos = nil
+		}
+	}
+
+	session := &WebSocketSession{Started: time.Now(), user: env.User.Clone()}
+	session.Request.Populate(httpRequest, expandedBody)
+	session.Request.recordCookies(client.Jar, httpRequest.URL)
+	session.Request.maskSecrets(env)
+	conn, httpResponse, err := dialer.DialContext(ctx, webSocketUrl(httpRequest.URL.String()), header)
+	if err != nil {
+		if err == websocket.ErrBadHandshake && httpResponse != nil {
+			return nil, errors.New("The server didn't accept the WebSocket: " + httpResponse.Status)
+		}
+		return nil, err
+	}
+	session.conn = conn
+	session.Response = Response{
+		Status:     httpResponse.Status,
+		StatusCode: httpResponse.StatusCode,
+		Proto:      httpResponse.Proto,
+		Header:     httpResponse.Header,
+		Body:       []byte(""),
+	}
+	return session, nil
+}
+
+// record Adds the frame to the ones sent and received
+func (session *WebSocketSession) record(frame WebSocketFrame) {
+	session.framesMu.Lock()
+	defer session.framesMu.Unlock()
+	session.frames = append(session.frames, frame)
+}
+
+// Frames Returns the frames sent and received so far in order.
+func (session *WebSocketSession) Frames() []WebSocketFrame {
+	session.framesMu.Lock()
+	defer session.framesMu.Unlock()
+	return append([]WebSocketFrame(nil), session.frames...)
+}
+
+// Send Sends a text frame, or a binary one if binary is set, and returns it.
+// The values of secret variables are masked in the text frames returned and
+// recorded, like they are in the handshake.
+func (session *WebSocketSession) Send(data []byte, binary bool) (WebSocketFrame, error) {
+	messageType := websocket.TextMessage
+	if binary {
+		messageType = websocket.BinaryMessage
+	}
+	session.sendMu.Lock()
+	defer session.sendMu.Unlock()
+	if err := session.conn.WriteMessage(messageType, data); err != nil {
+		return WebSocketFrame{}, err
+	}
+	frame := WebSocketFrame{Time: time.Now(), Sent: true, Binary: binary, Data: data}
+	if !binary {
+		frame.Data = []byte(session.user.MaskSecrets(string(data)))
+	}
+	session.record(frame)
+	return frame, nil
+}
+
+// Receive Passes each frame received to onFrame until the connection is
+// closed. Closing it normally from either side isn't an error.
+func (session *WebSocketSession) Receive(onFrame func(WebSocketFrame)) error {
+	defer session.conn.Close()
+	for {
+		messageType, data, err := session.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+		frame := WebSocketFrame{Time: time.Now(), Binary: messageType == websocket.BinaryMessage, Data: data}
+		session.record(frame)
+		onFrame(frame)
+	}
+}
+
+// Close Closes the connection, telling the server first. Receive returns
+// once the server answers or the connection is gone.
+func (session *WebSocketSession) Close() error {
+	session.sendMu.Lock()
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	err := session.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	session.sendMu.Unlock()
+	if err != nil {
+		// The server can't be told, so don't wait for it
+		return session.conn.Close()
+	}
+	// Don't wait for a server that doesn't answer forever
+	time.AfterFunc(5*time.Second, func() { session.conn.Close() })
+	return nil
+}
+
+// Call Returns the session as a call for the history, the log of its frames
+// is the body, up to StreamBodyLimit bytes of it.
+func (session *WebSocketSession) Call() HistoricalCall {
+	log := &limitedBuffer{limit: StreamBodyLimit}
+	for _, frame := range session.Frames() {
+		fmt.Fprint(log, frame.Format(session.Started))
+	}
+	response := session.Response
+	response.Body = log.bytes
+	if response.Body == nil {
+		response.Body = []byte("")
+	}
+	return HistoricalCall{
+		Request:  session.Request,
+		Response: response,
+		Timing:   CallTiming{Total: time.Since(session.Started)},
+	}
+}
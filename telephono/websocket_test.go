@@ -0,0 +1,127 @@
+package telephono_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/call-buddy/call-buddy/telephono"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, append([]byte("echo "), data...))
+			conn.WriteMessage(websocket.BinaryMessage, []byte{0, 1, 2})
+		}
+	}))
+	defer server.Close()
+
+	env := newTestEnvironment()
+	env.User.Set("TOKEN", "secret")
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL, Headers: http.Header{}}
+	if _, err := template.DialWebSocket(context.Background(), http.DefaultClient, &env); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected the handshake to fail with 401, got %v", err)
+	}
+
+	template.Headers.Set("Authorization", "Bearer {{User.TOKEN}}")
+	template.Headers.Set("Connection", "keep-alive")
+	session, err := template.DialWebSocket(context.Background(), http.DefaultClient, &env)
+	if err != nil {
+		t.Fatalf("Dial failed: %s", err)
+	}
+	if session.Response.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected 101, got %d", session.Response.StatusCode)
+	}
+
+	received := make(chan telephono.WebSocketFrame)
+	closed := make(chan error)
+	go func() {
+		closed <- session.Receive(func(frame telephono.WebSocketFrame) {
+			received <- frame
+		})
+	}()
+	if _, err := session.Send([]byte("hello"), false); err != nil {
+		t.Fatalf("Send failed: %s", err)
+	}
+	if frame := <-received; frame.Binary || string(frame.Data) != "echo hello" {
+		t.Errorf("Expected the echo, got %+v", frame)
+	}
+	if frame := <-received; !frame.Binary || len(frame.Data) != 3 {
+		t.Errorf("Expected a binary frame, got %+v", frame)
+	}
+	session.Close()
+	if err := <-closed; err != nil {
+		t.Errorf("Expected closing not to be an error, got %s", err)
+	}
+
+	frames := session.Frames()
+	if len(frames) != 3 || !frames[0].Sent || frames[1].Sent {
+		t.Errorf("Expected the sent frame and the two received, got %+v", frames)
+	}
+	call := session.Call()
+	log := string(call.Response.Body)
+	if !strings.Contains(log, "> hello") || !strings.Contains(log, "< echo hello") || !strings.Contains(log, "binary frame of 3 bytes") {
+		t.Errorf("Expected the frames to be the body, got %q", log)
+	}
+}
+
+func TestWebSocketMasksSecrets(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	sent := make(chan string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			sent <- string(data)
+		}
+	}))
+	defer server.Close()
+
+	env := newTestEnvironment()
+	env.User.Unlock(newAgeKey(t))
+	env.User.SetSecret("PASSWORD", "hunter2")
+	template := telephono.RequestTemplate{Method: telephono.Get, Url: server.URL, Headers: http.Header{}}
+	session, err := template.DialWebSocket(context.Background(), http.DefaultClient, &env)
+	if err != nil {
+		t.Fatalf("Dial failed: %s", err)
+	}
+	defer session.Close()
+	frame, err := session.Send([]byte(env.Expand(`{"password":"{{User.PASSWORD}}"}`)), false)
+	if err != nil {
+		t.Fatalf("Send failed: %s", err)
+	}
+	if data := <-sent; data != `{"password":"hunter2"}` {
+		t.Errorf("Expected the secret to be sent, got %s", data)
+	}
+	if string(frame.Data) != `{"password":"{{User.PASSWORD}}"}` {
+		t.Errorf("Expected the secret to be masked in the frame, got %s", frame.Data)
+	}
+	if body := string(session.Call().Response.Body); strings.Contains(body, "hunter2") {
+		t.Errorf("Expected the secret to be masked in the history, got %s", body)
+	}
+}